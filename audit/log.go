@@ -0,0 +1,186 @@
+// Package audit keeps an append-only, hash-chained record of changes.
+// Each entry carries the hash of the one before it, so editing or
+// removing an entry breaks every hash after it.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is one recorded change. Before is empty for creations and After
+// is empty for deletions.
+type Entry struct {
+	Seq       int             `json:"seq"`
+	Time      time.Time       `json:"time"`
+	Actor     string          `json:"actor"`
+	ActorName string          `json:"actor_name,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+}
+
+// digest is the hash of the entry's contents and its predecessor's hash
+func (e Entry) digest() (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ChainError reports the first entry whose hash does not match
+type ChainError struct {
+	Seq int
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit entry %d does not match its hash", e.Seq)
+}
+
+// Log is an append-only audit log, optionally mirrored to a file
+type Log struct {
+	mu      sync.RWMutex
+	entries []Entry
+	file    *os.File
+}
+
+// NewLog returns an empty log kept in memory
+func NewLog() *Log {
+	return &Log{}
+}
+
+// Open returns a log backed by a JSON Lines file, loading and verifying
+// the entries already in it
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{file: file}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("audit entry %d: %w", len(l.entries), err)
+		}
+		l.entries = append(l.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := l.Verify(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append assigns the entry its sequence number and place in the chain,
+// stores it and returns it
+func (l *Log) Append(entry Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Seq = len(l.entries)
+	entry.Time = entry.Time.UTC()
+	if entry.Seq > 0 {
+		entry.PrevHash = l.entries[entry.Seq-1].Hash
+	}
+	hash, err := entry.digest()
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.Hash = hash
+
+	if l.file != nil {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return Entry{}, err
+		}
+		if _, err := l.file.Write(append(b, '\n')); err != nil {
+			return Entry{}, err
+		}
+	}
+	l.entries = append(l.entries, entry)
+	return entry, nil
+}
+
+// Filter selects entries. Zero fields match everything.
+type Filter struct {
+	Actor    string
+	Entity   string
+	EntityID string
+	Action   string
+	From     time.Time
+	To       time.Time
+	// Start is the first sequence number considered
+	Start int
+	Limit int
+}
+
+// Query returns matching entries in order
+func (l *Log) Query(f Filter) []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	entries := []Entry{}
+	for _, entry := range l.entries[min(max(f.Start, 0), len(l.entries)):] {
+		if (f.Actor == "" || entry.Actor == f.Actor) &&
+			(f.Entity == "" || entry.Entity == f.Entity) &&
+			(f.EntityID == "" || entry.EntityID == f.EntityID) &&
+			(f.Action == "" || entry.Action == f.Action) &&
+			(f.From.IsZero() || !entry.Time.Before(f.From)) &&
+			(f.To.IsZero() || entry.Time.Before(f.To)) {
+			entries = append(entries, entry)
+			if f.Limit > 0 && len(entries) == f.Limit {
+				break
+			}
+		}
+	}
+	return entries
+}
+
+// Verify recomputes the chain, returning a *ChainError for the first
+// entry that was altered, reordered or removed
+func (l *Log) Verify() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	prev := ""
+	for i, entry := range l.entries {
+		hash, err := entry.digest()
+		if err != nil {
+			return err
+		}
+		if entry.Seq != i || entry.PrevHash != prev || entry.Hash != hash {
+			return &ChainError{Seq: i}
+		}
+		prev = entry.Hash
+	}
+	return nil
+}
+
+// Len returns the number of entries
+func (l *Log) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.entries)
+}
@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sample returns a log holding three entries
+func sample(t *testing.T) *Log {
+	t.Helper()
+	l := NewLog()
+	at := time.Date(2025, time.March, 3, 10, 0, 0, 0, time.UTC)
+	for i, id := range []string{"1", "2", "3"} {
+		_, err := l.Append(Entry{
+			Time:     at.Add(time.Duration(i) * time.Minute),
+			Actor:    "staff:admin",
+			Action:   "create",
+			Entity:   "book",
+			EntityID: id,
+			After:    json.RawMessage(`{"id":` + id + `}`),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l
+}
+
+func TestAppendChainsEntries(t *testing.T) {
+	l := sample(t)
+	entries := l.Query(Filter{})
+	for i, entry := range entries {
+		if entry.Seq != i {
+			t.Errorf("entry %d has seq %d", i, entry.Seq)
+		}
+		prev := ""
+		if i > 0 {
+			prev = entries[i-1].Hash
+		}
+		if entry.PrevHash != prev {
+			t.Errorf("entry %d prev_hash = %q, want %q", i, entry.PrevHash, prev)
+		}
+		if entry.Hash == "" {
+			t.Errorf("entry %d has no hash", i)
+		}
+	}
+	if err := l.Verify(); err != nil {
+		t.Errorf("Verify() = %v, want nil", err)
+	}
+}
+
+func TestVerifyFindsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(l *Log)
+		want   int
+	}{
+		{"edited field", func(l *Log) { l.entries[1].Actor = "staff:mallory" }, 1},
+		{"edited payload", func(l *Log) { l.entries[2].After = json.RawMessage(`{"id":4}`) }, 2},
+		{"edited and rehashed", func(l *Log) {
+			l.entries[1].Action = "delete"
+			l.entries[1].Hash, _ = l.entries[1].digest()
+		}, 2},
+		{"first entry removed", func(l *Log) { l.entries = l.entries[1:] }, 0},
+		{"middle entry removed", func(l *Log) { l.entries = append(l.entries[:1], l.entries[2:]...) }, 1},
+		{"reordered", func(l *Log) { l.entries[1], l.entries[2] = l.entries[2], l.entries[1] }, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := sample(t)
+			tt.tamper(l)
+			var chainErr *ChainError
+			if err := l.Verify(); !errors.As(err, &chainErr) || chainErr.Seq != tt.want {
+				t.Errorf("Verify() = %v, want a chain error at entry %d", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2"} {
+		if _, err := l.Append(Entry{Actor: "staff:admin", Action: "create", Entity: "book", EntityID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.file.Close()
+
+	// Reopening continues the chain
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() = %v, want the saved log", err)
+	}
+	entry, err := l.Append(Entry{Actor: "staff:admin", Action: "delete", Entity: "book", EntityID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Seq != 2 || l.Len() != 3 {
+		t.Errorf("appended seq %d to a log of %d, want seq 2 of 3", entry.Seq, l.Len())
+	}
+	l.file.Close()
+
+	// A file edited on disk is refused
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(b), `"entity_id":"2"`, `"entity_id":"9"`, 1)
+	if err := os.WriteFile(path, []byte(edited), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var chainErr *ChainError
+	if _, err := Open(path); !errors.As(err, &chainErr) || chainErr.Seq != 1 {
+		t.Errorf("Open() = %v, want a chain error at entry 1", err)
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to spot
+const APIKeyPrefix = "gogo_"
+
+// NewAPIKey returns a random API key and the short prefix it is listed
+// under
+func NewAPIKey() (key, prefix string, err error) {
+	token, err := NewToken()
+	if err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + token
+	return key, key[:len(APIKeyPrefix)+8], nil
+}
+
+// ParseIPRanges normalizes a list of IP addresses and CIDR ranges
+func ParseIPRanges(ranges []string) ([]string, error) {
+	normalized := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		r = strings.TrimSpace(r)
+		if !strings.Contains(r, "/") {
+			addr, err := netip.ParseAddr(r)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid IP range %q", r)
+			}
+			r = netip.PrefixFrom(addr, addr.BitLen()).String()
+		}
+		prefix, err := netip.ParsePrefix(r)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid IP range %q", r)
+		}
+		normalized = append(normalized, prefix.Masked().String())
+	}
+	return normalized, nil
+}
+
+// IPAllowed reports whether ip falls in one of the ranges. An empty list
+// allows every address.
+func IPAllowed(ip string, ranges []string) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, r := range ranges {
+		if prefix, err := netip.ParsePrefix(r); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultAccessTTL is how long an access token lasts unless configured
+const DefaultAccessTTL = 15 * time.Minute
+
+// ErrInvalidToken is returned for tokens that are malformed, expired or
+// not signed by a known key
+var ErrInvalidToken = errors.New("Invalid or expired token")
+
+// AccessClaims are the claims in an access token. The subject is the
+// principal's ID.
+type AccessClaims struct {
+	Kind string `json:"kind"`
+	Name string `json:"name,omitempty"`
+	Role string `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenIssuer signs and verifies access tokens
+type TokenIssuer struct {
+	Keys   *KeySet
+	Issuer string
+	TTL    time.Duration
+}
+
+// Issue signs an access token for the principal with the active key and
+// returns it with its expiry
+func (t *TokenIssuer) Issue(principal Principal, now time.Time) (string, time.Time, error) {
+	key, ok := t.Keys.Key(t.Keys.Active)
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("active key %s is not configured", t.Keys.Active)
+	}
+	id, err := NewToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expires := now.Add(t.TTL).Truncate(time.Second)
+	claims := AccessClaims{
+		Kind: principal.Kind,
+		Name: principal.Name,
+		Role: principal.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Issuer:    t.Issuer,
+			Subject:   principal.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expires, nil
+}
+
+// Verify checks an access token's signature, issuer and expiry and
+// returns its claims. The key is chosen by the token's kid header and
+// must use the algorithm the token claims.
+func (t *TokenIssuer) Verify(raw string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		id, _ := token.Header["kid"].(string)
+		key, ok := t.Keys.Key(id)
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", id)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("key %s does not use %s", id, token.Method.Alg())
+		}
+		return key.verificationKey(), nil
+	}, jwt.WithIssuer(t.Issuer), jwt.WithExpirationRequired(), jwt.WithLeeway(30*time.Second))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
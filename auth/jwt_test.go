@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "gogo-test"
+
+// testKeys returns an HMAC, an RSA and an ECDSA key
+func testKeys(t *testing.T) (hmacKey, rsaKey, ecKey SigningKey) {
+	t.Helper()
+	hmacKey, err := NewHMACKey("hs", []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey = SigningKey{ID: "rs", Method: jwt.SigningMethodRS256, key: private}
+	ecKey, err = GenerateKey("es")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hmacKey, rsaKey, ecKey
+}
+
+// publicPEM is the PEM form of a key's public half, as anyone could
+// fetch it from the JWKS
+func publicPEM(t *testing.T, key SigningKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key.verificationKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// sign signs claims by hand, so that tokens Issue would never produce can
+// be built
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func testClaims(issuer string, expires time.Time) AccessClaims {
+	return AccessClaims{
+		Kind: PrincipalStaff,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   "admin",
+			IssuedAt:  jwt.NewNumericDate(expires.Add(-time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	hmacKey, rsaKey, ecKey := testKeys(t)
+	keys, err := NewKeySet(hmacKey, rsaKey, ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &TokenIssuer{Keys: keys, Issuer: testIssuer, TTL: DefaultAccessTTL}
+	now := time.Now()
+	valid := testClaims(testIssuer, now.Add(time.Hour))
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"HS256", sign(t, jwt.SigningMethodHS256, "hs", hmacKey.key, valid), true},
+		{"RS256", sign(t, jwt.SigningMethodRS256, "rs", rsaKey.key, valid), true},
+		{"ES256", sign(t, jwt.SigningMethodES256, "es", ecKey.key, valid), true},
+		{"expired within the leeway", sign(t, jwt.SigningMethodES256, "es", ecKey.key, testClaims(testIssuer, now.Add(-20*time.Second))), true},
+
+		// An HS256 token keyed with a public key anyone can fetch
+		{"HS256 with the RS256 public key", sign(t, jwt.SigningMethodHS256, "rs", publicPEM(t, rsaKey), valid), false},
+		{"HS256 with the ES256 public key", sign(t, jwt.SigningMethodHS256, "es", publicPEM(t, ecKey), valid), false},
+		{"RS256 under the ES256 kid", sign(t, jwt.SigningMethodRS256, "es", rsaKey.key, valid), false},
+		{"unknown kid", sign(t, jwt.SigningMethodES256, "old", ecKey.key, valid), false},
+		{"no kid", sign(t, jwt.SigningMethodES256, "", ecKey.key, valid), false},
+		{"alg none", sign(t, jwt.SigningMethodNone, "es", jwt.UnsafeAllowNoneSignatureType, valid), false},
+		{"alg none with the HMAC kid", sign(t, jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType, valid), false},
+		{"wrong issuer", sign(t, jwt.SigningMethodES256, "es", ecKey.key, testClaims("someone-else", now.Add(time.Hour))), false},
+		{"no issuer", sign(t, jwt.SigningMethodES256, "es", ecKey.key, testClaims("", now.Add(time.Hour))), false},
+		{"expired past the leeway", sign(t, jwt.SigningMethodES256, "es", ecKey.key, testClaims(testIssuer, now.Add(-40*time.Second))), false},
+		{"no expiry", sign(t, jwt.SigningMethodES256, "es", ecKey.key, AccessClaims{Kind: PrincipalStaff, RegisteredClaims: jwt.RegisteredClaims{Issuer: testIssuer, Subject: "admin"}}), false},
+		{"signed by another key", sign(t, jwt.SigningMethodHS256, "hs", []byte("fedcba9876543210fedcba9876543210"), valid), false},
+		{"malformed", "not.a.token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := issuer.Verify(tt.token)
+			switch {
+			case tt.ok && err != nil:
+				t.Errorf("Verify() = %v, want the claims", err)
+			case tt.ok && claims.Subject != "admin":
+				t.Errorf("subject = %q, want admin", claims.Subject)
+			case !tt.ok && err != ErrInvalidToken:
+				t.Errorf("Verify() = %+v, %v, want %v", claims, err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestIssueThenVerify(t *testing.T) {
+	principal := Principal{Kind: PrincipalStaff, ID: "admin", Name: "Admin", Role: RoleAdmin}
+	_, rsaKey, ecKey := testKeys(t)
+	for _, key := range []SigningKey{rsaKey, ecKey} {
+		keys, err := NewKeySet(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		issuer := &TokenIssuer{Keys: keys, Issuer: testIssuer, TTL: DefaultAccessTTL}
+		token, _, err := issuer.Issue(principal, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := issuer.Verify(token)
+		if err != nil {
+			t.Fatalf("%s: Verify() = %v", key.Method.Alg(), err)
+		}
+		if claims.Subject != principal.ID || claims.Kind != principal.Kind || claims.Role != principal.Role {
+			t.Errorf("%s: claims = %+v, want %+v", key.Method.Alg(), claims, principal)
+		}
+
+		// A token issued long enough ago has expired
+		token, _, err = issuer.Issue(principal, time.Now().Add(-DefaultAccessTTL-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := issuer.Verify(token); err != ErrInvalidToken {
+			t.Errorf("%s: Verify() of an expired token = %v, want %v", key.Method.Alg(), err, ErrInvalidToken)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	principal := Principal{Kind: PrincipalStaff, ID: "admin", Role: RoleAdmin}
+	oldKey, err := GenerateKey("2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := GenerateKey("2025")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, _ := NewKeySet(oldKey)
+	oldToken, _, err := (&TokenIssuer{Keys: before, Issuer: testIssuer, TTL: DefaultAccessTTL}).Issue(principal, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// While both keys are configured, tokens from either verify
+	during, _ := NewKeySet(oldKey, newKey)
+	issuer := &TokenIssuer{Keys: during, Issuer: testIssuer, TTL: DefaultAccessTTL}
+	newToken, _, err := issuer.Issue(principal, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := issuer.Verify(token); err != nil {
+			t.Errorf("Verify() during rotation = %v", err)
+		}
+	}
+
+	// Once the old key is removed its tokens stop verifying
+	after, _ := NewKeySet(newKey)
+	issuer = &TokenIssuer{Keys: after, Issuer: testIssuer, TTL: DefaultAccessTTL}
+	if _, err := issuer.Verify(oldToken); err != ErrInvalidToken {
+		t.Errorf("Verify() of a token from a removed key = %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := issuer.Verify(newToken); err != nil {
+		t.Errorf("Verify() of a token from the new key = %v", err)
+	}
+}
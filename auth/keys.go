@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MinSecretLength is the shortest HMAC secret accepted, in bytes
+const MinSecretLength = 32
+
+// SigningKey is a named key that tokens are signed and verified with
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	key    any
+}
+
+// NewHMACKey returns an HS256 key using a shared secret
+func NewHMACKey(id string, secret []byte) (SigningKey, error) {
+	if len(secret) < MinSecretLength {
+		return SigningKey{}, fmt.Errorf("key %s: HMAC secret must be at least %d bytes", id, MinSecretLength)
+	}
+	return SigningKey{ID: id, Method: jwt.SigningMethodHS256, key: secret}, nil
+}
+
+// GenerateKey returns a new ES256 key
+func GenerateKey(id string) (SigningKey, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return SigningKey{ID: id, Method: jwt.SigningMethodES256, key: private}, nil
+}
+
+// ParseKey reads a PEM-encoded RSA or ECDSA private key. Anything that is
+// not PEM is treated as an HMAC secret.
+func ParseKey(id string, raw []byte) (SigningKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return NewHMACKey(id, []byte(strings.TrimSpace(string(raw))))
+	}
+
+	var private any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("key %s: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < 2048 {
+			return SigningKey{}, fmt.Errorf("key %s: RSA keys must be at least 2048 bits", id)
+		}
+		return SigningKey{ID: id, Method: jwt.SigningMethodRS256, key: private}, nil
+	case *ecdsa.PrivateKey:
+		switch private.Curve {
+		case elliptic.P256():
+			return SigningKey{ID: id, Method: jwt.SigningMethodES256, key: private}, nil
+		case elliptic.P384():
+			return SigningKey{ID: id, Method: jwt.SigningMethodES384, key: private}, nil
+		case elliptic.P521():
+			return SigningKey{ID: id, Method: jwt.SigningMethodES512, key: private}, nil
+		}
+		return SigningKey{}, fmt.Errorf("key %s: unsupported curve", id)
+	}
+	return SigningKey{}, fmt.Errorf("key %s: unsupported key type %T", id, private)
+}
+
+// verificationKey is what the JWT library checks signatures against
+func (k SigningKey) verificationKey() any {
+	switch key := k.key.(type) {
+	case *rsa.PrivateKey:
+		return &key.PublicKey
+	case *ecdsa.PrivateKey:
+		return &key.PublicKey
+	}
+	return k.key
+}
+
+// JWK is a public key in JSON Web Key form
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public half of the key. HMAC keys have no public half
+// and are never published.
+func (k SigningKey) JWK() (JWK, bool) {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch key := k.key.(type) {
+	case *rsa.PrivateKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encode(key.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PrivateKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = key.Curve.Params().Name
+		jwk.X = encode(key.X.FillBytes(make([]byte, size)))
+		jwk.Y = encode(key.Y.FillBytes(make([]byte, size)))
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// KeySet holds every key tokens may be verified with and the one new
+// tokens are signed with. Rotating means adding a new key, making it
+// active and removing the old one once its tokens have expired.
+type KeySet struct {
+	Active string
+	keys   map[string]SigningKey
+	order  []string
+}
+
+// NewKeySet returns a key set whose active key is the last one given
+func NewKeySet(keys ...SigningKey) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("a key set needs at least one key")
+	}
+	set := &KeySet{keys: make(map[string]SigningKey)}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("signing keys need an ID")
+		}
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %s", key.ID)
+		}
+		set.keys[key.ID] = key
+		set.order = append(set.order, key.ID)
+	}
+	set.Active = keys[len(keys)-1].ID
+	return set, nil
+}
+
+// LoadKeySet reads keys from a comma-separated list of id=path pairs,
+// where each file holds a PEM private key or an HMAC secret. The active
+// key is the one named, or the last listed.
+func LoadKeySet(spec, active string) (*KeySet, error) {
+	var keys []SigningKey
+	for _, entry := range strings.Split(spec, ",") {
+		id, path, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid key entry %q, expected id=path", entry)
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseKey(id, raw)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	set, err := NewKeySet(keys...)
+	if err != nil {
+		return nil, err
+	}
+	if active != "" {
+		if _, ok := set.keys[active]; !ok {
+			return nil, fmt.Errorf("active key %s is not configured", active)
+		}
+		set.Active = active
+	}
+	return set, nil
+}
+
+// Key returns the key with the ID
+func (s *KeySet) Key(id string) (SigningKey, bool) {
+	key, ok := s.keys[id]
+	return key, ok
+}
+
+// JWKS returns the public keys in the set
+func (s *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, id := range s.order {
+		if jwk, ok := s.keys[id].JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
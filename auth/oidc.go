@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig configures staff login through an OpenID Connect provider
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL; its discovery document is
+	// read from Issuer + "/.well-known/openid-configuration"
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// GroupsClaim names the ID token claim listing the user's groups
+	GroupsClaim string
+	// RoleMap maps provider groups to staff roles
+	RoleMap map[string]string
+}
+
+// OIDCIdentity is a user the provider vouched for
+type OIDCIdentity struct {
+	Subject  string
+	Username string
+	Name     string
+	Email    string
+	Groups   []string
+}
+
+// OIDCProvider runs the authorization code flow against a discovered
+// provider
+type OIDCProvider struct {
+	config   OIDCConfig
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// roleRank orders roles from most to least privileged, so a user in
+// several mapped groups gets the strongest role
+var roleRank = []string{RoleAdmin, RoleLibrarian, RoleCirculation, RoleReadOnly}
+
+// ParseRoleMap reads a comma-separated list of group=role pairs. At least
+// one pair is required, as nobody could log in without one.
+func ParseRoleMap(spec string) (map[string]string, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, errors.New("at least one group=role mapping is required")
+	}
+	roles := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		group, role, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || group == "" {
+			return nil, fmt.Errorf("invalid role mapping %q, expected group=role", entry)
+		}
+		if !ValidRole(role) {
+			return nil, fmt.Errorf("role mapping %q: unknown role %s", entry, role)
+		}
+		roles[group] = role
+	}
+	return roles, nil
+}
+
+// NewOIDCProvider fetches the provider's discovery document and signing
+// keys location
+func NewOIDCProvider(ctx context.Context, config OIDCConfig) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+
+	return &OIDCProvider{
+		config: config,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       config.Scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+// AuthCodeURL returns where to send the user to log in. The verifier is
+// the PKCE secret the callback must present with the code.
+func (p *OIDCProvider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange trades an authorization code for tokens and returns the
+// identity in the verified ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce, verifier string) (OIDCIdentity, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("exchanging code: %w", err)
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return OIDCIdentity{}, errors.New("token response has no ID token")
+	}
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("verifying ID token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return OIDCIdentity{}, errors.New("ID token nonce does not match")
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return OIDCIdentity{}, err
+	}
+	identity := OIDCIdentity{
+		Subject:  idToken.Subject,
+		Username: stringClaim(claims, "preferred_username"),
+		Name:     stringClaim(claims, "name"),
+		Email:    stringClaim(claims, "email"),
+	}
+	if identity.Username == "" {
+		identity.Username = identity.Email
+	}
+	if identity.Username == "" {
+		identity.Username = identity.Subject
+	}
+	switch groups := claims[p.config.GroupsClaim].(type) {
+	case string:
+		identity.Groups = []string{groups}
+	case []any:
+		for _, group := range groups {
+			if group, ok := group.(string); ok {
+				identity.Groups = append(identity.Groups, group)
+			}
+		}
+	}
+	return identity, nil
+}
+
+// Role returns the most privileged role mapped from the identity's
+// groups
+func (p *OIDCProvider) Role(identity OIDCIdentity) (string, bool) {
+	held := make(map[string]bool)
+	for _, group := range identity.Groups {
+		if role, ok := p.config.RoleMap[group]; ok {
+			held[role] = true
+		}
+	}
+	for _, role := range roleRank {
+		if held[role] {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
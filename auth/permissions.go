@@ -0,0 +1,107 @@
+package auth
+
+import "sort"
+
+// Permissions guarding the API. Every protected route names one of these;
+// roles and API key scopes are sets of them.
+const (
+	CatalogRead      = "catalog:read"
+	CatalogWrite     = "catalog:write"
+	MembersRead      = "members:read"
+	MembersWrite     = "members:write"
+	CirculationRead  = "circulation:read"
+	CirculationWrite = "circulation:write"
+	StaffAdmin       = "staff:admin"
+	AuditRead        = "audit:read"
+	WebhooksManage   = "webhooks:manage"
+)
+
+// Staff roles
+const (
+	RoleAdmin       = "admin"
+	RoleLibrarian   = "librarian"
+	RoleCirculation = "circulation"
+	RoleReadOnly    = "readonly"
+)
+
+// RolePermissions lists what each staff role may do
+var RolePermissions = map[string][]string{
+	RoleAdmin: {
+		CatalogRead, CatalogWrite, MembersRead, MembersWrite,
+		CirculationRead, CirculationWrite, StaffAdmin, AuditRead,
+		WebhooksManage,
+	},
+	RoleLibrarian: {
+		CatalogRead, CatalogWrite, MembersRead, MembersWrite,
+		CirculationRead, CirculationWrite,
+	},
+	RoleCirculation: {
+		CatalogRead, MembersRead, MembersWrite,
+		CirculationRead, CirculationWrite,
+	},
+	RoleReadOnly: {
+		CatalogRead, MembersRead, CirculationRead,
+	},
+}
+
+// AllPermissions returns every permission in sorted order
+func AllPermissions() []string {
+	permissions := append([]string(nil), RolePermissions[RoleAdmin]...)
+	sort.Strings(permissions)
+	return permissions
+}
+
+// ValidRole reports whether role is a known staff role
+func ValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// ValidPermission reports whether permission is a known permission
+func ValidPermission(permission string) bool {
+	for _, known := range RolePermissions[RoleAdmin] {
+		if known == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Principal is an authenticated caller of the staff API
+type Principal struct {
+	Kind        string   `json:"kind"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Role        string   `json:"role,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// Principal kinds
+const (
+	PrincipalStaff  = "staff"
+	PrincipalAPIKey = "api_key"
+)
+
+// NewStaffPrincipal builds the principal for a staff user with a role
+func NewStaffPrincipal(id, name, role string) Principal {
+	permissions := append([]string(nil), RolePermissions[role]...)
+	sort.Strings(permissions)
+	return Principal{Kind: PrincipalStaff, ID: id, Name: name, Role: role, Permissions: permissions}
+}
+
+// NewAPIKeyPrincipal builds the principal for an API key limited to scopes
+func NewAPIKeyPrincipal(id, name string, scopes []string) Principal {
+	permissions := append([]string(nil), scopes...)
+	sort.Strings(permissions)
+	return Principal{Kind: PrincipalAPIKey, ID: id, Name: name, Permissions: permissions}
+}
+
+// Can reports whether the principal holds the permission
+func (p Principal) Can(permission string) bool {
+	for _, held := range p.Permissions {
+		if held == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+// Package bus passes domain events from the parts of the service that
+// make changes to the parts that react to them, such as the search index,
+// the audit log and webhooks. Events are published once a change has been
+// stored.
+//
+// A synchronous subscriber handles each event before Publish returns; an
+// asynchronous one handles it later in the background. Either way a
+// subscriber sees the events about one aggregate, such as one book, in the
+// order they were published. A subscriber that fails or panics is logged
+// and counted, and does not affect the publisher or other subscribers.
+package bus
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// asyncWorkers is how many events an asynchronous subscriber handles at
+// once, each worker taking a share of the aggregates
+const asyncWorkers = 4
+
+// Event is a typed domain event
+type Event interface {
+	// EventType names the event, such as book.created
+	EventType() string
+	// Aggregate names the record the event is about, such as book:3
+	Aggregate() string
+}
+
+// Meta says who made a change, for subscribers such as the audit log
+type Meta struct {
+	Actor     string
+	ActorName string
+	RequestID string
+}
+
+type metaKey struct{}
+
+// WithMeta returns a context carrying meta into the events published with
+// it
+func WithMeta(ctx context.Context, meta Meta) context.Context {
+	return context.WithValue(ctx, metaKey{}, meta)
+}
+
+// MetaFrom returns the meta carried by ctx, empty for changes the service
+// makes by itself
+func MetaFrom(ctx context.Context) Meta {
+	meta, _ := ctx.Value(metaKey{}).(Meta)
+	return meta
+}
+
+// Envelope is an event as subscribers receive it. Seq increases in the
+// order events are published.
+type Envelope struct {
+	Seq   int
+	Time  time.Time
+	Meta  Meta
+	Event Event
+}
+
+// Handler reacts to an event
+type Handler func(Envelope) error
+
+// Stats counts a subscriber's events. Pending is how many are waiting for
+// an asynchronous subscriber.
+type Stats struct {
+	Name      string `json:"name"`
+	Async     bool   `json:"async"`
+	Delivered int64  `json:"delivered"`
+	Failed    int64  `json:"failed"`
+	Pending   int64  `json:"pending"`
+}
+
+// Bus passes published events to its subscribers
+type Bus struct {
+	mu   sync.Mutex
+	seq  int
+	subs []*subscriber
+}
+
+type subscriber struct {
+	name   string
+	handle Handler
+	// queues holds an asynchronous subscriber's waiting events, one queue
+	// per worker; it is nil for a synchronous subscriber
+	queues    []*queue
+	delivered atomic.Int64
+	failed    atomic.Int64
+	pending   atomic.Int64
+}
+
+// queue is a worker's events, oldest first. It grows as needed, so that
+// Publish never waits for a slow subscriber.
+type queue struct {
+	mu     sync.Mutex
+	events []Envelope
+	ready  chan struct{}
+}
+
+// New returns a bus with no subscribers
+func New() *Bus {
+	return &Bus{}
+}
+
+// Default is the bus the service publishes its domain events on
+var Default = New()
+
+// Publish publishes an event on the default bus
+func Publish(ctx context.Context, event Event) {
+	Default.Publish(ctx, event)
+}
+
+// Subscribe adds a synchronous subscriber to the default bus
+func Subscribe(name string, handle Handler) {
+	Default.Subscribe(name, handle)
+}
+
+// SubscribeAsync adds an asynchronous subscriber to the default bus
+func SubscribeAsync(name string, handle Handler) {
+	Default.SubscribeAsync(name, handle)
+}
+
+// Subscribe adds a subscriber that handles each event before Publish
+// returns, in the publisher's goroutine. Subscribers are called in the
+// order they subscribed.
+func (b *Bus) Subscribe(name string, handle Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subs = append(b.subs, &subscriber{name: name, handle: handle})
+}
+
+// SubscribeAsync adds a subscriber that handles events in the background.
+// Events about the same aggregate are handled one at a time, in order.
+func (b *Bus) SubscribeAsync(name string, handle Handler) {
+	sub := &subscriber{name: name, handle: handle}
+	for i := 0; i < asyncWorkers; i++ {
+		q := &queue{ready: make(chan struct{}, 1)}
+		sub.queues = append(sub.queues, q)
+		go sub.work(q)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subs = append(b.subs, sub)
+}
+
+// Publish passes an event to every subscriber, with the meta carried by
+// ctx. Events about one aggregate must be published one at a time, as
+// they are when published with the database lock held.
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	b.mu.Lock()
+	b.seq++
+	env := Envelope{Seq: b.seq, Time: time.Now(), Meta: MetaFrom(ctx), Event: event}
+	subs := b.subs
+	for _, sub := range subs {
+		if sub.queues != nil {
+			sub.enqueue(env)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		if sub.queues == nil {
+			sub.deliver(env)
+		}
+	}
+}
+
+// Stats counts each subscriber's events, in the order they subscribed
+func (b *Bus) Stats() []Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := make([]Stats, len(b.subs))
+	for i, sub := range b.subs {
+		stats[i] = Stats{
+			Name:      sub.name,
+			Async:     sub.queues != nil,
+			Delivered: sub.delivered.Load(),
+			Failed:    sub.failed.Load(),
+			Pending:   sub.pending.Load(),
+		}
+	}
+	return stats
+}
+
+// enqueue hands an event to the worker for its aggregate
+func (s *subscriber) enqueue(env Envelope) {
+	h := fnv.New32a()
+	h.Write([]byte(env.Event.Aggregate()))
+	q := s.queues[h.Sum32()%uint32(len(s.queues))]
+
+	s.pending.Add(1)
+	q.mu.Lock()
+	q.events = append(q.events, env)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// work handles a queue's events as they arrive
+func (s *subscriber) work(q *queue) {
+	for range q.ready {
+		for {
+			q.mu.Lock()
+			if len(q.events) == 0 {
+				q.mu.Unlock()
+				break
+			}
+			env := q.events[0]
+			q.events[0] = Envelope{}
+			q.events = q.events[1:]
+			q.mu.Unlock()
+
+			s.deliver(env)
+			s.pending.Add(-1)
+		}
+	}
+}
+
+// deliver hands an event to the subscriber, logging a failure
+func (s *subscriber) deliver(env Envelope) {
+	if err := call(s.handle, env); err != nil {
+		s.failed.Add(1)
+		log.Printf("%s: %s event %d: %v", s.name, env.Event.EventType(), env.Seq, err)
+		return
+	}
+	s.delivered.Add(1)
+}
+
+// call runs a handler, turning a panic into an error
+func call(handle Handler, env Envelope) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handle(env)
+}
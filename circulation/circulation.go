@@ -0,0 +1,502 @@
+// Package circulation implements checkout, renewal, return and hold
+// operations against the in-memory database, enforcing member account
+// status and borrowing limits. Loans are recorded in an append-only
+// circulation log, from which the current loans are projected. Each change
+// is published on the event bus, attributed to the caller carried by the
+// context it was made with.
+package circulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+var (
+	ErrMemberNotFound = errors.New("Member not found")
+	ErrBookNotFound   = errors.New("Book not found")
+	ErrLoanNotFound   = errors.New("Borrower not found")
+	ErrHoldNotFound   = errors.New("Hold not found")
+	ErrFineNotFound   = errors.New("Fine not found")
+	ErrLoanReturned   = errors.New("Book has already been returned")
+	ErrLoanLost       = errors.New("Book has been marked lost")
+	ErrLoanNotLost    = errors.New("Book is not marked lost")
+	ErrHoldClosed     = errors.New("Hold is no longer open")
+	ErrFineSettled    = errors.New("Fine has already been settled")
+	ErrInvalidStatus  = errors.New("Status must be active, suspended or blocked")
+)
+
+// PolicyError lists every rule that refused an operation
+type PolicyError struct {
+	Violations []data.RuleViolation
+}
+
+func (e *PolicyError) Error() string {
+	rules := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		rules[i] = v.Rule
+	}
+	return "Refused by circulation rules: " + strings.Join(rules, ", ")
+}
+
+// Penalty is the overdue charge for a loan due at due as of now, counting
+// only full days late.
+func Penalty(due, now time.Time) float64 {
+	days := math.Floor(now.Sub(due).Hours() / 24)
+	if days <= 0 {
+		return 0
+	}
+	return days * data.FinePerDay
+}
+
+// Account returns the effective status of a member's account
+func Account(memberID string, now time.Time) (data.AccountStatus, error) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	member, ok := data.InMemoryDB.Members[memberID]
+	if !ok {
+		return data.AccountStatus{}, ErrMemberNotFound
+	}
+	return account(member, now), nil
+}
+
+// SetStatus changes the staff-controlled status of a member. Suspensions
+// may end on a given date; blocks last until lifted.
+func SetStatus(ctx context.Context, memberID, status, reason string, until data.Date) (data.Member, error) {
+	if status != data.StatusActive && status != data.StatusSuspended && status != data.StatusBlocked {
+		return data.Member{}, ErrInvalidStatus
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	member, ok := data.InMemoryDB.Members[memberID]
+	if !ok {
+		return data.Member{}, ErrMemberNotFound
+	}
+	before := member
+	member.Status = status
+	member.StatusReason = reason
+	member.SuspendedUntil = data.Date{}
+	if status == data.StatusSuspended {
+		member.SuspendedUntil = until
+	}
+	if status == data.StatusActive {
+		member.StatusReason = ""
+	}
+	data.InMemoryDB.Members[memberID] = member
+	bus.Publish(ctx, data.MemberStatusChanged{Before: before, After: member})
+	return member, nil
+}
+
+// Checkout lends a book to a member
+func Checkout(ctx context.Context, memberID string, bookID int, now time.Time) (data.Borrower, error) {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	expireHolds(ctx, now)
+
+	member, ok := data.InMemoryDB.Members[memberID]
+	if !ok {
+		return data.Borrower{}, ErrMemberNotFound
+	}
+	book, ok := data.InMemoryDB.Books[bookID]
+	if !ok {
+		return data.Borrower{}, ErrBookNotFound
+	}
+
+	status := account(member, now)
+	violations := status.Reasons
+	if status.ActiveLoans >= status.MaxLoans {
+		violations = append(violations, data.RuleViolation{Rule: data.RuleLoanLimit,
+			Message: fmt.Sprintf("Member already has %d of %d loans allowed", status.ActiveLoans, status.MaxLoans)})
+	}
+	if loan, ok := activeLoan(bookID); ok {
+		if loan.MemberID == memberID {
+			violations = append(violations, data.RuleViolation{Rule: data.RuleAlreadyBorrowed, Message: "Member already has this book"})
+		} else {
+			violations = append(violations, data.RuleViolation{Rule: data.RuleBookUnavailable, Message: "Book is on loan to another member"})
+		}
+	}
+	if _, ok := lostLoan(bookID); ok {
+		violations = append(violations, data.RuleViolation{Rule: data.RuleBookLost, Message: "Book is marked lost"})
+	}
+	if hold, ok := readyHold(bookID); ok && hold.MemberID != memberID {
+		violations = append(violations, data.RuleViolation{Rule: data.RuleReserved, Message: "Book is waiting for pickup by another member"})
+	}
+	if len(violations) > 0 {
+		return data.Borrower{}, &PolicyError{Violations: violations}
+	}
+
+	due := now.AddDate(0, 0, category(member).LoanDays)
+	entry := loanEntry(data.CirculationCheckedOut, data.Borrower{
+		ID:       data.InMemoryDB.NextBorrowerID,
+		MemberID: memberID,
+		BookID:   bookID,
+		Branch:   book.Branch,
+	}, now)
+	entry.DueDate = &due
+	loan := record(ctx, entry)
+	bus.Publish(ctx, data.LoanCheckedOut{Loan: loan})
+
+	for id, hold := range data.InMemoryDB.Holds {
+		if hold.BookID == bookID && hold.MemberID == memberID && hold.Open() {
+			hold.Status = data.HoldFulfilled
+			data.InMemoryDB.Holds[id] = hold
+			bus.Publish(ctx, data.HoldFilled{Hold: hold})
+		}
+	}
+
+	return loan, nil
+}
+
+// Renew extends a loan by another loan period from the later of now and
+// the current due date.
+func Renew(ctx context.Context, loanID int, now time.Time) (data.Borrower, error) {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	loan, ok := data.InMemoryDB.Borrowers[loanID]
+	if !ok {
+		return data.Borrower{}, ErrLoanNotFound
+	}
+	if loan.Missing() {
+		return data.Borrower{}, ErrLoanLost
+	}
+	if !loan.Active() {
+		return data.Borrower{}, ErrLoanReturned
+	}
+	member, ok := data.InMemoryDB.Members[loan.MemberID]
+	if !ok {
+		return data.Borrower{}, ErrMemberNotFound
+	}
+
+	terms := category(member)
+	violations := account(member, now).Reasons
+	if loan.Renewals >= terms.MaxRenewals {
+		violations = append(violations, data.RuleViolation{Rule: data.RuleRenewalLimit,
+			Message: fmt.Sprintf("Loan has been renewed %d of %d times allowed", loan.Renewals, terms.MaxRenewals)})
+	}
+	for _, hold := range data.InMemoryDB.Holds {
+		if hold.BookID == loan.BookID && hold.MemberID != loan.MemberID && hold.Open() {
+			violations = append(violations, data.RuleViolation{Rule: data.RuleHoldQueue, Message: "Other members are waiting for this book"})
+			break
+		}
+	}
+	if len(violations) > 0 {
+		return data.Borrower{}, &PolicyError{Violations: violations}
+	}
+
+	before := loan
+	from := loan.DueDate
+	if now.After(from) {
+		from = now
+	}
+	due := from.AddDate(0, 0, terms.LoanDays)
+	entry := loanEntry(data.CirculationRenewed, loan, now)
+	entry.DueDate = &due
+	loan = record(ctx, entry)
+	bus.Publish(ctx, data.LoanRenewed{Before: before, Loan: loan})
+
+	return loan, nil
+}
+
+// Return checks a book back in. A late return is charged a fine, and the
+// next hold on the book becomes ready for pickup.
+func Return(ctx context.Context, loanID int, now time.Time) (data.Borrower, *data.Fine, error) {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	loan, ok := data.InMemoryDB.Borrowers[loanID]
+	if !ok {
+		return data.Borrower{}, nil, ErrLoanNotFound
+	}
+	if loan.Missing() {
+		return data.Borrower{}, nil, ErrLoanLost
+	}
+	if !loan.Active() {
+		return data.Borrower{}, nil, ErrLoanReturned
+	}
+
+	before := loan
+	loan = record(ctx, loanEntry(data.CirculationReturned, loan, now))
+	bus.Publish(ctx, data.LoanReturned{Before: before, Loan: loan})
+
+	var fine *data.Fine
+	if amount := Penalty(loan.DueDate, now); amount > 0 {
+		fine = assessFine(ctx, loan, amount, fmt.Sprintf("Returned %.0f days late", amount/data.FinePerDay), now)
+	}
+
+	promoteHold(ctx, loan.BookID, now)
+
+	return loan, fine, nil
+}
+
+// MarkLost closes a loan whose book will not come back, charging the
+// member the lost book fee and any overdue penalty. The book cannot be
+// lent again, and holds on it keep waiting, until it is found.
+func MarkLost(ctx context.Context, loanID int, now time.Time) (data.Borrower, *data.Fine, error) {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	loan, ok := data.InMemoryDB.Borrowers[loanID]
+	if !ok {
+		return data.Borrower{}, nil, ErrLoanNotFound
+	}
+	if loan.Missing() {
+		return data.Borrower{}, nil, ErrLoanLost
+	}
+	if !loan.Active() {
+		return data.Borrower{}, nil, ErrLoanReturned
+	}
+
+	before := loan
+	loan = record(ctx, loanEntry(data.CirculationMarkedLost, loan, now))
+	bus.Publish(ctx, data.LoanMarkedLost{Before: before, Loan: loan})
+
+	reason := "Lost"
+	penalty := Penalty(loan.DueDate, now)
+	if penalty > 0 {
+		reason = fmt.Sprintf("Lost %.0f days after it was due", penalty/data.FinePerDay)
+	}
+	fine := assessFine(ctx, loan, data.LostBookFee+penalty, reason, now)
+
+	return loan, fine, nil
+}
+
+// MarkFound records that the book of a lost loan has turned up, putting
+// it back on the shelf. The next hold on the book becomes ready for
+// pickup. Fines charged for the loss stand until staff waive them.
+func MarkFound(ctx context.Context, loanID int, now time.Time) (data.Borrower, error) {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	loan, ok := data.InMemoryDB.Borrowers[loanID]
+	if !ok {
+		return data.Borrower{}, ErrLoanNotFound
+	}
+	if !loan.Missing() {
+		return data.Borrower{}, ErrLoanNotLost
+	}
+
+	before := loan
+	loan = record(ctx, loanEntry(data.CirculationFound, loan, now))
+	bus.Publish(ctx, data.LoanFound{Before: before, Loan: loan})
+
+	promoteHold(ctx, loan.BookID, now)
+
+	return loan, nil
+}
+
+// DeleteLoan removes a loan from the current loans. Its entries stay in
+// the circulation log, so it remains in the book's and member's history.
+func DeleteLoan(ctx context.Context, loanID int, now time.Time) (data.Borrower, error) {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	loan, ok := data.InMemoryDB.Borrowers[loanID]
+	if !ok {
+		return data.Borrower{}, ErrLoanNotFound
+	}
+	record(ctx, loanEntry(data.CirculationDeleted, loan, now))
+	bus.Publish(ctx, data.LoanDeleted{Loan: loan})
+
+	return loan, nil
+}
+
+// loanEntry starts a circulation log entry about a loan
+func loanEntry(kind string, loan data.Borrower, now time.Time) data.CirculationEvent {
+	return data.CirculationEvent{
+		Type:     kind,
+		Time:     now,
+		LoanID:   loan.ID,
+		MemberID: loan.MemberID,
+		BookID:   loan.BookID,
+		Branch:   loan.Branch,
+	}
+}
+
+// assessFine charges a member for a loan and logs the charge.
+// The caller must hold the database lock.
+func assessFine(ctx context.Context, loan data.Borrower, amount float64, reason string, now time.Time) *data.Fine {
+	fine := data.Fine{
+		ID:         data.InMemoryDB.NextFineID,
+		MemberID:   loan.MemberID,
+		BorrowerID: loan.ID,
+		Amount:     amount,
+		Reason:     reason,
+		Assessed:   now,
+	}
+	data.InMemoryDB.Fines[fine.ID] = fine
+	data.InMemoryDB.NextFineID++
+
+	entry := loanEntry(data.CirculationFineAssessed, loan, now)
+	entry.FineID, entry.Amount = &fine.ID, fine.Amount
+	record(ctx, entry)
+	bus.Publish(ctx, data.FineAssessed{Fine: fine})
+	return &fine
+}
+
+// PlaceHold queues a member for a book. A hold on a book that is on the
+// shelf with nobody else waiting is ready for pickup straight away.
+func PlaceHold(ctx context.Context, memberID string, bookID int, now time.Time) (data.Hold, error) {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	expireHolds(ctx, now)
+
+	member, ok := data.InMemoryDB.Members[memberID]
+	if !ok {
+		return data.Hold{}, ErrMemberNotFound
+	}
+	book, ok := data.InMemoryDB.Books[bookID]
+	if !ok {
+		return data.Hold{}, ErrBookNotFound
+	}
+
+	status := account(member, now)
+	violations := status.Reasons
+	if status.OpenHolds >= status.MaxHolds {
+		violations = append(violations, data.RuleViolation{Rule: data.RuleHoldLimit,
+			Message: fmt.Sprintf("Member already has %d of %d holds allowed", status.OpenHolds, status.MaxHolds)})
+	}
+	for _, hold := range data.InMemoryDB.Holds {
+		if hold.BookID == bookID && hold.MemberID == memberID && hold.Open() {
+			violations = append(violations, data.RuleViolation{Rule: data.RuleDuplicateHold, Message: "Member already has a hold on this book"})
+			break
+		}
+	}
+	if loan, ok := activeLoan(bookID); ok && loan.MemberID == memberID {
+		violations = append(violations, data.RuleViolation{Rule: data.RuleAlreadyBorrowed, Message: "Member already has this book"})
+	}
+	if len(violations) > 0 {
+		return data.Hold{}, &PolicyError{Violations: violations}
+	}
+
+	hold := data.Hold{
+		ID:       data.InMemoryDB.NextHoldID,
+		MemberID: memberID,
+		BookID:   bookID,
+		Placed:   now,
+		Status:   data.HoldWaiting,
+		Branch:   book.Branch,
+	}
+	data.InMemoryDB.Holds[hold.ID] = hold
+	data.InMemoryDB.NextHoldID++
+	bus.Publish(ctx, data.HoldPlaced{Hold: hold})
+
+	if promoted := promoteHold(ctx, bookID, now); promoted != nil && promoted.ID == hold.ID {
+		hold = *promoted
+	}
+
+	return hold, nil
+}
+
+// CancelHold withdraws a hold, passing a ready book on to the next member
+func CancelHold(ctx context.Context, holdID int, now time.Time) (data.Hold, error) {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	hold, ok := data.InMemoryDB.Holds[holdID]
+	if !ok {
+		return data.Hold{}, ErrHoldNotFound
+	}
+	if !hold.Open() {
+		return data.Hold{}, ErrHoldClosed
+	}
+
+	before := hold
+	hold.Status = data.HoldCancelled
+	data.InMemoryDB.Holds[holdID] = hold
+	bus.Publish(ctx, data.HoldWithdrawn{Before: before, Hold: hold})
+	promoteHold(ctx, hold.BookID, now)
+
+	return hold, nil
+}
+
+// ExpireHolds expires ready holds that were not picked up in time and
+// returns them.
+func ExpireHolds(ctx context.Context, now time.Time) []data.Hold {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	return expireHolds(ctx, now)
+}
+
+// SettleFine marks a fine as paid, or as waived by staff
+func SettleFine(ctx context.Context, fineID int, waive bool, now time.Time) (data.Fine, error) {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	fine, ok := data.InMemoryDB.Fines[fineID]
+	if !ok {
+		return data.Fine{}, ErrFineNotFound
+	}
+	if !fine.Outstanding() {
+		return data.Fine{}, ErrFineSettled
+	}
+	before := fine
+	if waive {
+		fine.Waived = &now
+	} else {
+		fine.Paid = &now
+	}
+	data.InMemoryDB.Fines[fineID] = fine
+	bus.Publish(ctx, data.FineSettled{Before: before, Fine: fine})
+	return fine, nil
+}
+
+// MemberLoans returns a member's loans, newest first. Returned loans are
+// included only when history is set.
+func MemberLoans(memberID string, history bool) []data.Borrower {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	loans := []data.Borrower{}
+	for _, loan := range data.InMemoryDB.Borrowers {
+		if loan.MemberID == memberID && (history || loan.Active()) {
+			loans = append(loans, loan)
+		}
+	}
+	sort.Slice(loans, func(i, j int) bool { return loans[i].ID > loans[j].ID })
+	return loans
+}
+
+// MemberHolds returns a member's holds, newest first. Closed holds are
+// included only when history is set.
+func MemberHolds(memberID string, history bool) []data.Hold {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	holds := []data.Hold{}
+	for _, hold := range data.InMemoryDB.Holds {
+		if hold.MemberID == memberID && (history || hold.Open()) {
+			holds = append(holds, hold)
+		}
+	}
+	sort.Slice(holds, func(i, j int) bool { return holds[i].ID > holds[j].ID })
+	return holds
+}
+
+// MemberFines returns a member's fines, newest first
+func MemberFines(memberID string) []data.Fine {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	fines := []data.Fine{}
+	for _, fine := range data.InMemoryDB.Fines {
+		if fine.MemberID == memberID {
+			fines = append(fines, fine)
+		}
+	}
+	sort.Slice(fines, func(i, j int) bool { return fines[i].ID > fines[j].ID })
+	return fines
+}
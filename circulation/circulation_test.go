@@ -0,0 +1,108 @@
+package circulation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// refusedFor checks that err is a PolicyError naming rule
+func refusedFor(t *testing.T, err error, rule string) {
+	t.Helper()
+	var policy *PolicyError
+	if !errors.As(err, &policy) {
+		t.Fatalf("err = %v, want a policy error for %s", err, rule)
+	}
+	for _, v := range policy.Violations {
+		if v.Rule == rule {
+			return
+		}
+	}
+	t.Fatalf("violations = %+v, want %s", policy.Violations, rule)
+}
+
+func TestLostBookStaysOffTheShelfUntilFound(t *testing.T) {
+	resetDB()
+	ctx := context.Background()
+	for _, id := range []string{"001", "002", "003"} {
+		data.InMemoryDB.Members[id] = data.Member{ID: id, Category: data.CategoryAdult, Status: data.StatusActive}
+	}
+	data.InMemoryDB.Books[0] = data.Book{ID: 0, Title: "The Hobbit"}
+
+	loan, err := Checkout(ctx, "001", 0, day(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := MarkLost(ctx, loan.ID, day(5)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Checkout(ctx, "002", 0, day(6))
+	refusedFor(t, err, data.RuleBookLost)
+
+	hold, err := PlaceHold(ctx, "003", 0, day(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hold.Status != data.HoldWaiting {
+		t.Errorf("hold on a lost book is %s, want %s", hold.Status, data.HoldWaiting)
+	}
+
+	if _, err := Renew(ctx, loan.ID, day(7)); !errors.Is(err, ErrLoanLost) {
+		t.Errorf("Renew: err = %v, want %v", err, ErrLoanLost)
+	}
+	if _, _, err := Return(ctx, loan.ID, day(7)); !errors.Is(err, ErrLoanLost) {
+		t.Errorf("Return: err = %v, want %v", err, ErrLoanLost)
+	}
+	if _, _, err := MarkLost(ctx, loan.ID, day(7)); !errors.Is(err, ErrLoanLost) {
+		t.Errorf("MarkLost: err = %v, want %v", err, ErrLoanLost)
+	}
+
+	// Rebuilding from the log keeps the book lost
+	Rebuild()
+	_, err = Checkout(ctx, "002", 0, day(8))
+	refusedFor(t, err, data.RuleBookLost)
+
+	found, err := MarkFound(ctx, loan.ID, day(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Found == nil || found.Missing() {
+		t.Errorf("found loan = %+v, want it no longer missing", found)
+	}
+	if _, err := MarkFound(ctx, loan.ID, day(9)); !errors.Is(err, ErrLoanNotLost) {
+		t.Errorf("MarkFound again: err = %v, want %v", err, ErrLoanNotLost)
+	}
+	if got := data.InMemoryDB.Holds[hold.ID].Status; got != data.HoldReady {
+		t.Errorf("hold once the book is found is %s, want %s", got, data.HoldReady)
+	}
+
+	// The book is set aside for the member who was waiting
+	_, err = Checkout(ctx, "002", 0, day(10))
+	refusedFor(t, err, data.RuleReserved)
+	if _, err := Checkout(ctx, "003", 0, day(10)); err != nil {
+		t.Errorf("Checkout by the waiting member: %v", err)
+	}
+}
+
+func TestPenalty(t *testing.T) {
+	tests := []struct {
+		name string
+		now  int
+		want float64
+	}{
+		{"before the due date", -1, 0},
+		{"on the due date", 0, 0},
+		{"one day late", 1, data.FinePerDay},
+		{"ten days late", 10, 10 * data.FinePerDay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Penalty(day(0), day(tt.now)); got != tt.want {
+				t.Errorf("Penalty = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
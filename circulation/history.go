@@ -0,0 +1,130 @@
+package circulation
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// record appends an entry to the circulation log, attributed to the
+// caller carried by ctx, applies it to the current loans and returns the
+// loan as it stands afterwards.
+// The caller must hold the database lock.
+func record(ctx context.Context, entry data.CirculationEvent) data.Borrower {
+	entry.Seq = len(data.InMemoryDB.CirculationLog)
+	entry.Actor = bus.MetaFrom(ctx).Actor
+	if entry.Actor == "" {
+		entry.Actor = "system"
+	}
+	data.InMemoryDB.CirculationLog = append(data.InMemoryDB.CirculationLog, entry)
+	apply(data.InMemoryDB.Borrowers, entry)
+	if entry.Type == data.CirculationCheckedOut && entry.LoanID >= data.InMemoryDB.NextBorrowerID {
+		data.InMemoryDB.NextBorrowerID = entry.LoanID + 1
+	}
+	return data.InMemoryDB.Borrowers[entry.LoanID]
+}
+
+// apply projects a log entry onto loans
+func apply(loans map[int]data.Borrower, entry data.CirculationEvent) {
+	loan := loans[entry.LoanID]
+	at := entry.Time
+	switch entry.Type {
+	case data.CirculationCheckedOut:
+		loan = data.Borrower{
+			ID:       entry.LoanID,
+			MemberID: entry.MemberID,
+			BookID:   entry.BookID,
+			Borrowed: at,
+			DueDate:  *entry.DueDate,
+			Branch:   entry.Branch,
+		}
+	case data.CirculationRenewed:
+		loan.DueDate = *entry.DueDate
+		loan.Renewals++
+	case data.CirculationReturned:
+		loan.Returned = &at
+	case data.CirculationMarkedLost:
+		loan.Lost = &at
+	case data.CirculationFound:
+		loan.Found = &at
+	case data.CirculationDeleted:
+		delete(loans, entry.LoanID)
+		return
+	default:
+		return
+	}
+	loans[entry.LoanID] = loan
+}
+
+// Rebuild replaces the current loans with a fresh projection of the
+// circulation log and returns how many loans there are
+func Rebuild() int {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	loans := make(map[int]data.Borrower)
+	for _, entry := range data.InMemoryDB.CirculationLog {
+		apply(loans, entry)
+		if entry.Type == data.CirculationCheckedOut && entry.LoanID >= data.InMemoryDB.NextBorrowerID {
+			data.InMemoryDB.NextBorrowerID = entry.LoanID + 1
+		}
+	}
+	data.InMemoryDB.Borrowers = loans
+	return len(loans)
+}
+
+// ItemHistory replays every loan of a book from the circulation log,
+// newest first. A non-zero from or to keeps only loans that were out at
+// some time from from up to but not including to.
+func ItemHistory(bookID int, from, to time.Time) []data.LoanHistory {
+	return history(func(entry data.CirculationEvent) bool { return entry.BookID == bookID }, from, to)
+}
+
+// MemberHistory replays every loan of a member from the circulation log,
+// newest first, like ItemHistory. It includes loans of members who have
+// since been deleted.
+func MemberHistory(memberID string, from, to time.Time) []data.LoanHistory {
+	return history(func(entry data.CirculationEvent) bool { return entry.MemberID == memberID }, from, to)
+}
+
+func history(match func(data.CirculationEvent) bool, from, to time.Time) []data.LoanHistory {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	loans := make(map[int]data.Borrower)
+	histories := make(map[int]*data.LoanHistory)
+	for _, entry := range data.InMemoryDB.CirculationLog {
+		if !match(entry) {
+			continue
+		}
+		h, ok := histories[entry.LoanID]
+		if !ok {
+			h = &data.LoanHistory{Events: []data.CirculationEvent{}}
+			histories[entry.LoanID] = h
+		}
+		h.Events = append(h.Events, entry)
+		if entry.Type == data.CirculationDeleted {
+			at := entry.Time
+			h.Deleted = &at
+			continue
+		}
+		apply(loans, entry)
+	}
+
+	result := []data.LoanHistory{}
+	for id, h := range histories {
+		h.Borrower = loans[id]
+		if !from.IsZero() && h.Ended() != nil && h.Ended().Before(from) {
+			continue
+		}
+		if !to.IsZero() && !h.Borrowed.Before(to) {
+			continue
+		}
+		result = append(result, *h)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	return result
+}
@@ -0,0 +1,168 @@
+package circulation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jerrylovee2/gogo/data"
+)
+
+var epoch = time.Date(2025, time.March, 3, 10, 0, 0, 0, time.UTC)
+
+func day(n int) time.Time {
+	return epoch.AddDate(0, 0, n)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func checkedOut(loanID int, memberID string, bookID int, at, due time.Time) data.CirculationEvent {
+	return data.CirculationEvent{Type: data.CirculationCheckedOut, Time: at, LoanID: loanID, MemberID: memberID, BookID: bookID, Branch: "central", DueDate: &due}
+}
+
+func entry(kind string, loanID int, at time.Time) data.CirculationEvent {
+	return data.CirculationEvent{Type: kind, Time: at, LoanID: loanID}
+}
+
+func TestApply(t *testing.T) {
+	renewed := entry(data.CirculationRenewed, 1, day(10))
+	renewed.DueDate = ptr(day(31))
+	fined := entry(data.CirculationFineAssessed, 1, day(12))
+	fined.FineID, fined.Amount = ptr(0), 5
+
+	loan := data.Borrower{ID: 1, MemberID: "001", BookID: 7, Borrowed: day(0), DueDate: day(21), Branch: "central"}
+	with := func(change func(*data.Borrower)) data.Borrower {
+		l := loan
+		change(&l)
+		return l
+	}
+
+	tests := []struct {
+		name string
+		log  []data.CirculationEvent
+		want map[int]data.Borrower
+	}{
+		{
+			name: "checkout",
+			log:  []data.CirculationEvent{checkedOut(1, "001", 7, day(0), day(21))},
+			want: map[int]data.Borrower{1: loan},
+		},
+		{
+			name: "renewal moves the due date",
+			log:  []data.CirculationEvent{checkedOut(1, "001", 7, day(0), day(21)), renewed},
+			want: map[int]data.Borrower{1: with(func(l *data.Borrower) { l.DueDate, l.Renewals = day(31), 1 })},
+		},
+		{
+			name: "return",
+			log:  []data.CirculationEvent{checkedOut(1, "001", 7, day(0), day(21)), entry(data.CirculationReturned, 1, day(12)), fined},
+			want: map[int]data.Borrower{1: with(func(l *data.Borrower) { l.Returned = ptr(day(12)) })},
+		},
+		{
+			name: "lost",
+			log:  []data.CirculationEvent{checkedOut(1, "001", 7, day(0), day(21)), entry(data.CirculationMarkedLost, 1, day(30))},
+			want: map[int]data.Borrower{1: with(func(l *data.Borrower) { l.Lost = ptr(day(30)) })},
+		},
+		{
+			name: "lost and found",
+			log: []data.CirculationEvent{
+				checkedOut(1, "001", 7, day(0), day(21)),
+				entry(data.CirculationMarkedLost, 1, day(30)),
+				entry(data.CirculationFound, 1, day(40)),
+			},
+			want: map[int]data.Borrower{1: with(func(l *data.Borrower) { l.Lost, l.Found = ptr(day(30)), ptr(day(40)) })},
+		},
+		{
+			name: "deleted",
+			log: []data.CirculationEvent{
+				checkedOut(1, "001", 7, day(0), day(21)),
+				checkedOut(2, "002", 8, day(1), day(22)),
+				entry(data.CirculationDeleted, 1, day(2)),
+			},
+			want: map[int]data.Borrower{2: {ID: 2, MemberID: "002", BookID: 8, Borrowed: day(1), DueDate: day(22), Branch: "central"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loans := make(map[int]data.Borrower)
+			for _, e := range tt.log {
+				apply(loans, e)
+			}
+			if !reflect.DeepEqual(loans, tt.want) {
+				t.Errorf("loans = %+v, want %+v", loans, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoanState(t *testing.T) {
+	tests := []struct {
+		name                     string
+		loan                     data.Borrower
+		active, missing, overdue bool
+	}{
+		{"out", data.Borrower{DueDate: day(21)}, true, false, false},
+		{"overdue", data.Borrower{DueDate: day(-1)}, true, false, true},
+		{"returned", data.Borrower{DueDate: day(-1), Returned: ptr(day(0))}, false, false, false},
+		{"lost", data.Borrower{DueDate: day(-1), Lost: ptr(day(0))}, false, true, false},
+		{"found", data.Borrower{DueDate: day(-1), Lost: ptr(day(0)), Found: ptr(day(1))}, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.loan.Active(); got != tt.active {
+				t.Errorf("Active() = %v, want %v", got, tt.active)
+			}
+			if got := tt.loan.Missing(); got != tt.missing {
+				t.Errorf("Missing() = %v, want %v", got, tt.missing)
+			}
+			if got := tt.loan.Overdue(epoch); got != tt.overdue {
+				t.Errorf("Overdue() = %v, want %v", got, tt.overdue)
+			}
+		})
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	resetDB()
+	data.InMemoryDB.CirculationLog = []data.CirculationEvent{
+		checkedOut(3, "001", 7, day(0), day(21)),
+		checkedOut(5, "002", 8, day(1), day(22)),
+		entry(data.CirculationMarkedLost, 3, day(30)),
+		entry(data.CirculationReturned, 5, day(10)),
+		checkedOut(6, "001", 9, day(11), day(32)),
+		entry(data.CirculationDeleted, 6, day(12)),
+	}
+	data.InMemoryDB.Borrowers[99] = data.Borrower{ID: 99}
+
+	if n := Rebuild(); n != 2 {
+		t.Errorf("Rebuild() = %d, want 2", n)
+	}
+	want := map[int]data.Borrower{
+		3: {ID: 3, MemberID: "001", BookID: 7, Borrowed: day(0), DueDate: day(21), Branch: "central", Lost: ptr(day(30))},
+		5: {ID: 5, MemberID: "002", BookID: 8, Borrowed: day(1), DueDate: day(22), Branch: "central", Returned: ptr(day(10))},
+	}
+	if !reflect.DeepEqual(data.InMemoryDB.Borrowers, want) {
+		t.Errorf("Borrowers = %+v, want %+v", data.InMemoryDB.Borrowers, want)
+	}
+	// A deleted loan's ID is not handed out again
+	if data.InMemoryDB.NextBorrowerID != 7 {
+		t.Errorf("NextBorrowerID = %d, want 7", data.InMemoryDB.NextBorrowerID)
+	}
+}
+
+// resetDB empties the tables the circulation package uses
+func resetDB() {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	data.InMemoryDB.Books = make(map[int]data.Book)
+	data.InMemoryDB.Members = make(map[string]data.Member)
+	data.InMemoryDB.Borrowers = make(map[int]data.Borrower)
+	data.InMemoryDB.CirculationLog = nil
+	data.InMemoryDB.Holds = make(map[int]data.Hold)
+	data.InMemoryDB.Fines = make(map[int]data.Fine)
+	data.InMemoryDB.NextBorrowerID = 0
+	data.InMemoryDB.NextHoldID = 0
+	data.InMemoryDB.NextFineID = 0
+}
@@ -0,0 +1,84 @@
+package circulation
+
+import (
+	"time"
+
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// GenerateReport summarises circulation from from up to but not including
+// to and stores the report. Generating a report for the same period again
+// replaces the earlier one.
+func GenerateReport(from, to, now time.Time) data.Report {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	report := data.Report{ID: data.InMemoryDB.NextReportID, From: from, To: to, Generated: now}
+	for id, existing := range data.InMemoryDB.Reports {
+		if existing.From.Equal(from) && existing.To.Equal(to) {
+			report.ID = id
+		}
+	}
+	within := func(t *time.Time) bool {
+		return t != nil && !t.Before(from) && t.Before(to)
+	}
+
+	for _, loan := range data.InMemoryDB.Borrowers {
+		if within(&loan.Borrowed) {
+			report.Checkouts++
+		}
+		if within(loan.Returned) {
+			report.Returns++
+			if loan.Returned.After(loan.DueDate) {
+				report.LateReturns++
+			}
+		}
+		if loan.Borrowed.Before(to) && (loan.Ended() == nil || !loan.Ended().Before(to)) {
+			report.ActiveLoans++
+			if to.After(loan.DueDate) {
+				report.OverdueLoans++
+			}
+		}
+	}
+	for _, hold := range data.InMemoryDB.Holds {
+		if within(&hold.Placed) {
+			report.HoldsPlaced++
+		}
+		if within(hold.ReadyAt) {
+			report.HoldsReady++
+		}
+		if hold.Status == data.HoldExpired && within(hold.ExpiresAt) {
+			report.HoldsExpired++
+		}
+	}
+	for _, fine := range data.InMemoryDB.Fines {
+		if within(&fine.Assessed) {
+			report.FinesAssessed += fine.Amount
+		}
+		if within(fine.Paid) {
+			report.FinesPaid += fine.Amount
+		}
+		if within(fine.Waived) {
+			report.FinesWaived += fine.Amount
+		}
+		if fine.Assessed.Before(to) && !settledBefore(fine.Paid, to) && !settledBefore(fine.Waived, to) {
+			report.FinesOutstanding += fine.Amount
+		}
+	}
+	for _, member := range data.InMemoryDB.Members {
+		joined := member.JoinDate.Time
+		if within(&joined) {
+			report.NewMembers++
+		}
+	}
+
+	data.InMemoryDB.Reports[report.ID] = report
+	if report.ID == data.InMemoryDB.NextReportID {
+		data.InMemoryDB.NextReportID++
+	}
+	return report
+}
+
+func settledBefore(settled *time.Time, t time.Time) bool {
+	return settled != nil && settled.Before(t)
+}
@@ -0,0 +1,179 @@
+package circulation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// The helpers in this file expect the caller to hold the database lock.
+
+// category returns the member's membership terms, treating unknown
+// categories as adult memberships.
+func category(member data.Member) data.MembershipCategory {
+	if terms, ok := data.MembershipCategories[member.Category]; ok {
+		return terms
+	}
+	return data.MembershipCategories[data.CategoryAdult]
+}
+
+// account works out the member's effective status. Reasons lists every
+// rule that currently stops the member from borrowing, most severe first.
+func account(member data.Member, now time.Time) data.AccountStatus {
+	terms := category(member)
+	status := data.AccountStatus{
+		MemberID: member.ID,
+		Status:   data.StatusActive,
+		MaxLoans: terms.MaxLoans,
+		MaxHolds: terms.MaxHolds,
+	}
+
+	for _, loan := range data.InMemoryDB.Borrowers {
+		if loan.MemberID != member.ID || !loan.Active() {
+			continue
+		}
+		status.ActiveLoans++
+		if loan.Overdue(now) {
+			status.OverdueLoans++
+			status.FineBalance += Penalty(loan.DueDate, now)
+		}
+	}
+	for _, fine := range data.InMemoryDB.Fines {
+		if fine.MemberID == member.ID && fine.Outstanding() {
+			status.FineBalance += fine.Amount
+		}
+	}
+	for _, hold := range data.InMemoryDB.Holds {
+		if hold.MemberID == member.ID && hold.Open() {
+			status.OpenHolds++
+		}
+	}
+
+	today := data.NewDate(now)
+	add := func(accountStatus, rule, message string) {
+		if len(status.Reasons) == 0 {
+			status.Status = accountStatus
+		}
+		status.Reasons = append(status.Reasons, data.RuleViolation{Rule: rule, Message: message})
+	}
+
+	switch member.Status {
+	case data.StatusBlocked:
+		add(data.StatusBlocked, data.RuleBlocked, withReason("Account is blocked", member.StatusReason))
+	case data.StatusSuspended:
+		if member.SuspendedUntil.IsZero() {
+			add(data.StatusSuspended, data.RuleSuspended, withReason("Account is suspended", member.StatusReason))
+		} else if !member.SuspendedUntil.Before(today.Time) {
+			add(data.StatusSuspended, data.RuleSuspended,
+				withReason("Account is suspended until "+member.SuspendedUntil.Format(data.DateLayout), member.StatusReason))
+		}
+	}
+	if status.FineBalance >= data.FineBlockThreshold {
+		add(data.StatusBlocked, data.RuleFineThreshold,
+			fmt.Sprintf("Fines of %.2f reach the limit of %.2f", status.FineBalance, data.FineBlockThreshold))
+	}
+	if status.OverdueLoans >= data.OverdueBlockCount {
+		add(data.StatusBlocked, data.RuleOverdueLimit,
+			fmt.Sprintf("%d overdue loans reach the limit of %d", status.OverdueLoans, data.OverdueBlockCount))
+	}
+	if member.Expired(today) {
+		add(data.StatusExpired, data.RuleMembershipExpired,
+			"Membership expired on "+member.ExpiryDate.Format(data.DateLayout))
+	}
+
+	return status
+}
+
+func withReason(message, reason string) string {
+	if reason == "" {
+		return message
+	}
+	return message + ": " + reason
+}
+
+// activeLoan finds the loan the book is currently out on
+func activeLoan(bookID int) (data.Borrower, bool) {
+	for _, loan := range data.InMemoryDB.Borrowers {
+		if loan.BookID == bookID && loan.Active() {
+			return loan, true
+		}
+	}
+	return data.Borrower{}, false
+}
+
+// lostLoan finds the loan the book was lost on, while it is still missing
+func lostLoan(bookID int) (data.Borrower, bool) {
+	for _, loan := range data.InMemoryDB.Borrowers {
+		if loan.BookID == bookID && loan.Missing() {
+			return loan, true
+		}
+	}
+	return data.Borrower{}, false
+}
+
+// readyHold finds the hold the book is waiting on the pickup shelf for
+func readyHold(bookID int) (data.Hold, bool) {
+	for _, hold := range data.InMemoryDB.Holds {
+		if hold.BookID == bookID && hold.Status == data.HoldReady {
+			return hold, true
+		}
+	}
+	return data.Hold{}, false
+}
+
+// promoteHold makes the oldest waiting hold on a book ready for pickup,
+// provided the book is on the shelf, neither out nor lost, and not already
+// set aside. It returns the promoted hold, if any.
+func promoteHold(ctx context.Context, bookID int, now time.Time) *data.Hold {
+	if _, ok := activeLoan(bookID); ok {
+		return nil
+	}
+	if _, ok := lostLoan(bookID); ok {
+		return nil
+	}
+	if _, ok := readyHold(bookID); ok {
+		return nil
+	}
+
+	var waiting []data.Hold
+	for _, hold := range data.InMemoryDB.Holds {
+		if hold.BookID == bookID && hold.Status == data.HoldWaiting {
+			waiting = append(waiting, hold)
+		}
+	}
+	if len(waiting) == 0 {
+		return nil
+	}
+	sort.Slice(waiting, func(i, j int) bool { return waiting[i].ID < waiting[j].ID })
+
+	hold := waiting[0]
+	expires := now.AddDate(0, 0, data.HoldPickupDays)
+	hold.Status = data.HoldReady
+	hold.ReadyAt = &now
+	hold.ExpiresAt = &expires
+	data.InMemoryDB.Holds[hold.ID] = hold
+	bus.Publish(ctx, data.HoldReadyForPickup{Hold: hold})
+	return &hold
+}
+
+// expireHolds closes ready holds past their pickup date and offers each
+// book to the next member in the queue.
+func expireHolds(ctx context.Context, now time.Time) []data.Hold {
+	var expired []data.Hold
+	for id, hold := range data.InMemoryDB.Holds {
+		if hold.Status == data.HoldReady && hold.ExpiresAt != nil && now.After(*hold.ExpiresAt) {
+			hold.Status = data.HoldExpired
+			data.InMemoryDB.Holds[id] = hold
+			bus.Publish(ctx, data.HoldPickupExpired{Hold: hold})
+			expired = append(expired, hold)
+		}
+	}
+	for _, hold := range expired {
+		promoteHold(ctx, hold.BookID, now)
+	}
+	return expired
+}
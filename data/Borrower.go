@@ -2,16 +2,51 @@ package data
 
 import "time"
 
+// Borrower is a loan of a book to a member, as projected from the
+// circulation log. Returned and lost loans are kept as circulation
+// history.
 type Borrower struct {
-	ID       int       `json:"id"`
-	MemberID string    `json:"member_id"`
-	BookID   int       `json:"book_id"`
-	Borrowed time.Time `json:"borrowed"`
+	ID       int        `json:"id"`
+	MemberID string     `json:"member_id"`
+	BookID   int        `json:"book_id"`
+	Borrowed time.Time  `json:"borrowed"`
+	DueDate  time.Time  `json:"due_date"`
+	Renewals int        `json:"renewals"`
+	Returned *time.Time `json:"returned,omitempty"`
+	Lost     *time.Time `json:"lost,omitempty"`
+	// Found is when a book marked lost turned up again
+	Found *time.Time `json:"found,omitempty"`
+	// Branch is the book's branch at checkout
+	Branch string `json:"branch,omitempty"`
 }
 
 type BorrowerInfo struct {
 	Borrower
-	DueDate   time.Time `json:"due_date"`
-	Penalty   float64   `json:"penalty_per_day"`
-	Penalties float64   `json:"penalties"`
+	Penalty   float64 `json:"penalty_per_day"`
+	Penalties float64 `json:"penalties"`
+}
+
+// Active reports whether the book is still out on this loan
+func (b Borrower) Active() bool {
+	return b.Returned == nil && b.Lost == nil
+}
+
+// Ended is when the book was returned or declared lost, nil while it is
+// still out
+func (b Borrower) Ended() *time.Time {
+	if b.Returned != nil {
+		return b.Returned
+	}
+	return b.Lost
+}
+
+// Missing reports whether the loan's book was marked lost and has not
+// been found since
+func (b Borrower) Missing() bool {
+	return b.Lost != nil && b.Found == nil
+}
+
+// Overdue reports whether the loan is still out past its due date
+func (b Borrower) Overdue(now time.Time) bool {
+	return b.Active() && now.After(b.DueDate)
 }
@@ -0,0 +1,23 @@
+package data
+
+import "time"
+
+// APIKey lets a machine client call the staff API within its scopes.
+// Only the hash of the key is kept; Prefix identifies it in listings.
+// The usage fields are tracked outside the database and filled in when a
+// key is shown.
+type APIKey struct {
+	ID           int        `json:"id"`
+	Name         string     `json:"name"`
+	Prefix       string     `json:"prefix"`
+	Scopes       []string   `json:"scopes"`
+	AllowedIPs   []string   `json:"allowed_ips"`
+	CreatedBy    string     `json:"created_by"`
+	Created      time.Time  `json:"created"`
+	Rotated      *time.Time `json:"rotated,omitempty"`
+	Revoked      *time.Time `json:"revoked,omitempty"`
+	LastUsed     *time.Time `json:"last_used,omitempty"`
+	LastUsedIP   string     `json:"last_used_ip,omitempty"`
+	RequestCount int        `json:"request_count"`
+	Hash         string     `json:"-"`
+}
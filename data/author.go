@@ -0,0 +1,47 @@
+package data
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Author is the authority record for a person credited on books
+type Author struct {
+	ID             int               `json:"id"`
+	Name           string            `json:"name"`
+	AlternateNames []string          `json:"alternate_names,omitempty"`
+	BirthYear      int               `json:"birth_year,omitempty"`
+	DeathYear      int               `json:"death_year,omitempty"`
+	Identifiers    map[string]string `json:"identifiers,omitempty"`
+}
+
+// AuthorDetail is an author together with the books credited to them
+type AuthorDetail struct {
+	Author
+	Works []Book `json:"works"`
+}
+
+// NameKeys returns the normalized forms of the canonical and alternate names
+func (a Author) NameKeys() []string {
+	var keys []string
+	for _, name := range append([]string{a.Name}, a.AlternateNames...) {
+		if key := NormalizeAuthorName(name); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// NormalizeAuthorName reduces a personal name to a comparison key, so that
+// "J.R.R. Tolkien" and "Tolkien, J. R. R." produce the same key. Inverted
+// names are put back in direct order and anything after a second comma
+// (dates, titles) is dropped.
+func NormalizeAuthorName(name string) string {
+	if parts := strings.SplitN(name, ",", 3); len(parts) > 1 {
+		name = parts[1] + " " + parts[0]
+	}
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
@@ -1,10 +1,30 @@
 package data
 
 type Book struct {
-	ID       int    `json:"id"`
-	UniqueID string `json:"unique_id"`
-	Title    string `json:"title"`
-	Author   string `json:"author"`
-	Genre    string `json:"genre"`
-	Year     int    `json:"year"`
+	ID        int    `json:"id"`
+	UniqueID  string `json:"unique_id"`
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+	AuthorIDs []int  `json:"author_ids,omitempty"`
+	Genre     string `json:"genre"`
+	GenreIDs  []int  `json:"genre_ids,omitempty"`
+	Year      int    `json:"year"`
+
+	CallNumber       string `json:"call_number,omitempty"`
+	CallNumberScheme string `json:"call_number_scheme,omitempty"`
+
+	// Branch is the library branch that holds the book
+	Branch string `json:"branch,omitempty"`
+
+	Cover *Cover `json:"cover,omitempty"`
+
+	// DigitalCopies are the e-book files patrons can download, offered as
+	// acquisition links in the OPDS feeds
+	DigitalCopies []DigitalCopy `json:"digital_copies,omitempty"`
+}
+
+// DigitalCopy is a downloadable edition of a book, such as an EPUB or PDF
+type DigitalCopy struct {
+	URL       string `json:"url"`
+	MediaType string `json:"media_type"`
 }
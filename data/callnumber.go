@@ -0,0 +1,163 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Supported call number classification schemes
+const (
+	SchemeDewey = "dewey"
+	SchemeLC    = "lc"
+)
+
+var (
+	deweyClassPattern = regexp.MustCompile(`^(\d{3})(?:\.(\d+))?$`)
+	lcClassPattern    = regexp.MustCompile(`^([A-Z]{1,3})(\d{1,4})(?:\.(\d+))?$`)
+	cutterPattern     = regexp.MustCompile(`\.?([A-Z]+)(\d+)([a-z]*)`)
+	cuttersPattern    = regexp.MustCompile(`^(?:\.?[A-Z]+\d+[a-z]*)+$`)
+	yearPattern       = regexp.MustCompile(`^\d{4}[a-z]?$`)
+	enumPattern       = regexp.MustCompile(`^([a-z]+)\.(\d+)$`)
+	lcSplitPattern    = regexp.MustCompile(`(?i)^([A-Z]{1,3}\s?\d{1,4}(?:\.\d+)?)\s*(.*)$`)
+)
+
+// CallNumber is a parsed shelf call number. Call numbers sort in shelf
+// order with Compare, which treats class numbers and cutters as decimals
+// rather than comparing the raw strings.
+type CallNumber struct {
+	Scheme     string `json:"scheme"`
+	Normalized string `json:"normalized"`
+	key        []string
+}
+
+// ParseCallNumber parses and validates a call number. An empty scheme is
+// detected from the first character: digits for Dewey, letters for LC.
+func ParseCallNumber(scheme, raw string) (CallNumber, error) {
+	raw = strings.Join(strings.Fields(raw), " ")
+	if raw == "" {
+		return CallNumber{}, errors.New("Call number is empty")
+	}
+	if scheme == "" {
+		if isDigit(raw[0]) {
+			scheme = SchemeDewey
+		} else {
+			scheme = SchemeLC
+		}
+	}
+
+	var class, rest string
+	var key []string
+	switch scheme {
+	case SchemeDewey:
+		class, rest, _ = strings.Cut(raw, " ")
+		m := deweyClassPattern.FindStringSubmatch(class)
+		if m == nil {
+			return CallNumber{}, fmt.Errorf("Invalid Dewey class number %q", class)
+		}
+		key = []string{scheme, m[1] + "\x00" + m[2]}
+	case SchemeLC:
+		m := lcSplitPattern.FindStringSubmatch(raw)
+		if m == nil {
+			return CallNumber{}, fmt.Errorf("Invalid Library of Congress call number %q", raw)
+		}
+		class, rest = strings.ToUpper(strings.ReplaceAll(m[1], " ", "")), m[2]
+		c := lcClassPattern.FindStringSubmatch(class)
+		if c == nil {
+			return CallNumber{}, fmt.Errorf("Invalid Library of Congress class %q", class)
+		}
+		key = []string{scheme, c[1], fmt.Sprintf("%05s\x00%s", c[2], c[3])}
+	default:
+		return CallNumber{}, fmt.Errorf("Unknown call number scheme %q", scheme)
+	}
+
+	normalized := class
+	for _, token := range strings.Fields(rest) {
+		segments, part, err := callNumberSegments(token)
+		if err != nil {
+			return CallNumber{}, err
+		}
+		key = append(key, segments...)
+		if !strings.HasPrefix(part, ".") {
+			normalized += " "
+		}
+		normalized += part
+	}
+
+	return CallNumber{Scheme: scheme, Normalized: normalized, key: key}, nil
+}
+
+// callNumberSegments turns one token following the class number into sort
+// key segments. Sub-parts are joined with NUL so shorter values file first.
+func callNumberSegments(token string) ([]string, string, error) {
+	switch {
+	case yearPattern.MatchString(token):
+		return []string{token}, token, nil
+	case enumPattern.MatchString(token):
+		m := enumPattern.FindStringSubmatch(token)
+		return []string{fmt.Sprintf("%s\x00%08s", m[1], m[2])}, m[1] + "." + m[2], nil
+	}
+
+	// The first letter of a cutter is always upper case; the trailing
+	// work mark is lower case.
+	cutters := strings.TrimPrefix(token, ".")
+	if cutters != "" {
+		cutters = strings.ToUpper(cutters[:1]) + cutters[1:]
+	}
+	if !cuttersPattern.MatchString(cutters) {
+		return nil, "", fmt.Errorf("Invalid call number part %q", token)
+	}
+	if strings.HasPrefix(token, ".") {
+		cutters = "." + cutters
+	}
+	var segments []string
+	for _, m := range cutterPattern.FindAllStringSubmatch(cutters, -1) {
+		segments = append(segments, m[1]+"\x00"+m[2]+"\x00"+m[3])
+	}
+	return segments, cutters, nil
+}
+
+// Compare returns -1, 0 or 1 depending on whether c files before, with or
+// after other on the shelf.
+func (c CallNumber) Compare(other CallNumber) int {
+	for i := 0; i < len(c.key) && i < len(other.key); i++ {
+		if c.key[i] != other.key[i] {
+			if c.key[i] < other.key[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(c.key) < len(other.key):
+		return -1
+	case len(c.key) > len(other.key):
+		return 1
+	}
+	return 0
+}
+
+// HasPrefix reports whether c falls within the span of prefix, e.g.
+// "823.912 T649h" is within "823.9" and "PR6039.O32 L6" within "PR6039".
+func (c CallNumber) HasPrefix(prefix CallNumber) bool {
+	if c.Scheme != prefix.Scheme || !strings.HasPrefix(c.Normalized, prefix.Normalized) {
+		return false
+	}
+	// A whole class number does not span longer whole numbers: PR60 is
+	// not a prefix of PR6039, while 823.9 is a prefix of 823.912.
+	rest := c.Normalized[len(prefix.Normalized):]
+	last := prefix.Normalized[len(prefix.Normalized)-1]
+	return rest == "" || !isDigit(rest[0]) || !isDigit(last) || strings.Contains(prefix.Normalized, ".")
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// ShelfView is the virtual shelf around a call number
+type ShelfView struct {
+	CallNumber CallNumber `json:"call_number"`
+	Before     []Book     `json:"before"`
+	After      []Book     `json:"after"`
+}
@@ -0,0 +1,41 @@
+package data
+
+import "time"
+
+// Circulation log entry types
+const (
+	CirculationCheckedOut   = "checked_out"
+	CirculationRenewed      = "renewed"
+	CirculationReturned     = "returned"
+	CirculationMarkedLost   = "marked_lost"
+	CirculationFound        = "found"
+	CirculationFineAssessed = "fine_assessed"
+	// CirculationDeleted removes a loan from the current loans. The
+	// loan's entries stay in the log.
+	CirculationDeleted = "deleted"
+)
+
+// CirculationEvent is an entry in the append-only circulation log.
+// DueDate is set for checkouts and renewals, FineID and Amount for fines.
+// Actor is who made the change as kind:id, or system.
+type CirculationEvent struct {
+	Seq      int        `json:"seq"`
+	Type     string     `json:"type"`
+	Time     time.Time  `json:"time"`
+	LoanID   int        `json:"loan_id"`
+	MemberID string     `json:"member_id"`
+	BookID   int        `json:"book_id"`
+	Branch   string     `json:"branch,omitempty"`
+	DueDate  *time.Time `json:"due_date,omitempty"`
+	FineID   *int       `json:"fine_id,omitempty"`
+	Amount   float64    `json:"amount,omitempty"`
+	Actor    string     `json:"actor"`
+}
+
+// LoanHistory is a loan replayed from the circulation log with every
+// entry about it, including loans whose record has since been deleted
+type LoanHistory struct {
+	Borrower
+	Deleted *time.Time         `json:"deleted,omitempty"`
+	Events  []CirculationEvent `json:"events"`
+}
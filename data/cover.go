@@ -0,0 +1,9 @@
+package data
+
+// Cover describes the uploaded cover image of a book. URLs maps each
+// size ("original", "small", "medium", "large") to where it is served.
+type Cover struct {
+	Version     string            `json:"version"`
+	ContentType string            `json:"content_type"`
+	URLs        map[string]string `json:"urls"`
+}
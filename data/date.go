@@ -0,0 +1,45 @@
+package data
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DateLayout is the JSON format of a Date
+const DateLayout = "2006-01-02"
+
+// Date is a calendar date without a time of day, encoded as "2006-01-02"
+type Date struct {
+	time.Time
+}
+
+// NewDate truncates t to its calendar date
+func NewDate(t time.Time) Date {
+	return Date{time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+// Today returns the current date
+func Today() Date {
+	return NewDate(time.Now())
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.Format(DateLayout))
+}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil || s == "" {
+		*d = Date{}
+		return err
+	}
+	t, err := time.Parse(DateLayout, s)
+	if err != nil {
+		return err
+	}
+	*d = Date{t}
+	return nil
+}
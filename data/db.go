@@ -7,11 +7,49 @@ import (
 // InMemoryDB simulates an in-memory database
 var InMemoryDB = struct {
 	Books          map[int]Book
+	BookVersions   map[int][]Version[Book]
+	TrashedBooks   map[int]Trashed[Book]
 	Members        map[string]Member
+	MemberVersions map[string][]Version[Member]
+	TrashedMembers map[string]Trashed[Member]
+	MemberEmails   map[string]string
 	Borrowers      map[int]Borrower
-	Indices        map[string]map[string][]int
-	NextBookID     int
-	NextMemberID   int
-	NextBorrowerID int
+	// CirculationLog is every checkout, renewal, return, loss, fine and
+	// deletion of a loan, oldest first. Borrowers is projected from it.
+	CirculationLog []CirculationEvent
+	Holds          map[int]Hold
+	Fines          map[int]Fine
+	Notifications  map[int]Notification
+	// NoticeKeys records which notices have been queued, so each is
+	// queued once
+	NoticeKeys         map[string]int
+	NotificationPrefs  map[string]NotificationPreferences
+	Reports            map[int]Report
+	Webhooks           map[int]Webhook
+	WebhookDeliveries  map[int]WebhookDelivery
+	Sessions           map[string]Session
+	Staff              map[int]StaffUser
+	RefreshTokens      map[string]RefreshToken
+	OIDCLogins         map[string]OIDCLogin
+	APIKeys            map[int]APIKey
+	APIKeyHashes       map[string]int
+	Authors            map[int]Author
+	AuthorNames        map[string]int
+	Genres             map[int]Genre
+	GenreNames         map[string]int
+	Indices            map[string]map[string][]int
+	NextBookID         int
+	NextMemberID       int
+	NextBorrowerID     int
+	NextHoldID         int
+	NextFineID         int
+	NextNotificationID int
+	NextReportID       int
+	NextWebhookID      int
+	NextDeliveryID     int
+	NextStaffID        int
+	NextAPIKeyID       int
+	NextAuthorID       int
+	NextGenreID        int
 	sync.RWMutex
-}{Books: make(map[int]Book), Members: make(map[string]Member), Borrowers: make(map[int]Borrower), Indices: make(map[string]map[string][]int)}
+}{Books: make(map[int]Book), BookVersions: make(map[int][]Version[Book]), TrashedBooks: make(map[int]Trashed[Book]), Members: make(map[string]Member), MemberVersions: make(map[string][]Version[Member]), TrashedMembers: make(map[string]Trashed[Member]), MemberEmails: make(map[string]string), Borrowers: make(map[int]Borrower), Holds: make(map[int]Hold), Fines: make(map[int]Fine), Notifications: make(map[int]Notification), NoticeKeys: make(map[string]int), NotificationPrefs: make(map[string]NotificationPreferences), Reports: make(map[int]Report), Webhooks: make(map[int]Webhook), WebhookDeliveries: make(map[int]WebhookDelivery), Sessions: make(map[string]Session), Staff: make(map[int]StaffUser), RefreshTokens: make(map[string]RefreshToken), OIDCLogins: make(map[string]OIDCLogin), APIKeys: make(map[int]APIKey), APIKeyHashes: make(map[string]int), Authors: make(map[int]Author), AuthorNames: make(map[string]int), Genres: make(map[int]Genre), GenreNames: make(map[string]int), Indices: make(map[string]map[string][]int)}
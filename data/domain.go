@@ -0,0 +1,146 @@
+package data
+
+import "strconv"
+
+// Domain events are published on the event bus as changes are stored.
+// Those with an Event* type in EventTypes are also sent to webhooks and
+// event stream clients.
+
+// BookCreated is a book added to the catalog
+type BookCreated struct{ Book Book }
+
+// BookUpdated is a book's details replaced
+type BookUpdated struct{ Before, After Book }
+
+// BookReverted is a book's details replaced by an earlier version
+type BookReverted struct{ Before, After Book }
+
+// BookDeleted is a book moved to the trash
+type BookDeleted struct{ Book Book }
+
+// BookRestored is a book brought back from the trash
+type BookRestored struct{ Book Book }
+
+func (BookCreated) EventType() string  { return EventBookCreated }
+func (BookUpdated) EventType() string  { return "book.updated" }
+func (BookReverted) EventType() string { return "book.reverted" }
+func (BookDeleted) EventType() string  { return EventBookDeleted }
+func (BookRestored) EventType() string { return "book.restored" }
+
+func (e BookCreated) Aggregate() string  { return bookAggregate(e.Book.ID) }
+func (e BookUpdated) Aggregate() string  { return bookAggregate(e.After.ID) }
+func (e BookReverted) Aggregate() string { return bookAggregate(e.After.ID) }
+func (e BookDeleted) Aggregate() string  { return bookAggregate(e.Book.ID) }
+func (e BookRestored) Aggregate() string { return bookAggregate(e.Book.ID) }
+
+func bookAggregate(id int) string { return "book:" + strconv.Itoa(id) }
+
+// MemberCreated is a member joining
+type MemberCreated struct{ Member Member }
+
+// MemberUpdated is a member's details replaced
+type MemberUpdated struct{ Before, After Member }
+
+// MemberReverted is a member's details replaced by an earlier version
+type MemberReverted struct{ Before, After Member }
+
+// MemberStatusChanged is staff suspending, blocking or reinstating a
+// member
+type MemberStatusChanged struct{ Before, After Member }
+
+// MemberDeleted is a member moved to the trash
+type MemberDeleted struct{ Member Member }
+
+// MemberRestored is a member brought back from the trash
+type MemberRestored struct{ Member Member }
+
+func (MemberCreated) EventType() string       { return EventMemberCreated }
+func (MemberUpdated) EventType() string       { return "member.updated" }
+func (MemberReverted) EventType() string      { return "member.reverted" }
+func (MemberStatusChanged) EventType() string { return "member.status_changed" }
+func (MemberDeleted) EventType() string       { return "member.deleted" }
+func (MemberRestored) EventType() string      { return "member.restored" }
+
+func (e MemberCreated) Aggregate() string       { return "member:" + e.Member.ID }
+func (e MemberUpdated) Aggregate() string       { return "member:" + e.After.ID }
+func (e MemberReverted) Aggregate() string      { return "member:" + e.After.ID }
+func (e MemberStatusChanged) Aggregate() string { return "member:" + e.After.ID }
+func (e MemberDeleted) Aggregate() string       { return "member:" + e.Member.ID }
+func (e MemberRestored) Aggregate() string      { return "member:" + e.Member.ID }
+
+// LoanCheckedOut is a book lent to a member
+type LoanCheckedOut struct{ Loan Borrower }
+
+// LoanRenewed is a loan's due date extended
+type LoanRenewed struct{ Before, Loan Borrower }
+
+// LoanReturned is a book checked back in
+type LoanReturned struct{ Before, Loan Borrower }
+
+// LoanMarkedLost is a loan closed because its book will not come back
+type LoanMarkedLost struct{ Before, Loan Borrower }
+
+// LoanFound is a book marked lost turning up again
+type LoanFound struct{ Before, Loan Borrower }
+
+// LoanDeleted is a loan removed from the current loans
+type LoanDeleted struct{ Loan Borrower }
+
+func (LoanCheckedOut) EventType() string { return EventLoanCheckedOut }
+func (LoanRenewed) EventType() string    { return "loan.renewed" }
+func (LoanReturned) EventType() string   { return EventLoanReturned }
+func (LoanMarkedLost) EventType() string { return "loan.lost" }
+func (LoanFound) EventType() string      { return "loan.found" }
+func (LoanDeleted) EventType() string    { return "loan.deleted" }
+
+func (e LoanCheckedOut) Aggregate() string { return loanAggregate(e.Loan.ID) }
+func (e LoanRenewed) Aggregate() string    { return loanAggregate(e.Loan.ID) }
+func (e LoanReturned) Aggregate() string   { return loanAggregate(e.Loan.ID) }
+func (e LoanMarkedLost) Aggregate() string { return loanAggregate(e.Loan.ID) }
+func (e LoanFound) Aggregate() string      { return loanAggregate(e.Loan.ID) }
+func (e LoanDeleted) Aggregate() string    { return loanAggregate(e.Loan.ID) }
+
+func loanAggregate(id int) string { return "loan:" + strconv.Itoa(id) }
+
+// HoldPlaced is a member queueing for a book
+type HoldPlaced struct{ Hold Hold }
+
+// HoldReadyForPickup is a hold's book set aside for pickup
+type HoldReadyForPickup struct{ Hold Hold }
+
+// HoldFilled is a hold's book checked out to its member
+type HoldFilled struct{ Hold Hold }
+
+// HoldWithdrawn is a hold cancelled by its member or staff
+type HoldWithdrawn struct{ Before, Hold Hold }
+
+// HoldPickupExpired is a ready hold not picked up in time
+type HoldPickupExpired struct{ Hold Hold }
+
+func (HoldPlaced) EventType() string         { return "hold.placed" }
+func (HoldReadyForPickup) EventType() string { return EventHoldReady }
+func (HoldFilled) EventType() string         { return "hold.fulfilled" }
+func (HoldWithdrawn) EventType() string      { return "hold.cancelled" }
+func (HoldPickupExpired) EventType() string  { return "hold.expired" }
+
+func (e HoldPlaced) Aggregate() string         { return holdAggregate(e.Hold.ID) }
+func (e HoldReadyForPickup) Aggregate() string { return holdAggregate(e.Hold.ID) }
+func (e HoldFilled) Aggregate() string         { return holdAggregate(e.Hold.ID) }
+func (e HoldWithdrawn) Aggregate() string      { return holdAggregate(e.Hold.ID) }
+func (e HoldPickupExpired) Aggregate() string  { return holdAggregate(e.Hold.ID) }
+
+func holdAggregate(id int) string { return "hold:" + strconv.Itoa(id) }
+
+// FineAssessed is a member charged for a late return
+type FineAssessed struct{ Fine Fine }
+
+// FineSettled is a fine paid, or waived by staff
+type FineSettled struct{ Before, Fine Fine }
+
+func (FineAssessed) EventType() string { return "fine.assessed" }
+func (FineSettled) EventType() string  { return "fine.settled" }
+
+func (e FineAssessed) Aggregate() string { return fineAggregate(e.Fine.ID) }
+func (e FineSettled) Aggregate() string  { return fineAggregate(e.Fine.ID) }
+
+func fineAggregate(id int) string { return "fine:" + strconv.Itoa(id) }
@@ -0,0 +1,20 @@
+package data
+
+import "time"
+
+// Fine is a charge against a member, such as for returning a book late
+type Fine struct {
+	ID         int        `json:"id"`
+	MemberID   string     `json:"member_id"`
+	BorrowerID int        `json:"borrower_id"`
+	Amount     float64    `json:"amount"`
+	Reason     string     `json:"reason"`
+	Assessed   time.Time  `json:"assessed"`
+	Paid       *time.Time `json:"paid,omitempty"`
+	Waived     *time.Time `json:"waived,omitempty"`
+}
+
+// Outstanding reports whether the fine still counts towards the balance
+func (f Fine) Outstanding() bool {
+	return f.Paid == nil && f.Waived == nil
+}
@@ -0,0 +1,33 @@
+package data
+
+import "strings"
+
+// Genre is a node in the managed genre/subject taxonomy
+type Genre struct {
+	ID       int      `json:"id"`
+	Name     string   `json:"name"`
+	ParentID *int     `json:"parent_id,omitempty"`
+	Aliases  []string `json:"aliases,omitempty"`
+}
+
+// GenreNode is a genre with its subtree, used when browsing the taxonomy
+type GenreNode struct {
+	Genre
+	Children []GenreNode `json:"children,omitempty"`
+}
+
+// NameKeys returns the normalized forms of the genre name and its aliases
+func (g Genre) NameKeys() []string {
+	var keys []string
+	for _, name := range append([]string{g.Name}, g.Aliases...) {
+		if key := NormalizeGenreName(name); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// NormalizeGenreName lowercases a genre name and collapses whitespace
+func NormalizeGenreName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
@@ -0,0 +1,33 @@
+package data
+
+import "time"
+
+// Hold statuses
+const (
+	HoldWaiting   = "waiting"
+	HoldReady     = "ready"
+	HoldFulfilled = "fulfilled"
+	HoldCancelled = "cancelled"
+	HoldExpired   = "expired"
+)
+
+// Hold is a member's request for a book. Holds queue in the order they
+// were placed; when the book comes back the first waiting hold becomes
+// ready for pickup until it expires.
+type Hold struct {
+	ID        int        `json:"id"`
+	MemberID  string     `json:"member_id"`
+	BookID    int        `json:"book_id"`
+	Placed    time.Time  `json:"placed"`
+	Status    string     `json:"status"`
+	ReadyAt   *time.Time `json:"ready_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Branch is where the book is picked up, the book's branch when the
+	// hold was placed
+	Branch string `json:"branch,omitempty"`
+}
+
+// Open reports whether the hold is still waiting or ready for pickup
+func (h Hold) Open() bool {
+	return h.Status == HoldWaiting || h.Status == HoldReady
+}
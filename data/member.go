@@ -2,6 +2,63 @@ package data
 
 // Member represents a library member
 type Member struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Email       string  `json:"email,omitempty"`
+	PhoneNumber string  `json:"phone_number,omitempty"`
+	Address     Address `json:"address"`
+	DateOfBirth Date    `json:"date_of_birth"`
+	Category    string  `json:"category"`
+	JoinDate    Date    `json:"join_date"`
+	ExpiryDate  Date    `json:"expiry_date"`
+
+	Status         string `json:"status"`
+	StatusReason   string `json:"status_reason,omitempty"`
+	SuspendedUntil Date   `json:"suspended_until"`
+
+	PasswordHash string `json:"-"`
+}
+
+// Address is a postal address
+type Address struct {
+	Line1      string `json:"line1,omitempty"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city,omitempty"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// Membership categories
+const (
+	CategoryAdult   = "adult"
+	CategoryChild   = "child"
+	CategoryStudent = "student"
+	CategorySenior  = "senior"
+	CategoryStaff   = "staff"
+)
+
+// MembershipCategory holds the terms of a kind of membership, including
+// its borrowing limits
+type MembershipCategory struct {
+	Name        string `json:"name"`
+	TermMonths  int    `json:"term_months"`
+	MaxLoans    int    `json:"max_loans"`
+	MaxHolds    int    `json:"max_holds"`
+	LoanDays    int    `json:"loan_days"`
+	MaxRenewals int    `json:"max_renewals"`
+}
+
+// MembershipCategories lists the categories a member can belong to
+var MembershipCategories = map[string]MembershipCategory{
+	CategoryAdult:   {Name: CategoryAdult, TermMonths: 12, MaxLoans: 10, MaxHolds: 5, LoanDays: 21, MaxRenewals: 2},
+	CategoryChild:   {Name: CategoryChild, TermMonths: 12, MaxLoans: 5, MaxHolds: 3, LoanDays: 21, MaxRenewals: 2},
+	CategoryStudent: {Name: CategoryStudent, TermMonths: 12, MaxLoans: 8, MaxHolds: 5, LoanDays: 28, MaxRenewals: 3},
+	CategorySenior:  {Name: CategorySenior, TermMonths: 24, MaxLoans: 10, MaxHolds: 5, LoanDays: 28, MaxRenewals: 3},
+	CategoryStaff:   {Name: CategoryStaff, TermMonths: 36, MaxLoans: 20, MaxHolds: 10, LoanDays: 42, MaxRenewals: 5},
+}
+
+// Expired reports whether the membership has lapsed as of the given date
+func (m Member) Expired(on Date) bool {
+	return !m.ExpiryDate.IsZero() && m.ExpiryDate.Before(on.Time)
 }
@@ -0,0 +1,81 @@
+package data
+
+import "time"
+
+// Notice kinds
+const (
+	NoticeCourtesy     = "courtesy"
+	NoticeOverdue      = "overdue"
+	NoticeHoldReady    = "hold_ready"
+	NoticeHoldExpiring = "hold_expiring"
+	NoticeMembership   = "membership_expiring"
+)
+
+// NoticeKinds lists every kind of notice a member can be sent
+var NoticeKinds = []string{NoticeCourtesy, NoticeOverdue, NoticeHoldReady, NoticeHoldExpiring, NoticeMembership}
+
+// Notification channels
+const (
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+	ChannelWebhook = "webhook"
+	ChannelInbox   = "inbox"
+)
+
+// NotificationChannels lists every channel a notice can be sent through
+var NotificationChannels = []string{ChannelEmail, ChannelSMS, ChannelWebhook, ChannelInbox}
+
+// DefaultChannels are used for members who have not chosen any
+var DefaultChannels = []string{ChannelEmail, ChannelInbox}
+
+// Notification delivery statuses
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+	NotificationSkipped = "skipped"
+)
+
+// Notification is a message to a member through one channel and the state
+// of its delivery. Level counts up with each escalating overdue notice for
+// a loan. Seen is set when the member reads an inbox message.
+type Notification struct {
+	ID          int        `json:"id"`
+	MemberID    string     `json:"member_id"`
+	Kind        string     `json:"kind"`
+	Level       int        `json:"level,omitempty"`
+	LoanID      *int       `json:"loan_id,omitempty"`
+	HoldID      *int       `json:"hold_id,omitempty"`
+	Channel     string     `json:"channel"`
+	Language    string     `json:"language"`
+	To          string     `json:"to"`
+	Subject     string     `json:"subject"`
+	Body        string     `json:"body"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	Created     time.Time  `json:"created"`
+	NextAttempt time.Time  `json:"next_attempt"`
+	Sent        *time.Time `json:"sent,omitempty"`
+	Seen        *time.Time `json:"seen,omitempty"`
+}
+
+// NotificationPreferences are a member's choices about what they are
+// sent and how. OptOut lists notice kinds they do not want, Channels the
+// channels notices go out on and Language the language they are written
+// in.
+type NotificationPreferences struct {
+	OptOut   []string `json:"opt_out"`
+	Channels []string `json:"channels"`
+	Language string   `json:"language,omitempty"`
+}
+
+// Wants reports whether the member accepts notices of the kind
+func (p NotificationPreferences) Wants(kind string) bool {
+	for _, k := range p.OptOut {
+		if k == kind {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package data
+
+// Member account statuses. Active, suspended and blocked can be set by
+// staff; expired and automatic blocks are derived from the account.
+const (
+	StatusActive    = "active"
+	StatusExpired   = "expired"
+	StatusSuspended = "suspended"
+	StatusBlocked   = "blocked"
+)
+
+// Circulation rules reported when an operation is refused
+const (
+	RuleMembershipExpired = "membership_expired"
+	RuleSuspended         = "suspended"
+	RuleBlocked           = "blocked"
+	RuleFineThreshold     = "fine_threshold"
+	RuleOverdueLimit      = "overdue_limit"
+	RuleLoanLimit         = "loan_limit"
+	RuleHoldLimit         = "hold_limit"
+	RuleRenewalLimit      = "renewal_limit"
+	RuleHoldQueue         = "hold_queue"
+	RuleBookUnavailable   = "book_unavailable"
+	RuleBookLost          = "book_lost"
+	RuleReserved          = "reserved_for_another_member"
+	RuleDuplicateHold     = "duplicate_hold"
+	RuleAlreadyBorrowed   = "already_borrowed"
+)
+
+// Library wide circulation settings
+const (
+	// FinePerDay is charged for each full day a loan is overdue
+	FinePerDay = 5.0
+	// FineBlockThreshold blocks members owing at least this much
+	FineBlockThreshold = 50.0
+	// OverdueBlockCount blocks members with this many overdue loans
+	OverdueBlockCount = 3
+	// HoldPickupDays is how long a ready hold waits for pickup
+	HoldPickupDays = 7
+	// LostBookFee is charged, on top of any overdue penalty, for a book
+	// lost on loan
+	LostBookFee = 25.0
+)
+
+// RuleViolation names a circulation rule that refused an operation
+type RuleViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// AccountStatus is the effective standing of a member's account
+type AccountStatus struct {
+	MemberID     string          `json:"member_id"`
+	Status       string          `json:"status"`
+	Reasons      []RuleViolation `json:"reasons,omitempty"`
+	FineBalance  float64         `json:"fine_balance"`
+	OverdueLoans int             `json:"overdue_loans"`
+	ActiveLoans  int             `json:"active_loans"`
+	OpenHolds    int             `json:"open_holds"`
+	MaxLoans     int             `json:"max_loans"`
+	MaxHolds     int             `json:"max_holds"`
+}
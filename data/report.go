@@ -0,0 +1,29 @@
+package data
+
+import "time"
+
+// Report summarises circulation over a period, from From up to but not
+// including To
+type Report struct {
+	ID        int       `json:"id"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Generated time.Time `json:"generated"`
+
+	Checkouts    int `json:"checkouts"`
+	Returns      int `json:"returns"`
+	LateReturns  int `json:"late_returns"`
+	HoldsPlaced  int `json:"holds_placed"`
+	HoldsReady   int `json:"holds_ready"`
+	HoldsExpired int `json:"holds_expired"`
+	NewMembers   int `json:"new_members"`
+
+	FinesAssessed    float64 `json:"fines_assessed"`
+	FinesPaid        float64 `json:"fines_paid"`
+	FinesWaived      float64 `json:"fines_waived"`
+	FinesOutstanding float64 `json:"fines_outstanding"`
+
+	// Loans and overdue loans out at the end of the period
+	ActiveLoans  int `json:"active_loans"`
+	OverdueLoans int `json:"overdue_loans"`
+}
@@ -2,5 +2,6 @@ package data
 
 // ErrorResponse defines the structure for error responses
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error      string          `json:"error"`
+	Violations []RuleViolation `json:"violations,omitempty"`
 }
@@ -0,0 +1,14 @@
+package data
+
+import "time"
+
+// Session is a logged-in member. Sessions are stored under the hash of
+// their token.
+type Session struct {
+	MemberID string    `json:"member_id"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+}
+
+// SessionTTL is how long a login lasts
+const SessionTTL = 24 * time.Hour
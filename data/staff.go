@@ -0,0 +1,43 @@
+package data
+
+import "time"
+
+// StaffUser is a member of library staff who can use the staff API.
+// Users who log in through the identity provider have an ExternalID, the
+// provider's subject, and no password.
+type StaffUser struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	Name         string    `json:"name"`
+	Role         string    `json:"role"`
+	Disabled     bool      `json:"disabled"`
+	ExternalID   string    `json:"external_id,omitempty"`
+	Created      time.Time `json:"created"`
+	PasswordHash string    `json:"-"`
+}
+
+// RefreshToken lets a staff user obtain new access tokens, stored under
+// the hash of the token. Each use replaces it with a new token in the
+// same family, so a revoked token being presented again reveals a leak.
+type RefreshToken struct {
+	StaffID int        `json:"staff_id"`
+	Family  string     `json:"family"`
+	Created time.Time  `json:"created"`
+	Expires time.Time  `json:"expires"`
+	Revoked *time.Time `json:"revoked,omitempty"`
+}
+
+// RefreshTokenTTL is how long a staff login lasts without being refreshed
+const RefreshTokenTTL = 7 * 24 * time.Hour
+
+// OIDCLogin is an identity provider login in progress, stored under its
+// state parameter
+type OIDCLogin struct {
+	Nonce    string    `json:"-"`
+	Verifier string    `json:"-"`
+	Expires  time.Time `json:"expires"`
+}
+
+// OIDCLoginTTL is how long a user has to finish logging in at the
+// identity provider
+const OIDCLoginTTL = 10 * time.Minute
@@ -0,0 +1,38 @@
+package data
+
+import "time"
+
+// Version is a saved state of a record. Number counts up from 1 for each
+// record.
+type Version[T any] struct {
+	Number int       `json:"version"`
+	Action string    `json:"action"`
+	Actor  string    `json:"actor"`
+	Time   time.Time `json:"time"`
+	Value  T         `json:"value"`
+}
+
+// FieldChange is a field that differs between two versions
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// VersionDiff lists the fields that changed between two versions
+type VersionDiff struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// Trashed is a deleted record kept so it can be restored until Expires
+type Trashed[T any] struct {
+	Value     T         `json:"value"`
+	Deleted   time.Time `json:"deleted"`
+	DeletedBy string    `json:"deleted_by"`
+	Expires   time.Time `json:"expires"`
+}
+
+// TrashRetention is how long deleted books and members can be restored
+const TrashRetention = 30 * 24 * time.Hour
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event types, delivered to webhooks and streamed to clients
+const (
+	EventBookCreated    = "book.created"
+	EventBookDeleted    = "book.deleted"
+	EventLoanCheckedOut = "loan.checked_out"
+	EventLoanReturned   = "loan.returned"
+	EventHoldReady      = "hold.ready"
+	EventMemberCreated  = "member.created"
+)
+
+// EventTypes lists every event type
+var EventTypes = []string{EventBookCreated, EventBookDeleted, EventLoanCheckedOut, EventLoanReturned, EventHoldReady, EventMemberCreated}
+
+// Event is a change in the library. Data is the record it concerns as it
+// was straight after the change. Branch and MemberID say where and whom it
+// concerns, when that applies.
+type Event struct {
+	ID       int             `json:"id"`
+	Type     string          `json:"type"`
+	Time     time.Time       `json:"time"`
+	Branch   string          `json:"branch,omitempty"`
+	MemberID string          `json:"member_id,omitempty"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// Webhook is a subscription to events, which are POSTed to URL and signed
+// with Secret. Owner is the caller that created it, as kind:id.
+type Webhook struct {
+	ID          int       `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description,omitempty"`
+	Active      bool      `json:"active"`
+	Owner       string    `json:"owner"`
+	Created     time.Time `json:"created"`
+	Secret      string    `json:"-"`
+}
+
+// Webhook delivery statuses. Deliveries that fail every attempt are dead
+// letters, kept until redelivered or purged.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event on its way to one webhook, with a log of
+// every attempt to deliver it
+type WebhookDelivery struct {
+	ID          int               `json:"id"`
+	WebhookID   int               `json:"webhook_id"`
+	Event       Event             `json:"event"`
+	Status      string            `json:"status"`
+	Failures    int               `json:"failures"`
+	NextAttempt time.Time         `json:"next_attempt"`
+	Created     time.Time         `json:"created"`
+	Delivered   *time.Time        `json:"delivered,omitempty"`
+	Attempts    []DeliveryAttempt `json:"attempts"`
+}
+
+// DeliveryAttempt is one POST of a delivery. StatusCode is missing when
+// the request got no answer.
+type DeliveryAttempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
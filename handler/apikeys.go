@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// APIKeyRequest creates an API key
+type APIKeyRequest struct {
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	AllowedIPs []string `json:"allowed_ips"`
+}
+
+// APIKeyResponse carries a new or rotated key. The key itself is only
+// ever shown here.
+type APIKeyResponse struct {
+	data.APIKey
+	Key string `json:"key"`
+}
+
+var (
+	errInvalidAPIKey = errors.New("Invalid API key")
+	errAPIKeyAddress = errors.New("API key is not allowed from this address")
+)
+
+// authenticateAPIKey resolves the principal for an X-API-Key header,
+// aborting with 401 or 403 when the key is unknown, revoked or used from
+// an address it is not allowed from
+func authenticateAPIKey(c *gin.Context, key string) (auth.Principal, bool) {
+	principal, err := apiKeyPrincipal(key, c.ClientIP())
+	switch {
+	case errors.Is(err, errAPIKeyAddress):
+		c.AbortWithStatusJSON(http.StatusForbidden, data.ErrorResponse{Error: err.Error()})
+		return auth.Principal{}, false
+	case err != nil:
+		unauthorized(c, err.Error())
+		return auth.Principal{}, false
+	}
+	return principal, true
+}
+
+// apiKeyUsage tracks when and how often each API key is used. It is kept
+// apart from the database, so that authenticating a request by key needs
+// only the read lock.
+var apiKeyUsage = struct {
+	sync.Mutex
+	byID map[int]keyUsage
+}{byID: make(map[int]keyUsage)}
+
+type keyUsage struct {
+	lastUsed time.Time
+	ip       string
+	requests int
+}
+
+// apiKeyPrincipal resolves the principal for an API key used from ip and
+// records the use
+func apiKeyPrincipal(key, ip string) (auth.Principal, error) {
+	data.InMemoryDB.RLock()
+	id, ok := data.InMemoryDB.APIKeyHashes[auth.HashToken(key)]
+	apiKey, found := data.InMemoryDB.APIKeys[id]
+	data.InMemoryDB.RUnlock()
+
+	if !ok || !found || apiKey.Revoked != nil {
+		return auth.Principal{}, errInvalidAPIKey
+	}
+	if !auth.IPAllowed(ip, apiKey.AllowedIPs) {
+		return auth.Principal{}, errAPIKeyAddress
+	}
+
+	apiKeyUsage.Lock()
+	usage := apiKeyUsage.byID[id]
+	usage.lastUsed = time.Now()
+	usage.ip = ip
+	usage.requests++
+	apiKeyUsage.byID[id] = usage
+	apiKeyUsage.Unlock()
+
+	return auth.NewAPIKeyPrincipal(strconv.Itoa(apiKey.ID), apiKey.Name, apiKey.Scopes), nil
+}
+
+// withUsage fills in a key's usage for showing it
+func withUsage(key data.APIKey) data.APIKey {
+	apiKeyUsage.Lock()
+	defer apiKeyUsage.Unlock()
+
+	if usage, ok := apiKeyUsage.byID[key.ID]; ok {
+		key.LastUsed = &usage.lastUsed
+		key.LastUsedIP = usage.ip
+		key.RequestCount = usage.requests
+	}
+	return key
+}
+
+func CreateAPIKeyHandler(c *gin.Context) {
+	var req APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Name is required"})
+		return
+	}
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "At least one scope is required"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidPermission(scope) {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Unknown scope " + scope})
+			return
+		}
+		if scope == auth.StaffAdmin {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "API keys cannot hold " + auth.StaffAdmin})
+			return
+		}
+	}
+	ranges, err := auth.ParseIPRanges(req.AllowedIPs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: err.Error()})
+		return
+	}
+	key, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to create API key"})
+		return
+	}
+	creator, _ := authenticate(c)
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	apiKey := data.APIKey{
+		ID:         data.InMemoryDB.NextAPIKeyID,
+		Name:       req.Name,
+		Prefix:     prefix,
+		Scopes:     req.Scopes,
+		AllowedIPs: ranges,
+		CreatedBy:  creator.Name,
+		Created:    time.Now(),
+		Hash:       auth.HashToken(key),
+	}
+	data.InMemoryDB.APIKeys[apiKey.ID] = apiKey
+	data.InMemoryDB.APIKeyHashes[apiKey.Hash] = apiKey.ID
+	data.InMemoryDB.NextAPIKeyID++
+	recordAudit(c, "create", EntityAPIKey, apiKey.ID, nil, apiKey)
+
+	c.JSON(http.StatusOK, APIKeyResponse{APIKey: apiKey, Key: key})
+}
+
+func GetAllAPIKeysHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	keys := make([]data.APIKey, 0, len(data.InMemoryDB.APIKeys))
+	for id := 0; id < data.InMemoryDB.NextAPIKeyID; id++ {
+		if key, ok := data.InMemoryDB.APIKeys[id]; ok {
+			keys = append(keys, withUsage(key))
+		}
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+func GetAPIKeyHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid API key ID"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	key, ok := data.InMemoryDB.APIKeys[id]
+	data.InMemoryDB.RUnlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "API key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, withUsage(key))
+}
+
+// RevokeAPIKeyHandler stops a key from working. The key stays listed with
+// its usage.
+func RevokeAPIKeyHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid API key ID"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	key, ok := data.InMemoryDB.APIKeys[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "API key not found"})
+		return
+	}
+	if key.Revoked == nil {
+		before := key
+		now := time.Now()
+		key.Revoked = &now
+		delete(data.InMemoryDB.APIKeyHashes, key.Hash)
+		data.InMemoryDB.APIKeys[id] = key
+		recordAudit(c, "revoke", EntityAPIKey, id, before, key)
+	}
+
+	c.JSON(http.StatusOK, withUsage(key))
+}
+
+// RotateAPIKeyHandler replaces a key's secret, keeping its name, scopes
+// and usage. The old secret stops working at once.
+func RotateAPIKeyHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid API key ID"})
+		return
+	}
+	secret, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to create API key"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	key, ok := data.InMemoryDB.APIKeys[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "API key not found"})
+		return
+	}
+	if key.Revoked != nil {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "API key is revoked"})
+		return
+	}
+
+	before := key
+	now := time.Now()
+	delete(data.InMemoryDB.APIKeyHashes, key.Hash)
+	key.Prefix = prefix
+	key.Hash = auth.HashToken(secret)
+	key.Rotated = &now
+	data.InMemoryDB.APIKeys[id] = key
+	data.InMemoryDB.APIKeyHashes[key.Hash] = id
+	recordAudit(c, "rotate", EntityAPIKey, id, before, key)
+
+	c.JSON(http.StatusOK, APIKeyResponse{APIKey: withUsage(key), Key: secret})
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/audit"
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// requestIDKey is the context key RequestID stores the request ID under
+const requestIDKey = "request_id"
+
+// Audit records every change made through the API
+var Audit = audit.NewLog()
+
+// Entities named in the audit log
+const (
+	EntityBook         = "book"
+	EntityCover        = "cover"
+	EntityAuthor       = "author"
+	EntityGenre        = "genre"
+	EntityMember       = "member"
+	EntityBorrower     = "borrower"
+	EntityHold         = "hold"
+	EntityFine         = "fine"
+	EntityStaff        = "staff"
+	EntityAPIKey       = "api_key"
+	EntityNotification = "notification"
+	EntityJob          = "job"
+	EntityReport       = "report"
+	EntityWebhook      = "webhook"
+	// EntityWebhookDelivery is one event's delivery to a webhook
+	EntityWebhookDelivery = "webhook_delivery"
+)
+
+// RequestID tags each request with an ID, taken from a well-formed
+// X-Request-ID header or generated, and echoes it in the response
+func RequestID(c *gin.Context) {
+	id := requestID(c.GetHeader("X-Request-ID"))
+	c.Set(requestIDKey, id)
+	c.Header("X-Request-ID", id)
+	c.Next()
+}
+
+// requestID returns a well-formed request ID given by the caller, or a
+// new one
+func requestID(given string) string {
+	if len(given) == 0 || len(given) > 128 {
+		b := make([]byte, 16)
+		rand.Read(b)
+		return hex.EncodeToString(b)
+	}
+	return given
+}
+
+// recordAudit appends a change to the audit log, attributed to the
+// caller. Before is nil for creations and after is nil for deletions. The
+// change has already happened, so a failure to record it is logged
+// rather than failing the request.
+func recordAudit(c *gin.Context, action, entity string, id any, before, after any) {
+	if err := appendAudit(requestMeta(c), time.Now(), action, entity, id, before, after); err != nil {
+		c.Error(err)
+	}
+}
+
+// AuditEvents records the changes announced by domain events in the audit
+// log, attributed to whoever made them, or to the system for changes the
+// service made by itself. Holds becoming ready, being fulfilled and
+// expiring follow from other changes and are not recorded.
+func AuditEvents(env bus.Envelope) error {
+	switch e := env.Event.(type) {
+	case data.BookCreated:
+		return appendAudit(env.Meta, env.Time, "create", EntityBook, e.Book.ID, nil, e.Book)
+	case data.BookUpdated:
+		return appendAudit(env.Meta, env.Time, "update", EntityBook, e.After.ID, e.Before, e.After)
+	case data.BookReverted:
+		return appendAudit(env.Meta, env.Time, "revert", EntityBook, e.After.ID, e.Before, e.After)
+	case data.BookDeleted:
+		return appendAudit(env.Meta, env.Time, "delete", EntityBook, e.Book.ID, e.Book, nil)
+	case data.BookRestored:
+		return appendAudit(env.Meta, env.Time, "restore", EntityBook, e.Book.ID, nil, e.Book)
+	case data.MemberCreated:
+		return appendAudit(env.Meta, env.Time, "create", EntityMember, e.Member.ID, nil, e.Member)
+	case data.MemberUpdated:
+		return appendAudit(env.Meta, env.Time, "update", EntityMember, e.After.ID, e.Before, e.After)
+	case data.MemberReverted:
+		return appendAudit(env.Meta, env.Time, "revert", EntityMember, e.After.ID, e.Before, e.After)
+	case data.MemberStatusChanged:
+		return appendAudit(env.Meta, env.Time, "status", EntityMember, e.After.ID, e.Before, e.After)
+	case data.MemberDeleted:
+		return appendAudit(env.Meta, env.Time, "delete", EntityMember, e.Member.ID, e.Member, nil)
+	case data.MemberRestored:
+		return appendAudit(env.Meta, env.Time, "restore", EntityMember, e.Member.ID, nil, e.Member)
+	case data.LoanCheckedOut:
+		return appendAudit(env.Meta, env.Time, "checkout", EntityBorrower, e.Loan.ID, nil, e.Loan)
+	case data.LoanRenewed:
+		return appendAudit(env.Meta, env.Time, "renew", EntityBorrower, e.Loan.ID, e.Before, e.Loan)
+	case data.LoanReturned:
+		return appendAudit(env.Meta, env.Time, "return", EntityBorrower, e.Loan.ID, e.Before, e.Loan)
+	case data.LoanMarkedLost:
+		return appendAudit(env.Meta, env.Time, "lost", EntityBorrower, e.Loan.ID, e.Before, e.Loan)
+	case data.LoanFound:
+		return appendAudit(env.Meta, env.Time, "found", EntityBorrower, e.Loan.ID, e.Before, e.Loan)
+	case data.LoanDeleted:
+		return appendAudit(env.Meta, env.Time, "delete", EntityBorrower, e.Loan.ID, e.Loan, nil)
+	case data.HoldPlaced:
+		return appendAudit(env.Meta, env.Time, "create", EntityHold, e.Hold.ID, nil, e.Hold)
+	case data.HoldWithdrawn:
+		return appendAudit(env.Meta, env.Time, "cancel", EntityHold, e.Hold.ID, e.Before, e.Hold)
+	case data.FineAssessed:
+		return appendAudit(env.Meta, env.Time, "assess", EntityFine, e.Fine.ID, nil, e.Fine)
+	case data.FineSettled:
+		action := "pay"
+		if e.Fine.Waived != nil {
+			action = "waive"
+		}
+		return appendAudit(env.Meta, env.Time, action, EntityFine, e.Fine.ID, e.Before, e.Fine)
+	}
+	return nil
+}
+
+func appendAudit(meta bus.Meta, t time.Time, action, entity string, id any, before, after any) error {
+	entry := audit.Entry{
+		Time:      t,
+		Actor:     meta.Actor,
+		ActorName: meta.ActorName,
+		RequestID: meta.RequestID,
+		Action:    action,
+		Entity:    entity,
+		EntityID:  auditID(id),
+	}
+	if entry.Actor == "" {
+		entry.Actor = "system"
+	}
+
+	var err error
+	if entry.Before, err = auditValue(before); err != nil {
+		return err
+	}
+	if entry.After, err = auditValue(after); err != nil {
+		return err
+	}
+	_, err = Audit.Append(entry)
+	return err
+}
+
+// requestMeta names the caller making a request and the request
+func requestMeta(c *gin.Context) bus.Meta {
+	actor, name := auditActor(c)
+	return bus.Meta{Actor: actor, ActorName: name, RequestID: c.GetString(requestIDKey)}
+}
+
+// eventContext carries the caller into the domain events published while
+// handling a request, so the audit log can attribute them
+func eventContext(c *gin.Context) context.Context {
+	return bus.WithMeta(c.Request.Context(), requestMeta(c))
+}
+
+// auditActor names the caller as kind:id
+func auditActor(c *gin.Context) (string, string) {
+	if principal, ok := c.Get(principalKey); ok {
+		principal := principal.(auth.Principal)
+		return principal.Kind + ":" + principal.ID, principal.Name
+	}
+	if memberID := c.GetString(memberIDKey); memberID != "" {
+		return "member:" + memberID, ""
+	}
+	return "anonymous", ""
+}
+
+func auditID(id any) string {
+	switch id := id.(type) {
+	case int:
+		return strconv.Itoa(id)
+	case string:
+		return id
+	}
+	return ""
+}
+
+func auditValue(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return nil, err
+	}
+	return b, nil
+}
+
+// GetAuditLogHandler returns audit entries filtered by actor, entity,
+// action and time range, oldest first. Pass the last seq seen as after
+// to page through.
+func GetAuditLogHandler(c *gin.Context) {
+	filter := audit.Filter{
+		Actor:    c.Query("actor"),
+		Entity:   c.Query("entity"),
+		EntityID: c.Query("entity_id"),
+		Action:   c.Query("action"),
+		Limit:    100,
+	}
+
+	var err error
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid from time"})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid to time"})
+			return
+		}
+	}
+	if after := c.Query("after"); after != "" {
+		seq, err := strconv.Atoi(after)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid after"})
+			return
+		}
+		filter.Start = seq + 1
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 1 || filter.Limit > 1000 {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Limit must be between 1 and 1000"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, Audit.Query(filter))
+}
+
+// AuditVerification reports whether the audit log's hash chain is intact
+type AuditVerification struct {
+	Entries  int    `json:"entries"`
+	Valid    bool   `json:"valid"`
+	BrokenAt *int   `json:"broken_at,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func VerifyAuditLogHandler(c *gin.Context) {
+	result := AuditVerification{Entries: Audit.Len(), Valid: true}
+
+	var chainErr *audit.ChainError
+	if err := Audit.Verify(); errors.As(err, &chainErr) {
+		result.Valid = false
+		result.BrokenAt = &chainErr.Seq
+		result.Error = err.Error()
+	} else if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to verify audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+func CreateAuthorHandler(c *gin.Context) {
+	var newAuthor data.Author
+	if err := c.ShouldBindJSON(&newAuthor); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if data.NormalizeAuthorName(newAuthor.Name) == "" {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Author name is required"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	newAuthor.ID = data.InMemoryDB.NextAuthorID
+	if err := checkAuthorNames(newAuthor); err != nil {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: err.Error()})
+		return
+	}
+	data.InMemoryDB.NextAuthorID++
+
+	storeAuthor(newAuthor)
+	recordAudit(c, "create", EntityAuthor, newAuthor.ID, nil, newAuthor)
+
+	c.JSON(http.StatusOK, newAuthor)
+}
+
+func UpdateAuthorHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid author ID"})
+		return
+	}
+
+	var updated data.Author
+	if err := c.ShouldBindJSON(&updated); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if data.NormalizeAuthorName(updated.Name) == "" {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Author name is required"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	old, ok := data.InMemoryDB.Authors[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Author not found"})
+		return
+	}
+
+	updated.ID = id
+	if err := checkAuthorNames(updated); err != nil {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	for _, key := range old.NameKeys() {
+		delete(data.InMemoryDB.AuthorNames, key)
+	}
+	storeAuthor(updated)
+
+	// Books carry the canonical name for display, so refresh them too
+	for bookID, book := range data.InMemoryDB.Books {
+		if containsInt(book.AuthorIDs, id) {
+			book.Author = authorDisplayName(book.AuthorIDs)
+			data.InMemoryDB.Books[bookID] = book
+		}
+	}
+	recordAudit(c, "update", EntityAuthor, id, old, updated)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+func GetAuthorByIDHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid author ID"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	author, ok := data.InMemoryDB.Authors[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Author not found"})
+		return
+	}
+
+	detail := data.AuthorDetail{Author: author, Works: []data.Book{}}
+	for _, book := range data.InMemoryDB.Books {
+		if containsInt(book.AuthorIDs, id) {
+			detail.Works = append(detail.Works, book)
+		}
+	}
+	sort.Slice(detail.Works, func(i, j int) bool {
+		if detail.Works[i].Year != detail.Works[j].Year {
+			return detail.Works[i].Year < detail.Works[j].Year
+		}
+		return detail.Works[i].ID < detail.Works[j].ID
+	})
+
+	c.JSON(http.StatusOK, detail)
+}
+
+func GetAllAuthorsHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	var authors []data.Author
+	for _, author := range data.InMemoryDB.Authors {
+		authors = append(authors, author)
+	}
+	sort.Slice(authors, func(i, j int) bool { return authors[i].ID < authors[j].ID })
+
+	c.JSON(http.StatusOK, authors)
+}
+
+// SearchAuthorsHandler resolves a name in any of its known forms. An exact
+// match on a variant returns only the canonical author; otherwise authors
+// whose names contain the query are returned.
+func SearchAuthorsHandler(c *gin.Context) {
+	nameParam := c.Query("name")
+	if data.NormalizeAuthorName(nameParam) == "" {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Name is required"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	if author, ok := resolveAuthor(nameParam); ok {
+		c.JSON(http.StatusOK, []data.Author{author})
+		return
+	}
+
+	var authors []data.Author
+	for _, author := range data.InMemoryDB.Authors {
+		if authorNameContains(author, nameParam) {
+			authors = append(authors, author)
+		}
+	}
+	sort.Slice(authors, func(i, j int) bool { return authors[i].ID < authors[j].ID })
+
+	c.JSON(http.StatusOK, authors)
+}
+
+// resolveAuthor finds the author owning the given name form.
+// The caller must hold the database lock.
+func resolveAuthor(name string) (data.Author, bool) {
+	id, ok := data.InMemoryDB.AuthorNames[data.NormalizeAuthorName(name)]
+	if !ok {
+		return data.Author{}, false
+	}
+	author, ok := data.InMemoryDB.Authors[id]
+	return author, ok
+}
+
+// authorNameContains reports whether any name form of the author contains
+// the query, ignoring case and punctuation.
+func authorNameContains(author data.Author, query string) bool {
+	query = data.NormalizeAuthorName(query)
+	for _, key := range author.NameKeys() {
+		if strings.Contains(key, query) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAuthorNames rejects an author whose name forms already belong to a
+// different author. The caller must hold the database lock.
+func checkAuthorNames(author data.Author) error {
+	for _, key := range author.NameKeys() {
+		if owner, ok := data.InMemoryDB.AuthorNames[key]; ok && owner != author.ID {
+			return fmt.Errorf("Name %q already belongs to author %d", key, owner)
+		}
+	}
+	return nil
+}
+
+// storeAuthor saves the author and indexes all of its name forms.
+// The caller must hold the database lock.
+func storeAuthor(author data.Author) {
+	data.InMemoryDB.Authors[author.ID] = author
+	for _, key := range author.NameKeys() {
+		data.InMemoryDB.AuthorNames[key] = author.ID
+	}
+}
+
+// linkBookAuthors points the book at its author records. Explicit author
+// IDs must exist; otherwise the free-text author is resolved against known
+// name forms, creating a new authority record when nothing matches.
+// The caller must hold the database lock.
+func linkBookAuthors(book *data.Book) error {
+	if len(book.AuthorIDs) == 0 && data.NormalizeAuthorName(book.Author) != "" {
+		author, ok := resolveAuthor(book.Author)
+		if !ok {
+			author = data.Author{ID: data.InMemoryDB.NextAuthorID, Name: strings.TrimSpace(book.Author)}
+			data.InMemoryDB.NextAuthorID++
+			storeAuthor(author)
+		}
+		book.AuthorIDs = []int{author.ID}
+	}
+
+	for _, id := range book.AuthorIDs {
+		if _, ok := data.InMemoryDB.Authors[id]; !ok {
+			return fmt.Errorf("Author %d not found", id)
+		}
+	}
+	if len(book.AuthorIDs) > 0 {
+		book.Author = authorDisplayName(book.AuthorIDs)
+	}
+	return nil
+}
+
+// authorDisplayName joins the canonical names of the given authors.
+// The caller must hold the database lock.
+func authorDisplayName(ids []int) string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, data.InMemoryDB.Authors[id].Name)
+	}
+	return strings.Join(names, "; ")
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
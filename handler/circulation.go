@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/circulation"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+func RenewBorrowerHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid borrower ID"})
+		return
+	}
+
+	loan, err := circulation.Renew(eventContext(c), id, time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, loan)
+}
+
+// ReturnBorrowerHandler checks a book back in. The response includes the
+// fine charged for a late return, if any.
+func ReturnBorrowerHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid borrower ID"})
+		return
+	}
+
+	loan, fine, err := circulation.Return(eventContext(c), id, time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"borrower": loan, "fine": fine})
+}
+
+// MarkLostHandler closes a loan whose book will not come back. The
+// response includes the fine charged for it.
+func MarkLostHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid borrower ID"})
+		return
+	}
+
+	loan, fine, err := circulation.MarkLost(eventContext(c), id, time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"borrower": loan, "fine": fine})
+}
+
+// MarkFoundHandler puts the book of a lost loan back on the shelf
+func MarkFoundHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid borrower ID"})
+		return
+	}
+
+	loan, err := circulation.MarkFound(eventContext(c), id, time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, loan)
+}
+
+// GetBookHistoryHandler lists every loan of a book from the circulation
+// log, newest first, optionally only those out between two dates
+func GetBookHistoryHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid book ID"})
+		return
+	}
+	from, to, limit, ok := historyQuery(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, limitHistory(circulation.ItemHistory(id, from, to), limit))
+}
+
+// GetMemberHistoryHandler lists every loan of a member from the
+// circulation log, newest first, like GetBookHistoryHandler. Loans of
+// deleted members are still found.
+func GetMemberHistoryHandler(c *gin.Context) {
+	from, to, limit, ok := historyQuery(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, limitHistory(circulation.MemberHistory(c.Query("id"), from, to), limit))
+}
+
+// RebuildLoansHandler replaces the current loans with a fresh projection
+// of the circulation log
+func RebuildLoansHandler(c *gin.Context) {
+	loans := circulation.Rebuild()
+	recordAudit(c, "rebuild", EntityBorrower, nil, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"loans": loans})
+}
+
+// historyQuery reads the optional from and to dates, both inclusive, and
+// limit of a history request
+func historyQuery(c *gin.Context) (from, to time.Time, limit int, ok bool) {
+	for _, param := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if value := c.Query(param.name); value != "" {
+			t, err := time.Parse(data.DateLayout, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid " + param.name + " date"})
+				return from, to, 0, false
+			}
+			*param.t = t
+		}
+	}
+	if !to.IsZero() {
+		to = to.AddDate(0, 0, 1)
+	}
+
+	limit = 100
+	if param := c.Query("limit"); param != "" {
+		var err error
+		if limit, err = strconv.Atoi(param); err != nil || limit < 1 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Limit must be between 1 and 1000"})
+			return from, to, 0, false
+		}
+	}
+	return from, to, limit, true
+}
+
+func limitHistory(loans []data.LoanHistory, limit int) []data.LoanHistory {
+	if len(loans) > limit {
+		return loans[:limit]
+	}
+	return loans
+}
+
+func CreateHoldHandler(c *gin.Context) {
+	var newHold data.Hold
+	if err := c.ShouldBindJSON(&newHold); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+
+	hold, err := circulation.PlaceHold(eventContext(c), newHold.MemberID, newHold.BookID, time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hold)
+}
+
+func GetHoldByIDHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid hold ID"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	hold, ok := data.InMemoryDB.Holds[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Hold not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hold)
+}
+
+func CancelHoldHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid hold ID"})
+		return
+	}
+
+	hold, err := circulation.CancelHold(eventContext(c), id, time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hold)
+}
+
+// GetMemberAccountHandler reports a member's effective status, with every
+// rule currently stopping them from borrowing.
+func GetMemberAccountHandler(c *gin.Context) {
+	status, err := circulation.Account(c.Query("id"), time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// MemberStatusRequest sets the staff-controlled status of a member
+type MemberStatusRequest struct {
+	Status         string    `json:"status"`
+	Reason         string    `json:"reason"`
+	SuspendedUntil data.Date `json:"suspended_until"`
+}
+
+func SetMemberStatusHandler(c *gin.Context) {
+	var req MemberStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+
+	member, err := circulation.SetStatus(eventContext(c), c.Query("id"), req.Status, req.Reason, req.SuspendedUntil)
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+func GetMemberLoansHandler(c *gin.Context) {
+	if !memberExists(c.Query("id")) {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Member not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, circulation.MemberLoans(c.Query("id"), c.Query("history") == "true"))
+}
+
+func GetMemberHoldsHandler(c *gin.Context) {
+	if !memberExists(c.Query("id")) {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Member not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, circulation.MemberHolds(c.Query("id"), c.Query("history") == "true"))
+}
+
+func GetMemberFinesHandler(c *gin.Context) {
+	if !memberExists(c.Query("id")) {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Member not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, circulation.MemberFines(c.Query("id")))
+}
+
+func PayFineHandler(c *gin.Context) {
+	settleFine(c, false)
+}
+
+func WaiveFineHandler(c *gin.Context) {
+	settleFine(c, true)
+}
+
+func settleFine(c *gin.Context, waive bool) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid fine ID"})
+		return
+	}
+
+	fine, err := circulation.SettleFine(eventContext(c), id, waive, time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, fine)
+}
+
+func memberExists(id string) bool {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	_, ok := data.InMemoryDB.Members[id]
+	return ok
+}
+
+// circulationError maps errors from the circulation package to responses.
+// Rule violations are reported individually so callers can tell exactly
+// which rule refused the operation.
+func circulationError(c *gin.Context, err error) {
+	var policy *circulation.PolicyError
+	status := circulationStatus(err)
+	switch {
+	case errors.As(err, &policy):
+		c.JSON(status, data.ErrorResponse{Error: policy.Error(), Violations: policy.Violations})
+	case status == http.StatusInternalServerError:
+		c.Error(err)
+		c.JSON(status, data.ErrorResponse{Error: "Internal server error"})
+	default:
+		c.JSON(status, data.ErrorResponse{Error: err.Error()})
+	}
+}
+
+// circulationStatus is the response status for an error from the
+// circulation package
+func circulationStatus(err error) int {
+	var policy *circulation.PolicyError
+	switch {
+	case errors.As(err, &policy):
+		return http.StatusConflict
+	case errors.Is(err, circulation.ErrMemberNotFound),
+		errors.Is(err, circulation.ErrBookNotFound),
+		errors.Is(err, circulation.ErrLoanNotFound),
+		errors.Is(err, circulation.ErrHoldNotFound),
+		errors.Is(err, circulation.ErrFineNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, circulation.ErrLoanReturned),
+		errors.Is(err, circulation.ErrLoanLost),
+		errors.Is(err, circulation.ErrLoanNotLost),
+		errors.Is(err, circulation.ErrHoldClosed),
+		errors.Is(err, circulation.ErrFineSettled):
+		return http.StatusConflict
+	case errors.Is(err, circulation.ErrInvalidStatus):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
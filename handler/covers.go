@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/data"
+	"github.com/jerrylovee2/gogo/storage"
+)
+
+// CoverStore holds uploaded cover images and their thumbnails
+var CoverStore storage.BlobStore
+
+const (
+	maxCoverBytes     = 5 << 20
+	maxCoverDimension = 5000
+)
+
+// coverTypes lists the accepted upload content types
+var coverTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// thumbnailWidths are the generated thumbnail sizes, largest first so the
+// smaller ones can be scaled from the previous one.
+var thumbnailWidths = []struct {
+	size  string
+	width int
+}{
+	{"large", 400},
+	{"medium", 200},
+	{"small", 80},
+}
+
+// UploadCoverHandler stores a cover image for a book from the multipart
+// "cover" field and generates its thumbnails.
+func UploadCoverHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid book ID"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	_, ok := data.InMemoryDB.Books[id]
+	data.InMemoryDB.RUnlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Book not found"})
+		return
+	}
+
+	// Leave room for the multipart envelope around the image itself
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCoverBytes+64<<10)
+	file, err := c.FormFile("cover")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, data.ErrorResponse{Error: "Cover image is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Missing cover file"})
+		return
+	}
+	if file.Size > maxCoverBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, data.ErrorResponse{Error: "Cover image is too large"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Unreadable cover file"})
+		return
+	}
+	defer f.Close()
+	raw, err := io.ReadAll(io.LimitReader(f, maxCoverBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Unreadable cover file"})
+		return
+	}
+
+	// Trust the bytes, not the client supplied content type
+	contentType := http.DetectContentType(raw)
+	if !coverTypes[contentType] {
+		c.JSON(http.StatusUnsupportedMediaType, data.ErrorResponse{Error: "Cover must be a JPEG, PNG or GIF image"})
+		return
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid image"})
+		return
+	}
+	if config.Width > maxCoverDimension || config.Height > maxCoverDimension {
+		c.JSON(http.StatusRequestEntityTooLarge, data.ErrorResponse{Error: "Cover image dimensions are too large"})
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid image"})
+		return
+	}
+
+	sum := sha256.Sum256(raw)
+	cover := &data.Cover{
+		Version:     hex.EncodeToString(sum[:])[:16],
+		ContentType: contentType,
+		URLs:        map[string]string{},
+	}
+
+	if err := CoverStore.Put(coverKey(id, cover.Version, "original"), bytes.NewReader(raw)); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to store cover"})
+		return
+	}
+	cover.URLs["original"] = coverURL(id, cover.Version, "original")
+
+	for _, thumb := range thumbnailWidths {
+		img = thumbnail(img, thumb.width)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to generate thumbnail"})
+			return
+		}
+		if err := CoverStore.Put(coverKey(id, cover.Version, thumb.size), &buf); err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to store cover"})
+			return
+		}
+		cover.URLs[thumb.size] = coverURL(id, cover.Version, thumb.size)
+	}
+
+	data.InMemoryDB.Lock()
+	book, ok := data.InMemoryDB.Books[id]
+	var previous *data.Cover
+	if ok {
+		previous = book.Cover
+		book.Cover = cover
+		data.InMemoryDB.Books[id] = book
+	}
+	data.InMemoryDB.Unlock()
+
+	if !ok {
+		deleteCoverBlobs(id, cover)
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Book not found"})
+		return
+	}
+	if previous != nil && previous.Version != cover.Version {
+		deleteCoverBlobs(id, previous)
+	}
+	recordAudit(c, "upload", EntityCover, id, previous, cover)
+
+	c.JSON(http.StatusOK, book)
+}
+
+// GetCoverHandler serves a cover image. Requests carrying the current
+// version in "v" may be cached indefinitely since a new upload changes
+// the URL; unversioned requests are cached briefly and revalidated with
+// the ETag.
+func GetCoverHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid book ID"})
+		return
+	}
+	size := c.DefaultQuery("size", "medium")
+
+	data.InMemoryDB.RLock()
+	book, ok := data.InMemoryDB.Books[id]
+	data.InMemoryDB.RUnlock()
+	if !ok || book.Cover == nil {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Cover not found"})
+		return
+	}
+	if _, ok := book.Cover.URLs[size]; !ok {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid cover size"})
+		return
+	}
+
+	blob, info, err := CoverStore.Get(coverKey(id, book.Cover.Version, size))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Cover not found"})
+		return
+	} else if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to read cover"})
+		return
+	}
+	defer blob.Close()
+	content, err := io.ReadAll(blob)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to read cover"})
+		return
+	}
+
+	contentType := "image/jpeg"
+	if size == "original" {
+		contentType = book.Cover.ContentType
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("ETag", fmt.Sprintf(`"%s-%s"`, book.Cover.Version, size))
+	if c.Query("v") == book.Cover.Version {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "public, max-age=300")
+	}
+
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime, bytes.NewReader(content))
+}
+
+func DeleteCoverHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid book ID"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	book, ok := data.InMemoryDB.Books[id]
+	cover := book.Cover
+	if ok {
+		book.Cover = nil
+		data.InMemoryDB.Books[id] = book
+	}
+	data.InMemoryDB.Unlock()
+
+	if !ok || cover == nil {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Cover not found"})
+		return
+	}
+	deleteCoverBlobs(id, cover)
+	recordAudit(c, "delete", EntityCover, id, cover, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+func coverKey(bookID int, version, size string) string {
+	return fmt.Sprintf("covers/%d/%s/%s", bookID, version, size)
+}
+
+func coverURL(bookID int, version, size string) string {
+	return fmt.Sprintf("/books/cover?id=%d&size=%s&v=%s", bookID, size, version)
+}
+
+func deleteCoverBlobs(bookID int, cover *data.Cover) {
+	for size := range cover.URLs {
+		if err := CoverStore.Delete(coverKey(bookID, cover.Version, size)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Println(err)
+		}
+	}
+}
+
+// thumbnail scales the image down to the given width with a box filter,
+// flattening any transparency onto white. Images already narrower than the
+// width keep their size.
+func thumbnail(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	width = min(width, bounds.Dx())
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					b += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: 0xffff})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/data"
+	"github.com/jerrylovee2/gogo/stream"
+)
+
+// Events numbers events and streams them to live clients
+var Events = stream.NewBroker(1000)
+
+// HeartbeatInterval is how often an idle event stream is sent a heartbeat,
+// which keeps proxies from closing it
+var HeartbeatInterval = 15 * time.Second
+
+// eventPermissions is what a caller must be allowed to read to receive
+// each event
+var eventPermissions = map[string]string{
+	data.EventBookCreated:    auth.CatalogRead,
+	data.EventBookDeleted:    auth.CatalogRead,
+	data.EventLoanCheckedOut: auth.CirculationRead,
+	data.EventLoanReturned:   auth.CirculationRead,
+	data.EventHoldReady:      auth.CirculationRead,
+	data.EventMemberCreated:  auth.MembersRead,
+}
+
+// BroadcastEvents sends domain events with a type in data.EventTypes to
+// event stream clients and webhook subscribers. It does not touch the
+// database, so it may run with or without the database lock held.
+func BroadcastEvents(env bus.Envelope) error {
+	event := data.Event{Type: env.Event.EventType(), Time: env.Time}
+	var payload any
+	switch e := env.Event.(type) {
+	case data.BookCreated:
+		payload, event.Branch = e.Book, e.Book.Branch
+	case data.BookDeleted:
+		payload, event.Branch = e.Book, e.Book.Branch
+	case data.MemberCreated:
+		payload, event.MemberID = e.Member, e.Member.ID
+	case data.LoanCheckedOut:
+		payload, event.Branch, event.MemberID = e.Loan, e.Loan.Branch, e.Loan.MemberID
+	case data.LoanReturned:
+		payload, event.Branch, event.MemberID = e.Loan, e.Loan.Branch, e.Loan.MemberID
+	case data.HoldReadyForPickup:
+		payload, event.Branch, event.MemberID = e.Hold, e.Hold.Branch, e.Hold.MemberID
+	default:
+		return nil
+	}
+
+	var err error
+	if event.Data, err = json.Marshal(payload); err != nil {
+		return err
+	}
+	Webhooks.Publish(Events.Publish(event))
+	return nil
+}
+
+// StreamEventsHandler streams events as Server-Sent Events, optionally
+// only those of the listed types, at a branch or concerning a member.
+// Only events the caller is allowed to read are sent. A client
+// reconnecting with Last-Event-ID, or last_event_id, is first sent the
+// matching events it missed; when some have already left the buffer it is
+// sent a reset event, telling it to reload what it shows.
+func StreamEventsHandler(c *gin.Context) {
+	var types []string
+	if param := c.Query("type"); param != "" {
+		types = strings.Split(param, ",")
+		if err := checkEventTypes(types); err != nil {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+	branch, memberID := c.Query("branch"), c.Query("member_id")
+	after := -1
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+	if lastID != "" {
+		var err error
+		if after, err = strconv.Atoi(lastID); err != nil || after < 0 {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid last event ID"})
+			return
+		}
+	}
+
+	principal, _ := authenticate(c)
+	sub, missed, complete := Events.Subscribe(eventMatcher(types, branch, memberID, principal), after)
+	defer Events.Unsubscribe(sub)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	if !complete {
+		c.Render(-1, sse.Event{Event: "reset", Data: gin.H{"reason": "Events since " + lastID + " are no longer available"}})
+	}
+	for _, event := range missed {
+		c.Render(-1, eventMessage(event))
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-sub.Events:
+			if !ok {
+				// Too slow to keep up; the client reconnects and resumes
+				return false
+			}
+			c.Render(-1, eventMessage(event))
+		case now := <-heartbeat.C:
+			c.Render(-1, sse.Event{Event: "heartbeat", Data: now.UTC().Format(time.RFC3339)})
+		}
+		return true
+	})
+}
+
+// checkEventTypes refuses event types that are not streamed
+func checkEventTypes(types []string) error {
+	for _, eventType := range types {
+		if _, ok := eventPermissions[eventType]; !ok {
+			return errors.New("Unknown event " + eventType)
+		}
+	}
+	return nil
+}
+
+// eventMatcher matches the events of the listed types, or any type, at a
+// branch and concerning a member, when given, that the principal may read
+func eventMatcher(types []string, branch, memberID string, principal auth.Principal) func(data.Event) bool {
+	return func(event data.Event) bool {
+		return (len(types) == 0 || containsString(types, event.Type)) &&
+			(branch == "" || event.Branch == branch) &&
+			(memberID == "" || event.MemberID == memberID) &&
+			principal.Can(eventPermissions[event.Type])
+	}
+}
+
+func eventMessage(event data.Event) sse.Event {
+	return sse.Event{Id: strconv.Itoa(event.ID), Event: event.Type, Data: event}
+}
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+func CreateGenreHandler(c *gin.Context) {
+	var newGenre data.Genre
+	if err := c.ShouldBindJSON(&newGenre); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if data.NormalizeGenreName(newGenre.Name) == "" {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Genre name is required"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	if newGenre.ParentID != nil {
+		if _, ok := data.InMemoryDB.Genres[*newGenre.ParentID]; !ok {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Parent genre not found"})
+			return
+		}
+	}
+
+	newGenre.ID = data.InMemoryDB.NextGenreID
+	if err := checkGenreNames(newGenre); err != nil {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: err.Error()})
+		return
+	}
+	data.InMemoryDB.NextGenreID++
+
+	storeGenre(newGenre)
+	recordAudit(c, "create", EntityGenre, newGenre.ID, nil, newGenre)
+
+	c.JSON(http.StatusOK, newGenre)
+}
+
+// GetGenreTreeHandler returns the whole taxonomy as a forest of root nodes
+func GetGenreTreeHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	c.JSON(http.StatusOK, genreChildren(nil))
+}
+
+func GetGenreByIDHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid genre ID"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	genre, ok := data.InMemoryDB.Genres[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Genre not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, data.GenreNode{Genre: genre, Children: genreChildren(&id)})
+}
+
+// GetGenreBooksHandler lists books tagged with a genre or any of its
+// descendants. The genre is given by ID or by any of its names.
+func GetGenreBooksHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	var genre data.Genre
+	var ok bool
+	if idParam := c.Query("id"); idParam != "" {
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid genre ID"})
+			return
+		}
+		genre, ok = data.InMemoryDB.Genres[id]
+	} else {
+		genre, ok = resolveGenre(c.Query("name"))
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Genre not found"})
+		return
+	}
+
+	subtree := genreDescendants(genre.ID)
+	books := []data.Book{}
+	for _, book := range data.InMemoryDB.Books {
+		if bookInGenres(book, subtree) {
+			books = append(books, book)
+		}
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].ID < books[j].ID })
+
+	c.JSON(http.StatusOK, books)
+}
+
+// RenameGenreHandler changes a genre's name. The old name is kept as an
+// alias so searches using it still resolve to the genre, and books tagged
+// with the genre show the new name.
+func RenameGenreHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid genre ID"})
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if data.NormalizeGenreName(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Genre name is required"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	genre, ok := data.InMemoryDB.Genres[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Genre not found"})
+		return
+	}
+
+	renamed := genre
+	renamed.Aliases = append([]string{genre.Name}, genre.Aliases...)
+	renamed.Name = strings.TrimSpace(req.Name)
+	if err := checkGenreNames(renamed); err != nil {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	storeGenre(renamed)
+	recordAudit(c, "rename", EntityGenre, id, genre, renamed)
+	relabelGenreBooks(eventContext(c), id, nil)
+
+	c.JSON(http.StatusOK, renamed)
+}
+
+// MoveGenreHandler re-parents a genre. An empty parent_id makes it a root.
+func MoveGenreHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid genre ID"})
+		return
+	}
+
+	var parentID *int
+	if parentParam := c.Query("parent_id"); parentParam != "" {
+		parent, err := strconv.Atoi(parentParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid parent genre ID"})
+			return
+		}
+		parentID = &parent
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	genre, ok := data.InMemoryDB.Genres[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Genre not found"})
+		return
+	}
+	if parentID != nil {
+		if _, ok := data.InMemoryDB.Genres[*parentID]; !ok {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Parent genre not found"})
+			return
+		}
+		if genreDescendants(id)[*parentID] {
+			c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Cannot move a genre beneath itself"})
+			return
+		}
+	}
+
+	before := genre
+	genre.ParentID = parentID
+	data.InMemoryDB.Genres[id] = genre
+	recordAudit(c, "move", EntityGenre, id, before, genre)
+
+	c.JSON(http.StatusOK, genre)
+}
+
+// MergeGenreHandler folds one genre into another: books are re-tagged,
+// children are re-parented and the merged names become aliases. Books show
+// the target genre's name from then on.
+func MergeGenreHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid genre ID"})
+		return
+	}
+	intoID, err := strconv.Atoi(c.Query("into"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid target genre ID"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	genre, ok := data.InMemoryDB.Genres[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Genre not found"})
+		return
+	}
+	into, ok := data.InMemoryDB.Genres[intoID]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Target genre not found"})
+		return
+	}
+	if genreDescendants(id)[intoID] {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Cannot merge a genre into itself or its descendants"})
+		return
+	}
+
+	for childID, child := range data.InMemoryDB.Genres {
+		if child.ParentID != nil && *child.ParentID == id {
+			child.ParentID = &intoID
+			data.InMemoryDB.Genres[childID] = child
+		}
+	}
+
+	delete(data.InMemoryDB.Genres, id)
+	before := into
+	into.Aliases = append(append(into.Aliases, genre.Name), genre.Aliases...)
+	storeGenre(into)
+	recordAudit(c, "merge", EntityGenre, id, genre, nil)
+	recordAudit(c, "merge", EntityGenre, intoID, before, into)
+	relabelGenreBooks(eventContext(c), id, func(genreIDs []int) []int {
+		var retagged []int
+		for _, genreID := range genreIDs {
+			if genreID == id {
+				genreID = intoID
+			}
+			if !containsInt(retagged, genreID) {
+				retagged = append(retagged, genreID)
+			}
+		}
+		return retagged
+	})
+
+	c.JSON(http.StatusOK, into)
+}
+
+// relabelGenreBooks refreshes the genre shown by every book tagged with a
+// renamed or merged genre, as updating an author refreshes the author
+// shown, first re-tagging the books with retag when it is given. Each
+// changed book gets a new version and a BookUpdated event.
+// The caller must hold the database lock.
+func relabelGenreBooks(ctx context.Context, genreID int, retag func([]int) []int) {
+	var ids []int
+	for bookID, book := range data.InMemoryDB.Books {
+		if containsInt(book.GenreIDs, genreID) {
+			ids = append(ids, bookID)
+		}
+	}
+	sort.Ints(ids)
+
+	for _, bookID := range ids {
+		old := data.InMemoryDB.Books[bookID]
+		book := old
+		if retag != nil {
+			book.GenreIDs = retag(old.GenreIDs)
+		}
+		book.Genre = genreLabel(book)
+		if book.Genre == old.Genre && slices.Equal(book.GenreIDs, old.GenreIDs) {
+			continue
+		}
+		data.InMemoryDB.Books[bookID] = book
+		recordVersion(ctx, data.InMemoryDB.BookVersions, bookID, "update", book)
+		bus.Publish(ctx, data.BookUpdated{Before: old, After: book})
+	}
+}
+
+// genreLabel is the genre a book shows: the current name of the tagged
+// genre its text names, so that old names and aliases follow renames and
+// merges, or else the name of its first genre.
+// The caller must hold the database lock.
+func genreLabel(book data.Book) string {
+	if genre, ok := resolveGenre(book.Genre); ok && containsInt(book.GenreIDs, genre.ID) {
+		return genre.Name
+	}
+	return data.InMemoryDB.Genres[book.GenreIDs[0]].Name
+}
+
+// resolveGenre finds the genre owning the given name or alias.
+// The caller must hold the database lock.
+func resolveGenre(name string) (data.Genre, bool) {
+	id, ok := data.InMemoryDB.GenreNames[data.NormalizeGenreName(name)]
+	if !ok {
+		return data.Genre{}, false
+	}
+	genre, ok := data.InMemoryDB.Genres[id]
+	return genre, ok
+}
+
+// checkGenreNames rejects a genre whose names already belong to a
+// different genre. The caller must hold the database lock.
+func checkGenreNames(genre data.Genre) error {
+	for _, key := range genre.NameKeys() {
+		if owner, ok := data.InMemoryDB.GenreNames[key]; ok && owner != genre.ID {
+			return fmt.Errorf("Name %q already belongs to genre %d", key, owner)
+		}
+	}
+	return nil
+}
+
+// storeGenre saves the genre and indexes its names.
+// The caller must hold the database lock.
+func storeGenre(genre data.Genre) {
+	data.InMemoryDB.Genres[genre.ID] = genre
+	for _, key := range genre.NameKeys() {
+		data.InMemoryDB.GenreNames[key] = genre.ID
+	}
+}
+
+// genreChildren builds the subtrees below the given parent, or the roots
+// when parent is nil. The caller must hold the database lock.
+func genreChildren(parentID *int) []data.GenreNode {
+	nodes := []data.GenreNode{}
+	for _, genre := range data.InMemoryDB.Genres {
+		if (parentID == nil && genre.ParentID == nil) ||
+			(parentID != nil && genre.ParentID != nil && *genre.ParentID == *parentID) {
+			id := genre.ID
+			nodes = append(nodes, data.GenreNode{Genre: genre, Children: genreChildren(&id)})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes
+}
+
+// genreDescendants returns the set of IDs in the subtree rooted at the
+// genre, including the genre itself. The caller must hold the database lock.
+func genreDescendants(id int) map[int]bool {
+	subtree := map[int]bool{id: true}
+	for grew := true; grew; {
+		grew = false
+		for _, genre := range data.InMemoryDB.Genres {
+			if genre.ParentID != nil && subtree[*genre.ParentID] && !subtree[genre.ID] {
+				subtree[genre.ID] = true
+				grew = true
+			}
+		}
+	}
+	return subtree
+}
+
+func bookInGenres(book data.Book, genres map[int]bool) bool {
+	for _, id := range book.GenreIDs {
+		if genres[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// linkBookGenres tags the book with taxonomy nodes. Explicit genre IDs must
+// exist; otherwise a free-text genre matching a genre name or alias is
+// tagged. The caller must hold the database lock.
+func linkBookGenres(book *data.Book) error {
+	if len(book.GenreIDs) == 0 {
+		if genre, ok := resolveGenre(book.Genre); ok {
+			book.GenreIDs = []int{genre.ID}
+		}
+	}
+
+	for _, id := range book.GenreIDs {
+		if _, ok := data.InMemoryDB.Genres[id]; !ok {
+			return fmt.Errorf("Genre %d not found", id)
+		}
+	}
+	if book.Genre == "" && len(book.GenreIDs) > 0 {
+		book.Genre = data.InMemoryDB.Genres[book.GenreIDs[0]].Name
+	}
+	return nil
+}
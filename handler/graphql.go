@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/circulation"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// GraphQLMaxDepth is how deeply a GraphQL query may nest fields
+var GraphQLMaxDepth = 10
+
+// GraphQLMaxComplexity caps the estimated cost of a GraphQL query. Each
+// field costs one, and the fields under a paginated field cost once for
+// every item it may return.
+var GraphQLMaxComplexity = 5000
+
+// GraphQLRequest is a GraphQL query or mutation
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphqlSchema builds the schema the first time it is needed
+var graphqlSchema = sync.OnceValues(newGraphQLSchema)
+
+// graphqlRequest is what resolvers know about the request they run in
+type graphqlRequest struct {
+	c         *gin.Context
+	principal auth.Principal
+	loaders   *loaders
+}
+
+type graphqlKey struct{}
+
+// requestFrom returns the request a resolver runs in
+func requestFrom(p graphql.ResolveParams) *graphqlRequest {
+	return p.Context.Value(graphqlKey{}).(*graphqlRequest)
+}
+
+// GraphQLHandler runs a GraphQL query or mutation for a staff caller. Each
+// field needs the same permission as the REST route that reads or changes
+// the same data. Queries that nest too deeply or would cost too much are
+// refused before they run.
+func GraphQLHandler(c *gin.Context) {
+	principal, ok := authenticate(c)
+	if !ok {
+		return
+	}
+
+	var req GraphQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Missing query"})
+		return
+	}
+
+	schema, err := graphqlSchema()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Internal server error"})
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	if validation := graphql.ValidateDocument(&schema, doc, nil); !validation.IsValid {
+		c.JSON(http.StatusBadRequest, graphql.Result{Errors: validation.Errors})
+		return
+	}
+	if err := checkQueryLimits(doc, req.OperationName, req.Variables); err != nil {
+		c.JSON(http.StatusBadRequest, graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	ctx := context.WithValue(eventContext(c), graphqlKey{}, &graphqlRequest{
+		c:         c,
+		principal: principal,
+		loaders:   newLoaders(),
+	})
+	c.JSON(http.StatusOK, graphql.Execute(graphql.ExecuteParams{
+		Schema:        schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	}))
+}
+
+// checkQueryLimits refuses an operation that nests deeper than
+// GraphQLMaxDepth or costs more than GraphQLMaxComplexity. An operation
+// that cannot be found is left for the executor to report.
+func checkQueryLimits(doc *ast.Document, operationName string, variables map[string]any) error {
+	cost := queryCost{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+		defaults:  make(map[string]ast.Value),
+	}
+	var operation *ast.OperationDefinition
+	operations := 0
+	for _, definition := range doc.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			cost.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			operations++
+			if operationName == "" || (definition.Name != nil && definition.Name.Value == operationName) {
+				operation = definition
+			}
+		}
+	}
+	if operation == nil || (operationName == "" && operations > 1) {
+		return nil
+	}
+	for _, definition := range operation.VariableDefinitions {
+		if definition.DefaultValue != nil {
+			cost.defaults[definition.Variable.Name.Value] = definition.DefaultValue
+		}
+	}
+
+	depth, complexity := cost.measure(operation.SelectionSet)
+	if depth > GraphQLMaxDepth {
+		return fmt.Errorf("Query depth %d exceeds the limit of %d", depth, GraphQLMaxDepth)
+	}
+	if complexity > GraphQLMaxComplexity {
+		return fmt.Errorf("Query complexity %d exceeds the limit of %d", complexity, GraphQLMaxComplexity)
+	}
+	return nil
+}
+
+// queryCost measures an operation for the query limits
+type queryCost struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+	defaults  map[string]ast.Value
+}
+
+// measure returns how deeply a selection set nests and what it costs.
+// Only __typename is free; introspection fields are measured like any
+// other, as nested fragments can make them as costly. Fragment cycles have already been refused by validation.
+func (q queryCost) measure(set *ast.SelectionSet) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, selection := range set.Selections {
+		var d, n int
+		switch s := selection.(type) {
+		case *ast.Field:
+			if s.Name.Value == "__typename" {
+				continue
+			}
+			d, n = q.measure(s.SelectionSet)
+			d++
+			n = 1 + min(n*q.pageSize(s), math.MaxInt32)
+		case *ast.InlineFragment:
+			d, n = q.measure(s.SelectionSet)
+		case *ast.FragmentSpread:
+			if fragment, ok := q.fragments[s.Name.Value]; ok {
+				d, n = q.measure(fragment.SelectionSet)
+			}
+		}
+		depth = max(depth, d)
+		complexity = min(complexity+n, math.MaxInt32)
+	}
+	return depth, complexity
+}
+
+// pageSize is how many items a field may return: its first argument, or
+// the default, for a paginated field, and one for any other field. The
+// argument is read the way the executor will coerce it, from a variable,
+// the variable's default or a literal, and a value that cannot be read
+// counts as the largest page. Page sizes out of range are refused when
+// the field is resolved.
+func (q queryCost) pageSize(field *ast.Field) int {
+	if !paginatedFields[field.Name.Value] {
+		return 1
+	}
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		var first any
+		if variable, ok := arg.Value.(*ast.Variable); ok {
+			if value, ok := q.variables[variable.Name.Value]; ok {
+				first = graphql.Int.ParseValue(value)
+			} else if value, ok := q.defaults[variable.Name.Value]; ok {
+				first = graphql.Int.ParseLiteral(value)
+			} else {
+				return defaultPageSize
+			}
+		} else {
+			first = graphql.Int.ParseLiteral(arg.Value)
+		}
+		if first, ok := first.(int); ok {
+			return max(0, min(first, maxPageSize))
+		}
+		return maxPageSize
+	}
+	return defaultPageSize
+}
+
+// graphqlError is an error a resolver reports, with a code in its
+// extensions so that clients need not match on messages
+type graphqlError struct {
+	message    string
+	code       string
+	violations []data.RuleViolation
+}
+
+func (e *graphqlError) Error() string {
+	return e.message
+}
+
+func (e *graphqlError) Extensions() map[string]any {
+	extensions := map[string]any{"code": e.code}
+	if e.violations != nil {
+		extensions["violations"] = e.violations
+	}
+	return extensions
+}
+
+// resolverError reports an error with the code for the response status
+// the REST API would have answered with. Internal errors are logged and
+// not described.
+func resolverError(req *graphqlRequest, status int, err error) error {
+	if status == http.StatusInternalServerError {
+		req.c.Error(err)
+		err = errors.New("Internal server error")
+	}
+	e := &graphqlError{
+		message: err.Error(),
+		code:    errorCode(status),
+	}
+	var policy *circulation.PolicyError
+	if errors.As(err, &policy) {
+		e.violations = policy.Violations
+	}
+	return e
+}
+
+// errorCode names a response status as an error code, such as NOT_FOUND
+func errorCode(status int) string {
+	return strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
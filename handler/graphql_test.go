@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+func TestCheckQueryLimits(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("{ book ", depth) + strings.Repeat("}", depth)
+	}
+	// Each fragment spreads the next one twice, so the query doubles in
+	// size with every level once the fragments are expanded
+	chained := func(levels int) string {
+		var query strings.Builder
+		query.WriteString("{ __schema { types { ...T1 } } }")
+		for n := 1; n < levels; n++ {
+			fmt.Fprintf(&query, " fragment T%d on __Type { fields { type { ...T%d ofType { ...T%d } } } }", n, n+1, n+1)
+		}
+		fmt.Fprintf(&query, " fragment T%d on __Type { name }", levels)
+		return query.String()
+	}
+	tests := []struct {
+		name      string
+		query     string
+		operation string
+		variables map[string]any
+		wantErr   string
+	}{
+		{name: "default page size", query: `{ books { title author } }`},
+		{name: "deepest allowed", query: nested(10)},
+		{name: "too deep", query: nested(11), wantErr: "Query depth 11 exceeds the limit of 10"},
+		{
+			name:  "nested pages multiply",
+			query: `{ members(first: 50) { loans(first: 50) { id } } }`,
+		},
+		{
+			name:    "nested pages over the limit",
+			query:   `{ members(first: 100) { loans(first: 100) { id } } }`,
+			wantErr: "Query complexity 10101 exceeds the limit of 5000",
+		},
+		{
+			name:    "page size above the maximum counts as the maximum",
+			query:   `{ members(first: 1000) { loans(first: 1000) { id } } }`,
+			wantErr: "Query complexity 10101 exceeds the limit of 5000",
+		},
+		{
+			name:  "negative page size costs nothing underneath",
+			query: `{ members(first: -5) { loans(first: 100) { id } } }`,
+		},
+		{
+			name:      "page size from a variable",
+			query:     `query($n: Int) { members(first: $n) { loans(first: $n) { id } } }`,
+			variables: map[string]any{"n": float64(10)},
+		},
+		{
+			name:      "page size from a variable over the limit",
+			query:     `query($n: Int) { members(first: $n) { loans(first: $n) { id } } }`,
+			variables: map[string]any{"n": float64(100)},
+			wantErr:   "Query complexity 10101 exceeds the limit of 5000",
+		},
+		{
+			name:    "page size from a variable's default",
+			query:   `query($n: Int = 100) { members(first: $n) { loans(first: $n) { id } } }`,
+			wantErr: "Query complexity 10101 exceeds the limit of 5000",
+		},
+		{
+			name:      "page size from a variable given as a string",
+			query:     `query($n: Int) { members(first: $n) { loans(first: $n) { id } } }`,
+			variables: map[string]any{"n": "100"},
+			wantErr:   "Query complexity 10101 exceeds the limit of 5000",
+		},
+		{
+			name:      "page size that cannot be read counts as the largest",
+			query:     `query($n: Int) { members(first: $n) { loans(first: $n) { id } } }`,
+			variables: map[string]any{"n": "many"},
+			wantErr:   "Query complexity 10101 exceeds the limit of 5000",
+		},
+		{
+			name:  "page size from a variable left out",
+			query: `query($n: Int) { members(first: $n) { loans(first: $n) { id } } }`,
+		},
+		{
+			name:    "fragment spread",
+			query:   `{ ...heavy } fragment heavy on Query { members(first: 100) { loans(first: 100) { id } } }`,
+			wantErr: "Query complexity 10101 exceeds the limit of 5000",
+		},
+		{
+			name:    "inline fragment",
+			query:   `{ ... on Query { members(first: 100) { loans(first: 100) { id } } } }`,
+			wantErr: "Query complexity 10101 exceeds the limit of 5000",
+		},
+		{name: "__typename is free", query: strings.Repeat("{ book ", 10) + "{ __typename }" + strings.Repeat("}", 10)},
+		{name: "introspection is measured", query: `{ __schema { types { name fields { name type { name ofType { name ofType { name ofType { name ofType { name ofType { name ofType { name } } } } } } } } } } }`, wantErr: "Query depth 11 exceeds the limit of 10"},
+		{name: "chained introspection fragments", query: chained(9), wantErr: "Query depth 27 exceeds the limit of 10"},
+		{
+			name:      "named operation",
+			query:     `query cheap { books { title } } query heavy { members(first: 100) { loans(first: 100) { id } } }`,
+			operation: "cheap",
+		},
+		{
+			name:      "other named operation",
+			query:     `query cheap { books { title } } query heavy { members(first: 100) { loans(first: 100) { id } } }`,
+			operation: "heavy",
+			wantErr:   "Query complexity 10101 exceeds the limit of 5000",
+		},
+		{
+			name:  "ambiguous operation is left to the executor",
+			query: `query cheap { books { title } } query heavy { members(first: 100) { loans(first: 100) { id } } }`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(tt.query)})})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = checkQueryLimits(doc, tt.operation, tt.variables)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("checkQueryLimits() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("checkQueryLimits() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
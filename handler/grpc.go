@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/circulation"
+	"github.com/jerrylovee2/gogo/data"
+	libraryv1 "github.com/jerrylovee2/gogo/proto/library/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// rpcPermissions is the permission each catalog and circulation method
+// needs, as the matching REST route does. Every caller must authenticate;
+// an empty permission lets any authenticated caller in. Methods not listed
+// belong to the health and reflection services, which are open.
+var rpcPermissions = map[string]string{
+	libraryv1.CatalogService_GetBook_FullMethodName:     "",
+	libraryv1.CatalogService_SearchBooks_FullMethodName: "",
+	libraryv1.CatalogService_CreateBook_FullMethodName:  auth.CatalogWrite,
+	libraryv1.CatalogService_UpdateBook_FullMethodName:  auth.CatalogWrite,
+
+	libraryv1.CirculationService_GetLoan_FullMethodName:    auth.CirculationRead,
+	libraryv1.CirculationService_Checkout_FullMethodName:   auth.CirculationWrite,
+	libraryv1.CirculationService_Renew_FullMethodName:      auth.CirculationWrite,
+	libraryv1.CirculationService_Return_FullMethodName:     auth.CirculationWrite,
+	libraryv1.CirculationService_PlaceHold_FullMethodName:  auth.CirculationWrite,
+	libraryv1.CirculationService_CancelHold_FullMethodName: auth.CirculationWrite,
+	// Each event is checked against the permission to read it
+	libraryv1.CirculationService_StreamEvents_FullMethodName: "",
+}
+
+// rpcRateLimitMethods puts methods outside the default rate limit group,
+// as rateLimitRoutes does for routes
+var rpcRateLimitMethods = map[string]string{
+	libraryv1.CatalogService_SearchBooks_FullMethodName: LimitSearch,
+}
+
+// NewGRPCServer returns a gRPC server for the catalog and circulation
+// services, with the health service and server reflection. Callers
+// authenticate with a staff bearer token in authorization metadata or an
+// API key in x-api-key metadata. Calls to the catalog and circulation
+// services are rate limited like the REST routes.
+func NewGRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := rpcRateLimit(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			ctx, err := rpcAuthenticate(ctx, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := rpcRateLimit(ss.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			ctx, err := rpcAuthenticate(ss.Context(), info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, authenticatedStream{ServerStream: ss, ctx: ctx})
+		}),
+	)
+	libraryv1.RegisterCatalogServiceServer(server, catalogServer{})
+	libraryv1.RegisterCirculationServiceServer(server, circulationServer{})
+
+	healthServer := health.NewServer()
+	for name := range server.GetServiceInfo() {
+		healthServer.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(server, healthServer)
+	reflection.Register(server)
+	return server
+}
+
+type rpcPrincipalKey struct{}
+
+// authenticatedStream carries the caller in its context
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// rpcAuthenticate resolves the caller of a method from its metadata and
+// checks the method's permission. The context returned carries the caller
+// for the events and audit entries the call leads to.
+func rpcAuthenticate(ctx context.Context, method string) (context.Context, error) {
+	permission, ok := rpcPermissions[method]
+	if !ok {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var principal auth.Principal
+	var err error
+	if key := firstValue(md, "x-api-key"); key != "" {
+		principal, err = apiKeyPrincipal(key, peerIP(ctx))
+	} else if token, ok := strings.CutPrefix(firstValue(md, "authorization"), "Bearer "); ok && token != "" {
+		principal, err = tokenPrincipal(token)
+	} else {
+		return nil, status.Error(codes.Unauthenticated, "Missing bearer token")
+	}
+	switch {
+	case errors.Is(err, errAPIKeyAddress):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if permission != "" && !principal.Can(permission) {
+		return nil, status.Error(codes.PermissionDenied, "Missing permission "+permission)
+	}
+
+	ctx = context.WithValue(ctx, rpcPrincipalKey{}, principal)
+	return bus.WithMeta(ctx, bus.Meta{
+		Actor:     principal.Kind + ":" + principal.ID,
+		ActorName: principal.Name,
+		RequestID: requestID(firstValue(md, "x-request-id")),
+	}), nil
+}
+
+// rpcRateLimit takes a token from the caller's bucket for a catalog or
+// circulation method's group, refusing the call with ResourceExhausted and
+// a RetryInfo detail when it is empty. A stream takes one token when it
+// opens. If the store fails the call is let through.
+func rpcRateLimit(ctx context.Context, method string) error {
+	if _, ok := rpcPermissions[method]; !ok || RateLimits == nil {
+		return nil
+	}
+	group, ok := rpcRateLimitMethods[method]
+	if !ok {
+		group = LimitDefault
+	}
+	limit := RateLimitGroups[group]
+	if limit.Unlimited() {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	client := rateLimitKey(firstValue(md, "x-api-key"), firstValue(md, "authorization"), peerIP(ctx))
+	result, err := RateLimits.Take(ctx, group+"|"+client, limit)
+	if err != nil {
+		log.Printf("grpc: %v", err)
+		return nil
+	}
+	if result.Allowed {
+		return nil
+	}
+	st := status.New(codes.ResourceExhausted, "Too many requests")
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(result.RetryAfter)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// rpcPrincipal returns the caller rpcAuthenticate resolved
+func rpcPrincipal(ctx context.Context) auth.Principal {
+	principal, _ := ctx.Value(rpcPrincipalKey{}).(auth.Principal)
+	return principal
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// peerIP is the address a call came from, which API keys may be limited to
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// rpcError is the gRPC status for an error the REST API would answer with
+// httpStatus. Policy violations are attached as a PreconditionFailure, and
+// internal errors are logged and not described.
+func rpcError(httpStatus int, err error) error {
+	var code codes.Code
+	switch httpStatus {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.FailedPrecondition
+	default:
+		log.Printf("grpc: %v", err)
+		return status.Error(codes.Internal, "Internal server error")
+	}
+
+	st := status.New(code, err.Error())
+	var policy *circulation.PolicyError
+	if errors.As(err, &policy) {
+		failure := &errdetails.PreconditionFailure{}
+		for _, violation := range policy.Violations {
+			failure.Violations = append(failure.Violations, &errdetails.PreconditionFailure_Violation{
+				Type:        violation.Rule,
+				Description: violation.Message,
+			})
+		}
+		if detailed, err := st.WithDetails(failure); err == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+// catalogServer serves CatalogService
+type catalogServer struct {
+	libraryv1.UnimplementedCatalogServiceServer
+}
+
+func (catalogServer) GetBook(ctx context.Context, req *libraryv1.GetBookRequest) (*libraryv1.GetBookResponse, error) {
+	data.InMemoryDB.RLock()
+	book, ok := data.InMemoryDB.Books[int(req.GetId())]
+	data.InMemoryDB.RUnlock()
+
+	if !ok {
+		return nil, rpcError(http.StatusNotFound, errBookNotFound)
+	}
+	return &libraryv1.GetBookResponse{Book: bookToProto(book)}, nil
+}
+
+func (catalogServer) SearchBooks(req *libraryv1.SearchBooksRequest, stream libraryv1.CatalogService_SearchBooksServer) error {
+	callRange, err := parseCallNumberRange(req.GetScheme(), req.GetCallNumberFrom(), req.GetCallNumberTo())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	data.InMemoryDB.RLock()
+	books := searchBooks(bookSearch{
+		Title:     req.GetTitle(),
+		Author:    req.GetAuthor(),
+		Genre:     req.GetGenre(),
+		Year:      int(req.GetYear()),
+		Branch:    req.GetBranch(),
+		CallRange: callRange,
+	})
+	data.InMemoryDB.RUnlock()
+
+	for _, book := range books {
+		if err := stream.Send(&libraryv1.SearchBooksResponse{Book: bookToProto(book)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (catalogServer) CreateBook(ctx context.Context, req *libraryv1.CreateBookRequest) (*libraryv1.CreateBookResponse, error) {
+	book, err := createBook(ctx, bookFromProto(req.GetBook()))
+	if err != nil {
+		return nil, rpcError(changeStatus(err), err)
+	}
+	return &libraryv1.CreateBookResponse{Book: bookToProto(book)}, nil
+}
+
+func (catalogServer) UpdateBook(ctx context.Context, req *libraryv1.UpdateBookRequest) (*libraryv1.UpdateBookResponse, error) {
+	book, err := updateBook(ctx, int(req.GetId()), bookFromProto(req.GetBook()))
+	if err != nil {
+		return nil, rpcError(changeStatus(err), err)
+	}
+	return &libraryv1.UpdateBookResponse{Book: bookToProto(book)}, nil
+}
+
+// circulationServer serves CirculationService
+type circulationServer struct {
+	libraryv1.UnimplementedCirculationServiceServer
+}
+
+func (circulationServer) GetLoan(ctx context.Context, req *libraryv1.GetLoanRequest) (*libraryv1.GetLoanResponse, error) {
+	data.InMemoryDB.RLock()
+	loan, ok := data.InMemoryDB.Borrowers[int(req.GetId())]
+	data.InMemoryDB.RUnlock()
+
+	if !ok {
+		return nil, rpcError(http.StatusNotFound, circulation.ErrLoanNotFound)
+	}
+	return &libraryv1.GetLoanResponse{Loan: loanToProto(loan)}, nil
+}
+
+func (circulationServer) Checkout(ctx context.Context, req *libraryv1.CheckoutRequest) (*libraryv1.CheckoutResponse, error) {
+	loan, err := circulation.Checkout(ctx, req.GetMemberId(), int(req.GetBookId()), time.Now())
+	if err != nil {
+		return nil, rpcError(circulationStatus(err), err)
+	}
+	return &libraryv1.CheckoutResponse{Loan: loanToProto(loan)}, nil
+}
+
+func (circulationServer) Renew(ctx context.Context, req *libraryv1.RenewRequest) (*libraryv1.RenewResponse, error) {
+	loan, err := circulation.Renew(ctx, int(req.GetLoanId()), time.Now())
+	if err != nil {
+		return nil, rpcError(circulationStatus(err), err)
+	}
+	return &libraryv1.RenewResponse{Loan: loanToProto(loan)}, nil
+}
+
+func (circulationServer) Return(ctx context.Context, req *libraryv1.ReturnRequest) (*libraryv1.ReturnResponse, error) {
+	loan, fine, err := circulation.Return(ctx, int(req.GetLoanId()), time.Now())
+	if err != nil {
+		return nil, rpcError(circulationStatus(err), err)
+	}
+	resp := &libraryv1.ReturnResponse{Loan: loanToProto(loan)}
+	if fine != nil {
+		resp.Fine = fineToProto(*fine)
+	}
+	return resp, nil
+}
+
+func (circulationServer) PlaceHold(ctx context.Context, req *libraryv1.PlaceHoldRequest) (*libraryv1.PlaceHoldResponse, error) {
+	hold, err := circulation.PlaceHold(ctx, req.GetMemberId(), int(req.GetBookId()), time.Now())
+	if err != nil {
+		return nil, rpcError(circulationStatus(err), err)
+	}
+	return &libraryv1.PlaceHoldResponse{Hold: holdToProto(hold)}, nil
+}
+
+func (circulationServer) CancelHold(ctx context.Context, req *libraryv1.CancelHoldRequest) (*libraryv1.CancelHoldResponse, error) {
+	hold, err := circulation.CancelHold(ctx, int(req.GetHoldId()), time.Now())
+	if err != nil {
+		return nil, rpcError(circulationStatus(err), err)
+	}
+	return &libraryv1.CancelHoldResponse{Hold: holdToProto(hold)}, nil
+}
+
+// StreamEvents sends events as StreamEventsHandler does. A client that
+// falls too far behind is cut off with UNAVAILABLE and should resume from
+// the last event it received.
+func (circulationServer) StreamEvents(req *libraryv1.StreamEventsRequest, stream libraryv1.CirculationService_StreamEventsServer) error {
+	if err := checkEventTypes(req.GetTypes()); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	after := -1
+	if req.ResumeAfter != nil {
+		if req.GetResumeAfter() < 0 {
+			return status.Error(codes.InvalidArgument, "Invalid last event ID")
+		}
+		after = int(req.GetResumeAfter())
+	}
+
+	ctx := stream.Context()
+	match := eventMatcher(req.GetTypes(), req.GetBranch(), req.GetMemberId(), rpcPrincipal(ctx))
+	sub, missed, complete := Events.Subscribe(match, after)
+	defer Events.Unsubscribe(sub)
+
+	if !complete {
+		incomplete := &libraryv1.ReplayIncomplete{Reason: "Events since " + strconv.Itoa(after) + " are no longer available"}
+		if err := stream.Send(&libraryv1.StreamEventsResponse{
+			Message: &libraryv1.StreamEventsResponse_ReplayIncomplete{ReplayIncomplete: incomplete},
+		}); err != nil {
+			return err
+		}
+	}
+	for _, event := range missed {
+		if err := stream.Send(eventToProto(event)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case event, ok := <-sub.Events:
+			if !ok {
+				return status.Error(codes.Unavailable, "Too far behind; resume from the last event received")
+			}
+			if err := stream.Send(eventToProto(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func bookToProto(book data.Book) *libraryv1.Book {
+	return &libraryv1.Book{
+		Id:               int64(book.ID),
+		UniqueId:         book.UniqueID,
+		Title:            book.Title,
+		Author:           book.Author,
+		AuthorIds:        int64s(book.AuthorIDs),
+		Genre:            book.Genre,
+		GenreIds:         int64s(book.GenreIDs),
+		Year:             int32(book.Year),
+		CallNumber:       book.CallNumber,
+		CallNumberScheme: book.CallNumberScheme,
+		Branch:           book.Branch,
+		DigitalCopies:    digitalCopiesToProto(book.DigitalCopies),
+	}
+}
+
+func bookFromProto(book *libraryv1.BookInput) data.Book {
+	return data.Book{
+		Title:            book.GetTitle(),
+		Author:           book.GetAuthor(),
+		AuthorIDs:        ints(book.GetAuthorIds()),
+		Genre:            book.GetGenre(),
+		GenreIDs:         ints(book.GetGenreIds()),
+		Year:             int(book.GetYear()),
+		CallNumber:       book.GetCallNumber(),
+		CallNumberScheme: book.GetCallNumberScheme(),
+		Branch:           book.GetBranch(),
+		DigitalCopies:    digitalCopiesFromProto(book.GetDigitalCopies()),
+	}
+}
+
+func digitalCopiesToProto(copies []data.DigitalCopy) []*libraryv1.DigitalCopy {
+	var result []*libraryv1.DigitalCopy
+	for _, digital := range copies {
+		result = append(result, &libraryv1.DigitalCopy{Url: digital.URL, MediaType: digital.MediaType})
+	}
+	return result
+}
+
+func digitalCopiesFromProto(copies []*libraryv1.DigitalCopy) []data.DigitalCopy {
+	var result []data.DigitalCopy
+	for _, digital := range copies {
+		result = append(result, data.DigitalCopy{URL: digital.GetUrl(), MediaType: digital.GetMediaType()})
+	}
+	return result
+}
+
+func loanToProto(loan data.Borrower) *libraryv1.Loan {
+	return &libraryv1.Loan{
+		Id:       int64(loan.ID),
+		MemberId: loan.MemberID,
+		BookId:   int64(loan.BookID),
+		Borrowed: timestamppb.New(loan.Borrowed),
+		DueDate:  timestamppb.New(loan.DueDate),
+		Renewals: int32(loan.Renewals),
+		Returned: optionalTimestamp(loan.Returned),
+		Lost:     optionalTimestamp(loan.Lost),
+		Found:    optionalTimestamp(loan.Found),
+		Branch:   loan.Branch,
+	}
+}
+
+func holdToProto(hold data.Hold) *libraryv1.Hold {
+	return &libraryv1.Hold{
+		Id:        int64(hold.ID),
+		MemberId:  hold.MemberID,
+		BookId:    int64(hold.BookID),
+		Placed:    timestamppb.New(hold.Placed),
+		Status:    hold.Status,
+		ReadyAt:   optionalTimestamp(hold.ReadyAt),
+		ExpiresAt: optionalTimestamp(hold.ExpiresAt),
+		Branch:    hold.Branch,
+	}
+}
+
+func fineToProto(fine data.Fine) *libraryv1.Fine {
+	return &libraryv1.Fine{
+		Id:       int64(fine.ID),
+		MemberId: fine.MemberID,
+		LoanId:   int64(fine.BorrowerID),
+		Amount:   fine.Amount,
+		Reason:   fine.Reason,
+		Assessed: timestamppb.New(fine.Assessed),
+		Paid:     optionalTimestamp(fine.Paid),
+		Waived:   optionalTimestamp(fine.Waived),
+	}
+}
+
+func eventToProto(event data.Event) *libraryv1.StreamEventsResponse {
+	return &libraryv1.StreamEventsResponse{Message: &libraryv1.StreamEventsResponse_Event{Event: &libraryv1.Event{
+		Id:       int64(event.ID),
+		Type:     event.Type,
+		Time:     timestamppb.New(event.Time),
+		Branch:   event.Branch,
+		MemberId: event.MemberID,
+		Data:     event.Data,
+	}}}
+}
+
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func int64s(values []int) []int64 {
+	var result []int64
+	for _, v := range values {
+		result = append(result, int64(v))
+	}
+	return result
+}
+
+func ints(values []int64) []int {
+	var result []int
+	for _, v := range values {
+		result = append(result, int(v))
+	}
+	return result
+}
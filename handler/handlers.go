@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/circulation"
 	"github.com/jerrylovee2/gogo/data" // Update import path accordingly
 )
 
@@ -18,40 +22,144 @@ func CreateBookHandler(c *gin.Context) {
 		return
 	}
 
+	book, err := createBook(eventContext(c), newBook)
+	if err != nil {
+		changeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, book)
+}
+
+// createBook links, classifies and stores a new book
+func createBook(ctx context.Context, newBook data.Book) (data.Book, error) {
 	data.InMemoryDB.Lock()
 	defer data.InMemoryDB.Unlock()
 
+	if err := linkBookAuthors(&newBook); err != nil {
+		return data.Book{}, err
+	}
+	if err := linkBookGenres(&newBook); err != nil {
+		return data.Book{}, err
+	}
+	if err := classifyBook(&newBook); err != nil {
+		return data.Book{}, err
+	}
+	if err := checkDigitalCopies(newBook.DigitalCopies); err != nil {
+		return data.Book{}, err
+	}
+
 	newBook.ID = data.InMemoryDB.NextBookID
 	data.InMemoryDB.NextBookID++
 
 	newBook.UniqueID = fmt.Sprintf("ID%d", newBook.ID)
 	data.InMemoryDB.Books[newBook.ID] = newBook
+	recordVersion(ctx, data.InMemoryDB.BookVersions, newBook.ID, "create", newBook)
+	bus.Publish(ctx, data.BookCreated{Book: newBook})
+	return newBook, nil
+}
 
-	if data.InMemoryDB.Indices[newBook.Genre] == nil {
-		data.InMemoryDB.Indices[newBook.Genre] = make(map[string][]int)
+func UpdateBookHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid book ID"})
+		return
 	}
-	data.InMemoryDB.Indices[newBook.Genre][newBook.Author] = append(data.InMemoryDB.Indices[newBook.Genre][newBook.Author], newBook.ID)
 
-	c.JSON(http.StatusOK, newBook)
-}
+	var updated data.Book
+	if err := c.ShouldBindJSON(&updated); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
 
-func DeleteBookHandler(c *gin.Context) {
-	idParam := c.Query("id")
-	id, err := strconv.Atoi(idParam)
+	book, err := updateBook(eventContext(c), id, updated)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid book ID"})
+		changeError(c, err)
 		return
 	}
 
+	c.JSON(http.StatusOK, book)
+}
+
+// updateBook replaces the details of an existing book
+func updateBook(ctx context.Context, id int, updated data.Book) (data.Book, error) {
 	data.InMemoryDB.Lock()
 	defer data.InMemoryDB.Unlock()
-	if _, ok := data.InMemoryDB.Books[id]; !ok {
-		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Book not found"})
-		return
+
+	old, ok := data.InMemoryDB.Books[id]
+	if !ok {
+		return data.Book{}, errBookNotFound
 	}
 
-	delete(data.InMemoryDB.Books, id)
+	updated, err := replaceBook(old, updated)
+	if err != nil {
+		return data.Book{}, err
+	}
+	recordVersion(ctx, data.InMemoryDB.BookVersions, id, "update", updated)
+	bus.Publish(ctx, data.BookUpdated{Before: old, After: updated})
+	return updated, nil
+}
+
+// replaceBook links, classifies and stores new details for an existing
+// book, keeping its IDs and cover.
+// The caller must hold the database lock.
+func replaceBook(old, updated data.Book) (data.Book, error) {
+	if err := linkBookAuthors(&updated); err != nil {
+		return data.Book{}, err
+	}
+	if err := linkBookGenres(&updated); err != nil {
+		return data.Book{}, err
+	}
+	if err := classifyBook(&updated); err != nil {
+		return data.Book{}, err
+	}
+	if err := checkDigitalCopies(updated.DigitalCopies); err != nil {
+		return data.Book{}, err
+	}
+
+	updated.ID = old.ID
+	updated.UniqueID = old.UniqueID
+	updated.Cover = old.Cover
+	data.InMemoryDB.Books[old.ID] = updated
+	return updated, nil
+}
+
+// IndexBooks keeps the genre/author index up to date as books change. It
+// is a synchronous subscriber, so it runs while the publisher holds the
+// database lock.
+func IndexBooks(env bus.Envelope) error {
+	switch e := env.Event.(type) {
+	case data.BookCreated:
+		indexBook(e.Book)
+	case data.BookUpdated:
+		unindexBook(e.Before.ID)
+		indexBook(e.After)
+	case data.BookReverted:
+		unindexBook(e.Before.ID)
+		indexBook(e.After)
+	case data.BookDeleted:
+		unindexBook(e.Book.ID)
+	case data.BookRestored:
+		indexBook(e.Book)
+	}
+	return nil
+}
 
+// indexBook adds the book to the genre/author index.
+// The caller must hold the database lock.
+func indexBook(book data.Book) {
+	if data.InMemoryDB.Indices[book.Genre] == nil {
+		data.InMemoryDB.Indices[book.Genre] = make(map[string][]int)
+	}
+	for _, authorID := range book.AuthorIDs {
+		key := strconv.Itoa(authorID)
+		data.InMemoryDB.Indices[book.Genre][key] = append(data.InMemoryDB.Indices[book.Genre][key], book.ID)
+	}
+}
+
+// unindexBook removes the book from the genre/author index.
+// The caller must hold the database lock.
+func unindexBook(id int) {
 	for genre := range data.InMemoryDB.Indices {
 		for author, ids := range data.InMemoryDB.Indices[genre] {
 			var updatedIDs []int
@@ -63,6 +171,30 @@ func DeleteBookHandler(c *gin.Context) {
 			data.InMemoryDB.Indices[genre][author] = updatedIDs
 		}
 	}
+}
+
+// DeleteBookHandler moves a book to the trash, where it can be restored
+// until the retention period runs out
+func DeleteBookHandler(c *gin.Context) {
+	idParam := c.Query("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid book ID"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+	book, ok := data.InMemoryDB.Books[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Book not found"})
+		return
+	}
+
+	delete(data.InMemoryDB.Books, id)
+	data.InMemoryDB.TrashedBooks[id] = trash(c, book)
+	recordVersion(eventContext(c), data.InMemoryDB.BookVersions, id, "delete", book)
+	bus.Publish(eventContext(c), data.BookDeleted{Book: book})
 
 	c.Status(http.StatusNoContent)
 }
@@ -80,23 +212,103 @@ func GetAllBooksHandler(c *gin.Context) {
 }
 
 func SearchBooksHandler(c *gin.Context) {
-	yearParam := c.Query("year")
-	authorParam := c.Query("author")
-	genreParam := c.Query("genre")
+	search := bookSearch{Author: c.Query("author"), Genre: c.Query("genre")}
+	if yearParam := c.Query("year"); yearParam != "" {
+		year, err := strconv.Atoi(yearParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid year"})
+			return
+		}
+		search.Year = year
+	}
+
+	callRange, err := parseCallNumberRange(c.Query("scheme"), c.Query("call_number_from"), c.Query("call_number_to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: err.Error()})
+		return
+	}
+	search.CallRange = callRange
 
 	data.InMemoryDB.RLock()
 	defer data.InMemoryDB.RUnlock()
 
-	var filteredBooks []data.Book
+	c.JSON(http.StatusOK, searchBooks(search))
+}
+
+// bookSearch is what a book search filters on. Empty filters match every
+// book. Query matches either the title or an author.
+type bookSearch struct {
+	Query, Title, Author, Genre, Branch string
+	Year                                int
+	CallRange                           *callNumberRange
+}
+
+// searchBooks returns the books matching every filter, in shelf order when
+// searching a call number range and by ID otherwise.
+// The caller must hold the database lock.
+func searchBooks(search bookSearch) []data.Book {
+	// A known name form narrows the search to that author's books
+	authorID, queryAuthorID := -1, -1
+	if author, ok := resolveAuthor(search.Author); ok {
+		authorID = author.ID
+	}
+	if author, ok := resolveAuthor(search.Query); ok {
+		queryAuthorID = author.ID
+	}
+
+	// A taxonomy genre also matches books in any of its sub-genres
+	var genreSubtree map[int]bool
+	if genre, ok := resolveGenre(search.Genre); ok {
+		genreSubtree = genreDescendants(genre.ID)
+	}
+
+	var books []data.Book
 	for _, book := range data.InMemoryDB.Books {
-		if (yearParam == "" || strconv.Itoa(book.Year) == yearParam) &&
-			(authorParam == "" || strings.Contains(strings.ToLower(book.Author), strings.ToLower(authorParam))) &&
-			(genreParam == "" || strings.Contains(strings.ToLower(book.Genre), strings.ToLower(genreParam))) {
-			filteredBooks = append(filteredBooks, book)
+		if (search.Query == "" || titleContains(book, search.Query) || bookMatchesAuthor(book, search.Query, queryAuthorID)) &&
+			(search.Title == "" || titleContains(book, search.Title)) &&
+			(search.Author == "" || bookMatchesAuthor(book, search.Author, authorID)) &&
+			(search.Genre == "" || bookMatchesGenre(book, search.Genre, genreSubtree)) &&
+			(search.Year == 0 || book.Year == search.Year) &&
+			(search.Branch == "" || book.Branch == search.Branch) &&
+			(search.CallRange == nil || search.CallRange.contains(book)) {
+			books = append(books, book)
+		}
+	}
+	if search.CallRange != nil {
+		sortShelfOrder(books)
+	} else {
+		sort.Slice(books, func(i, j int) bool { return books[i].ID < books[j].ID })
+	}
+	return books
+}
+
+func titleContains(book data.Book, query string) bool {
+	return strings.Contains(strings.ToLower(book.Title), strings.ToLower(query))
+}
+
+// bookMatchesAuthor checks the book against a resolved author ID, falling
+// back to a substring match on the book's authors' name forms.
+// The caller must hold the database lock.
+func bookMatchesAuthor(book data.Book, query string, authorID int) bool {
+	if authorID >= 0 {
+		return containsInt(book.AuthorIDs, authorID)
+	}
+	if strings.Contains(strings.ToLower(book.Author), strings.ToLower(query)) {
+		return true
+	}
+	for _, id := range book.AuthorIDs {
+		if authorNameContains(data.InMemoryDB.Authors[id], query) {
+			return true
 		}
 	}
+	return false
+}
 
-	c.JSON(http.StatusOK, filteredBooks)
+func bookMatchesGenre(book data.Book, query string, subtree map[int]bool) bool {
+	if subtree != nil {
+		return bookInGenres(book, subtree)
+	}
+	return strings.Contains(strings.ToLower(book.Genre), strings.ToLower(query))
 }
 
 func CreateMemberHandler(c *gin.Context) {
@@ -106,19 +318,48 @@ func CreateMemberHandler(c *gin.Context) {
 		return
 	}
 
-	newMemberID := fmt.Sprintf("%03d", data.InMemoryDB.NextMemberID)
-	newMember.ID = newMemberID
+	member, err := createMember(eventContext(c), newMember)
+	if err != nil {
+		changeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// createMember validates and stores a new, active member
+func createMember(ctx context.Context, newMember data.Member) (data.Member, error) {
+	if err := validateMember(&newMember); err != nil {
+		return data.Member{}, err
+	}
 
 	data.InMemoryDB.Lock()
 	defer data.InMemoryDB.Unlock()
-	data.InMemoryDB.Members[newMember.ID] = newMember
-	data.InMemoryDB.NextMemberID++
 
-	c.JSON(http.StatusOK, newMember)
+	newMemberID := fmt.Sprintf("%03d", data.InMemoryDB.NextMemberID)
+	newMember.ID = newMemberID
+	newMember.Status = data.StatusActive
+	newMember.StatusReason = ""
+	newMember.SuspendedUntil = data.Date{}
+	newMember.PasswordHash = ""
+
+	if !emailAvailable(newMember.Email, newMember.ID) {
+		return data.Member{}, errEmailInUse
+	}
+
+	storeMember(newMember)
+	data.InMemoryDB.NextMemberID++
+	recordVersion(ctx, data.InMemoryDB.MemberVersions, newMember.ID, "create", newMember)
+	bus.Publish(ctx, data.MemberCreated{Member: newMember})
+	return newMember, nil
 }
 
 func GetMemberByIDHandler(c *gin.Context) {
 	idParam := c.Query("id")
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
 	member, ok := data.InMemoryDB.Members[idParam]
 	if !ok {
 		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Member not found"})
@@ -128,21 +369,33 @@ func GetMemberByIDHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, member)
 }
 
+// DeleteMemberByIDHandler moves a member to the trash and ends their
+// sessions. Their loans, holds and fines are kept.
 func DeleteMemberByIDHandler(c *gin.Context) {
 	idParam := c.Query("id")
-	_, ok := data.InMemoryDB.Members[idParam]
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	member, ok := data.InMemoryDB.Members[idParam]
 	if !ok {
 		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Member not found"})
 		return
 	}
 
-	data.InMemoryDB.Lock()
-	defer data.InMemoryDB.Unlock()
 	delete(data.InMemoryDB.Members, idParam)
+	delete(data.InMemoryDB.MemberEmails, strings.ToLower(member.Email))
+	endMemberSessions(idParam, "")
+	data.InMemoryDB.TrashedMembers[idParam] = trash(c, member)
+	recordVersion(eventContext(c), data.InMemoryDB.MemberVersions, idParam, "delete", member)
+	bus.Publish(eventContext(c), data.MemberDeleted{Member: member})
 
 	c.Status(http.StatusNoContent)
 }
 
+// CreateBorrowerHandler checks a book out to a member. The due date is set
+// from the member's loan period and the checkout is refused if any
+// circulation rule blocks it.
 func CreateBorrowerHandler(c *gin.Context) {
 	var newBorrower data.Borrower
 	if err := c.ShouldBindJSON(&newBorrower); err != nil {
@@ -150,14 +403,13 @@ func CreateBorrowerHandler(c *gin.Context) {
 		return
 	}
 
-	data.InMemoryDB.Lock()
-	defer data.InMemoryDB.Unlock()
-
-	newBorrower.ID = data.InMemoryDB.NextBorrowerID
-	data.InMemoryDB.Borrowers[newBorrower.ID] = newBorrower
-	data.InMemoryDB.NextBorrowerID++
+	loan, err := circulation.Checkout(eventContext(c), newBorrower.MemberID, newBorrower.BookID, time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
 
-	c.JSON(http.StatusOK, newBorrower)
+	c.JSON(http.StatusOK, loan)
 }
 
 func GetBorrowerByIDHandler(c *gin.Context) {
@@ -177,27 +429,20 @@ func GetBorrowerByIDHandler(c *gin.Context) {
 		return
 	}
 
-	dueDate := time.Now().AddDate(0, 1, 0)
-	penalty := 5.0
+	until := time.Now()
+	if ended := borrower.Ended(); ended != nil {
+		until = *ended
+	}
 
 	borrowerInfo := data.BorrowerInfo{
 		Borrower:  borrower,
-		DueDate:   dueDate,
-		Penalty:   penalty,
-		Penalties: calculatePenalties(dueDate, penalty),
+		Penalty:   data.FinePerDay,
+		Penalties: circulation.Penalty(borrower.DueDate, until),
 	}
 
 	c.JSON(http.StatusOK, borrowerInfo)
 }
 
-func calculatePenalties(dueDate time.Time, penaltyPerDay float64) float64 {
-	daysLate := time.Since(dueDate).Hours() / 24
-	if daysLate <= 0 {
-		return 0
-	}
-	return daysLate * penaltyPerDay
-}
-
 func DeleteBorrowerByIDHandler(c *gin.Context) {
 	idParam := c.Query("id")
 	borrowerID, err := strconv.Atoi(idParam)
@@ -206,15 +451,10 @@ func DeleteBorrowerByIDHandler(c *gin.Context) {
 		return
 	}
 
-	data.InMemoryDB.Lock()
-	defer data.InMemoryDB.Unlock()
-
-	if _, ok := data.InMemoryDB.Borrowers[borrowerID]; !ok {
-		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Borrower not found"})
+	if _, err := circulation.DeleteLoan(eventContext(c), borrowerID, time.Now()); err != nil {
+		circulationError(c, err)
 		return
 	}
 
-	delete(data.InMemoryDB.Borrowers, borrowerID)
-
 	c.Status(http.StatusNoContent)
 }
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/data"
+	"github.com/jerrylovee2/gogo/scheduler"
+)
+
+// Jobs runs the service's recurring jobs
+var Jobs *scheduler.Scheduler
+
+// GetJobsHandler lists every job with its schedule, next run and last run
+func GetJobsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, Jobs.Jobs())
+}
+
+// GetJobHistoryHandler lists finished runs newest first, optionally of
+// one job
+func GetJobHistoryHandler(c *gin.Context) {
+	limit := 100
+	if param := c.Query("limit"); param != "" {
+		var err error
+		if limit, err = strconv.Atoi(param); err != nil || limit < 1 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Limit must be between 1 and 1000"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, Jobs.History(c.Query("name"), limit))
+}
+
+// TriggerJobHandler starts a run of a job straight away. The run carries
+// on in the background; its outcome appears in the job history.
+func TriggerJobHandler(c *gin.Context) {
+	name := c.Query("name")
+	run, err := Jobs.Trigger(name)
+	if err != nil {
+		jobError(c, err)
+		return
+	}
+	recordAudit(c, "trigger", EntityJob, name, nil, run)
+
+	c.JSON(http.StatusAccepted, run)
+}
+
+func PauseJobHandler(c *gin.Context) {
+	setJobPaused(c, true)
+}
+
+func ResumeJobHandler(c *gin.Context) {
+	setJobPaused(c, false)
+}
+
+func setJobPaused(c *gin.Context, paused bool) {
+	name := c.Query("name")
+	action, set := "pause", Jobs.Pause
+	if !paused {
+		action, set = "resume", Jobs.Resume
+	}
+	job, err := set(name)
+	if err != nil {
+		jobError(c, err)
+		return
+	}
+	recordAudit(c, action, EntityJob, name, nil, job)
+
+	c.JSON(http.StatusOK, job)
+}
+
+func jobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, scheduler.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, scheduler.ErrJobRunning):
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: err.Error()})
+	default:
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to save job state"})
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/data"
+	"github.com/jerrylovee2/gogo/labels"
+)
+
+// barcodeModuleSize is the width of one barcode module in pixels
+const barcodeModuleSize = 4
+
+// GetBookBarcodeHandler renders the barcode for a book's unique ID
+func GetBookBarcodeHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid book ID"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	book, ok := data.InMemoryDB.Books[id]
+	data.InMemoryDB.RUnlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Book not found"})
+		return
+	}
+
+	writeBarcode(c, book.UniqueID)
+}
+
+// GetMemberBarcodeHandler renders the barcode for a member card
+func GetMemberBarcodeHandler(c *gin.Context) {
+	idParam := c.Query("id")
+
+	data.InMemoryDB.RLock()
+	member, ok := data.InMemoryDB.Members[idParam]
+	data.InMemoryDB.RUnlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Member not found"})
+		return
+	}
+
+	writeBarcode(c, member.ID)
+}
+
+// writeBarcode encodes content in the requested symbology ("type", default
+// code128) and format ("format", png or svg).
+func writeBarcode(c *gin.Context, content string) {
+	symbol, err := labels.NewSymbol(c.DefaultQuery("type", labels.Code128), content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	var contentType string
+	switch c.DefaultQuery("format", "png") {
+	case "png":
+		err = symbol.WritePNG(&buf, barcodeModuleSize)
+		contentType = "image/png"
+	case "svg":
+		err = symbol.WriteSVG(&buf, barcodeModuleSize)
+		contentType = "image/svg+xml"
+	default:
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Format must be png or svg"})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to render barcode"})
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// LabelSheetRequest selects the books to print and the stock to print on
+type LabelSheetRequest struct {
+	BookIDs []int  `json:"book_ids"`
+	Stock   string `json:"stock"`
+	Type    string `json:"type"`
+	Format  string `json:"format"`
+}
+
+// GetLabelStocksHandler lists the supported label stock
+func GetLabelStocksHandler(c *gin.Context) {
+	stocks := make([]labels.Stock, 0, len(labels.Stocks))
+	for _, stock := range labels.Stocks {
+		stocks = append(stocks, stock)
+	}
+	sort.Slice(stocks, func(i, j int) bool { return stocks[i].Name < stocks[j].Name })
+
+	c.JSON(http.StatusOK, stocks)
+}
+
+// CreateLabelSheetHandler renders spine labels for a batch of books, each
+// with its title, call number and barcode, laid out on label stock.
+func CreateLabelSheetHandler(c *gin.Context) {
+	req := LabelSheetRequest{Stock: "avery-5160", Type: labels.Code128, Format: "pdf"}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if len(req.BookIDs) == 0 {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "No books selected"})
+		return
+	}
+	stock, ok := labels.Stocks[req.Stock]
+	if !ok {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Unknown label stock"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	items := make([]labels.Label, 0, len(req.BookIDs))
+	for _, id := range req.BookIDs {
+		book, ok := data.InMemoryDB.Books[id]
+		if !ok {
+			data.InMemoryDB.RUnlock()
+			c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Book " + strconv.Itoa(id) + " not found"})
+			return
+		}
+		items = append(items, labels.Label{Title: book.Title, Subtitle: book.CallNumber, Code: book.UniqueID})
+	}
+	data.InMemoryDB.RUnlock()
+
+	var buf bytes.Buffer
+	var err error
+	var contentType string
+	switch req.Format {
+	case "pdf":
+		err = labels.WriteSheetPDF(&buf, stock, req.Type, items)
+		contentType = "application/pdf"
+	case "svg":
+		err = labels.WriteSheetSVG(&buf, stock, req.Type, items)
+		contentType = "image/svg+xml"
+	default:
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Format must be pdf or svg"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/circulation"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// memberIDKey is the context key MemberAuth stores the member ID under
+const memberIDKey = "member_id"
+
+// LoginRequest identifies a member by email address or member ID
+type LoginRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// LoginResponse carries the bearer token for a new session
+type LoginResponse struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// PasswordRequest sets a password, proving the current one when a member
+// changes their own.
+type PasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+}
+
+// SetMemberPasswordHandler lets staff set a member's password, ending all
+// of the member's sessions
+func SetMemberPasswordHandler(c *gin.Context) {
+	var req PasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+
+	if err := setMemberPassword(c.Query("id"), req.Password, ""); err != nil {
+		passwordError(c, err)
+		return
+	}
+	recordAudit(c, "password", EntityMember, c.Query("id"), nil, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// MemberLoginHandler exchanges a member's credentials for a session token
+func MemberLoginHandler(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	memberID, ok := data.InMemoryDB.MemberEmails[strings.ToLower(strings.TrimSpace(req.Login))]
+	if !ok {
+		memberID = req.Login
+	}
+	member := data.InMemoryDB.Members[memberID]
+	data.InMemoryDB.RUnlock()
+
+	if !auth.CheckPassword(member.PasswordHash, req.Password) {
+		c.JSON(http.StatusUnauthorized, data.ErrorResponse{Error: "Invalid login or password"})
+		return
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to create session"})
+		return
+	}
+	now := time.Now()
+	session := data.Session{MemberID: member.ID, Created: now, Expires: now.Add(data.SessionTTL)}
+
+	data.InMemoryDB.Lock()
+	data.InMemoryDB.Sessions[auth.HashToken(token)] = session
+	data.InMemoryDB.Unlock()
+
+	c.JSON(http.StatusOK, LoginResponse{Token: token, Expires: session.Expires})
+}
+
+// MemberAuth requires a valid member session token in the Authorization
+// header and records the member ID on the context.
+func MemberAuth(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		unauthorized(c, "Missing bearer token")
+		return
+	}
+	key := auth.HashToken(token)
+
+	data.InMemoryDB.Lock()
+	session, ok := data.InMemoryDB.Sessions[key]
+	if ok && time.Now().After(session.Expires) {
+		delete(data.InMemoryDB.Sessions, key)
+		ok = false
+	}
+	if ok {
+		_, ok = data.InMemoryDB.Members[session.MemberID]
+	}
+	data.InMemoryDB.Unlock()
+
+	if !ok {
+		unauthorized(c, "Invalid or expired token")
+		return
+	}
+
+	c.Set(memberIDKey, session.MemberID)
+	c.Next()
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="lms"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, data.ErrorResponse{Error: message})
+}
+
+func MemberLogoutHandler(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+
+	data.InMemoryDB.Lock()
+	delete(data.InMemoryDB.Sessions, auth.HashToken(token))
+	data.InMemoryDB.Unlock()
+
+	c.Status(http.StatusNoContent)
+}
+
+// ChangeMyPasswordHandler changes the logged-in member's password and ends
+// their other sessions.
+func ChangeMyPasswordHandler(c *gin.Context) {
+	var req PasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	memberID := c.GetString(memberIDKey)
+
+	data.InMemoryDB.RLock()
+	hash := data.InMemoryDB.Members[memberID].PasswordHash
+	data.InMemoryDB.RUnlock()
+	if !auth.CheckPassword(hash, req.CurrentPassword) {
+		c.JSON(http.StatusForbidden, data.ErrorResponse{Error: "Current password is incorrect"})
+		return
+	}
+
+	current := auth.HashToken(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if err := setMemberPassword(memberID, req.Password, current); err != nil {
+		passwordError(c, err)
+		return
+	}
+	recordAudit(c, "password", EntityMember, memberID, nil, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+func GetMyProfileHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	c.JSON(http.StatusOK, data.InMemoryDB.Members[c.GetString(memberIDKey)])
+}
+
+func GetMyAccountHandler(c *gin.Context) {
+	status, err := circulation.Account(c.GetString(memberIDKey), time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func GetMyLoansHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, circulation.MemberLoans(c.GetString(memberIDKey), false))
+}
+
+func GetMyHoldsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, circulation.MemberHolds(c.GetString(memberIDKey), false))
+}
+
+func GetMyFinesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, circulation.MemberFines(c.GetString(memberIDKey)))
+}
+
+// GetMyHistoryHandler returns every loan and hold the member has had
+func GetMyHistoryHandler(c *gin.Context) {
+	memberID := c.GetString(memberIDKey)
+
+	c.JSON(http.StatusOK, gin.H{
+		"loans": circulation.MemberLoans(memberID, true),
+		"holds": circulation.MemberHolds(memberID, true),
+	})
+}
+
+func RenewMyLoanHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid borrower ID"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	loan, ok := data.InMemoryDB.Borrowers[id]
+	data.InMemoryDB.RUnlock()
+	if !ok || loan.MemberID != c.GetString(memberIDKey) {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Borrower not found"})
+		return
+	}
+
+	loan, err = circulation.Renew(eventContext(c), id, time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, loan)
+}
+
+func PlaceMyHoldHandler(c *gin.Context) {
+	var req data.Hold
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+
+	hold, err := circulation.PlaceHold(eventContext(c), c.GetString(memberIDKey), req.BookID, time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hold)
+}
+
+func CancelMyHoldHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid hold ID"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	hold, ok := data.InMemoryDB.Holds[id]
+	data.InMemoryDB.RUnlock()
+	if !ok || hold.MemberID != c.GetString(memberIDKey) {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Hold not found"})
+		return
+	}
+
+	hold, err = circulation.CancelHold(eventContext(c), id, time.Now())
+	if err != nil {
+		circulationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hold)
+}
+
+var errMemberNotFound = errors.New("Member not found")
+
+// setMemberPassword stores a member's new password and ends their
+// sessions, apart from the one whose token hash is keep, if any
+func setMemberPassword(memberID, password, keep string) error {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	member, ok := data.InMemoryDB.Members[memberID]
+	if !ok {
+		return errMemberNotFound
+	}
+	member.PasswordHash = hash
+	data.InMemoryDB.Members[memberID] = member
+	endMemberSessions(memberID, keep)
+	return nil
+}
+
+// endMemberSessions ends a member's sessions, apart from the one whose
+// token hash is keep, if any.
+// The caller must hold the database lock.
+func endMemberSessions(memberID, keep string) {
+	for key, session := range data.InMemoryDB.Sessions {
+		if session.MemberID == memberID && key != keep {
+			delete(data.InMemoryDB.Sessions, key)
+		}
+	}
+}
+
+func passwordError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, auth.ErrWeakPassword):
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, errMemberNotFound):
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: err.Error()})
+	default:
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to set password"})
+	}
+}
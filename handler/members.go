@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+var (
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+	phonePattern    = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+)
+
+var (
+	errBookNotFound = errors.New("Book not found")
+	errEmailInUse   = errors.New("Email is already in use")
+)
+
+func UpdateMemberHandler(c *gin.Context) {
+	var updated data.Member
+	if err := c.ShouldBindJSON(&updated); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+
+	member, err := updateMember(eventContext(c), c.Query("id"), updated)
+	if err != nil {
+		changeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// updateMember replaces the details of an existing member. Status is
+// changed through /members/status only.
+func updateMember(ctx context.Context, id string, updated data.Member) (data.Member, error) {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	old, ok := data.InMemoryDB.Members[id]
+	if !ok {
+		return data.Member{}, errMemberNotFound
+	}
+
+	updated.ID = old.ID
+	updated.Status = old.Status
+	updated.StatusReason = old.StatusReason
+	updated.SuspendedUntil = old.SuspendedUntil
+	updated.PasswordHash = old.PasswordHash
+	if updated.JoinDate.IsZero() {
+		updated.JoinDate = old.JoinDate
+	}
+	if updated.ExpiryDate.IsZero() && updated.Category == old.Category {
+		updated.ExpiryDate = old.ExpiryDate
+	}
+	if err := validateMember(&updated); err != nil {
+		return data.Member{}, err
+	}
+	if !emailAvailable(updated.Email, updated.ID) {
+		return data.Member{}, errEmailInUse
+	}
+
+	delete(data.InMemoryDB.MemberEmails, strings.ToLower(old.Email))
+	storeMember(updated)
+	recordVersion(ctx, data.InMemoryDB.MemberVersions, updated.ID, "update", updated)
+	bus.Publish(ctx, data.MemberUpdated{Before: old, After: updated})
+	return updated, nil
+}
+
+// changeStatus is the response status for an error from creating or
+// updating a book or member. Anything but a missing record or a taken
+// email is a validation failure.
+func changeStatus(err error) int {
+	switch {
+	case errors.Is(err, errBookNotFound), errors.Is(err, errMemberNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errEmailInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func changeError(c *gin.Context, err error) {
+	c.JSON(changeStatus(err), data.ErrorResponse{Error: err.Error()})
+}
+
+func GetAllMembersHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	var members []data.Member
+	for _, member := range data.InMemoryDB.Members {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+
+	c.JSON(http.StatusOK, members)
+}
+
+// SearchMembersHandler matches q against name, email and phone number and
+// optionally filters by category and by whether the membership has expired.
+func SearchMembersHandler(c *gin.Context) {
+	query := c.Query("q")
+	categoryParam := c.Query("category")
+	expiredParam := c.Query("expired")
+	today := data.Today()
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	var members []data.Member
+	for _, member := range data.InMemoryDB.Members {
+		if memberMatches(member, query) &&
+			(categoryParam == "" || member.Category == categoryParam) &&
+			(expiredParam == "" || (expiredParam == "true") == member.Expired(today)) {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+
+	c.JSON(http.StatusOK, members)
+}
+
+// memberMatches reports whether query matches the member's name, email or
+// phone number. An empty query matches every member.
+func memberMatches(member data.Member, query string) bool {
+	query = strings.ToLower(strings.TrimSpace(query))
+	phoneQuery := phoneSeparators.Replace(query)
+	return query == "" ||
+		strings.Contains(strings.ToLower(member.Name), query) ||
+		strings.Contains(strings.ToLower(member.Email), query) ||
+		(phoneQuery != "" && strings.Contains(member.PhoneNumber, phoneQuery))
+}
+
+func GetMembershipCategoriesHandler(c *gin.Context) {
+	categories := make([]data.MembershipCategory, 0, len(data.MembershipCategories))
+	for _, category := range data.MembershipCategories {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+
+	c.JSON(http.StatusOK, categories)
+}
+
+// validateMember checks the contact details and category, normalizes the
+// email and phone number and fills in the join and expiry dates.
+func validateMember(member *data.Member) error {
+	member.Name = strings.TrimSpace(member.Name)
+	if member.Name == "" {
+		return errors.New("Name is required")
+	}
+
+	if member.Email != "" {
+		addr, err := mail.ParseAddress(member.Email)
+		if err != nil || addr.Address != strings.TrimSpace(member.Email) {
+			return errors.New("Invalid email address")
+		}
+		member.Email = addr.Address
+	}
+
+	if member.PhoneNumber != "" {
+		phone := phoneSeparators.Replace(member.PhoneNumber)
+		if !phonePattern.MatchString(phone) {
+			return errors.New("Invalid phone number")
+		}
+		member.PhoneNumber = phone
+	}
+
+	if member.Category == "" {
+		member.Category = data.CategoryAdult
+	}
+	category, ok := data.MembershipCategories[member.Category]
+	if !ok {
+		return errors.New("Unknown membership category")
+	}
+
+	if !member.DateOfBirth.IsZero() && member.DateOfBirth.After(data.Today().Time) {
+		return errors.New("Date of birth is in the future")
+	}
+	if member.JoinDate.IsZero() {
+		member.JoinDate = data.Today()
+	}
+	if member.ExpiryDate.IsZero() {
+		member.ExpiryDate = data.NewDate(member.JoinDate.AddDate(0, category.TermMonths, 0))
+	}
+	if member.ExpiryDate.Before(member.JoinDate.Time) {
+		return errors.New("Expiry date is before join date")
+	}
+	return nil
+}
+
+// emailAvailable reports whether no other member uses the email.
+// The caller must hold the database lock.
+func emailAvailable(email, memberID string) bool {
+	if email == "" {
+		return true
+	}
+	owner, ok := data.InMemoryDB.MemberEmails[strings.ToLower(email)]
+	return !ok || owner == memberID
+}
+
+// storeMember saves the member and indexes their email.
+// The caller must hold the database lock.
+func storeMember(member data.Member) {
+	data.InMemoryDB.Members[member.ID] = member
+	if member.Email != "" {
+		data.InMemoryDB.MemberEmails[strings.ToLower(member.Email)] = member.ID
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/bus"
+)
+
+// eventCounts counts domain events by type since the service started
+var eventCounts = struct {
+	sync.Mutex
+	byType map[string]int64
+}{byType: make(map[string]int64)}
+
+// CountEvents counts domain events by type for GetMetricsHandler
+func CountEvents(env bus.Envelope) error {
+	eventCounts.Lock()
+	defer eventCounts.Unlock()
+
+	eventCounts.byType[env.Event.EventType()]++
+	return nil
+}
+
+// GetMetricsHandler reports domain event counts and how each event bus
+// subscriber is keeping up, in the Prometheus text format
+func GetMetricsHandler(c *gin.Context) {
+	var b strings.Builder
+
+	eventCounts.Lock()
+	types := make([]string, 0, len(eventCounts.byType))
+	for eventType := range eventCounts.byType {
+		types = append(types, eventType)
+	}
+	sort.Strings(types)
+	b.WriteString("# HELP gogo_events_total Domain events published, by type.\n")
+	b.WriteString("# TYPE gogo_events_total counter\n")
+	for _, eventType := range types {
+		fmt.Fprintf(&b, "gogo_events_total{type=%q} %d\n", eventType, eventCounts.byType[eventType])
+	}
+	eventCounts.Unlock()
+
+	stats := bus.Default.Stats()
+	metrics := []struct {
+		name, kind, help string
+		value            func(bus.Stats) int64
+	}{
+		{"gogo_event_deliveries_total", "counter", "Domain events handled by each subscriber.", func(s bus.Stats) int64 { return s.Delivered }},
+		{"gogo_event_failures_total", "counter", "Domain events a subscriber failed to handle.", func(s bus.Stats) int64 { return s.Failed }},
+		{"gogo_event_queue_length", "gauge", "Domain events waiting for an asynchronous subscriber.", func(s bus.Stats) int64 { return s.Pending }},
+	}
+	for _, metric := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind)
+		for _, s := range stats {
+			fmt.Fprintf(&b, "%s{subscriber=%q} %d\n", metric.name, s.Name, metric.value(s))
+		}
+	}
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/data"
+	"github.com/jerrylovee2/gogo/notify"
+)
+
+// Notifier sends notices to members
+var Notifier *notify.Notifier
+
+// NotificationRun reports what a run of the notifier did
+type NotificationRun struct {
+	Queued int `json:"queued"`
+	Sent   int `json:"sent"`
+	Failed int `json:"failed"`
+}
+
+// GetNotificationsHandler lists notices newest first, optionally for one
+// member, kind, channel or delivery status
+func GetNotificationsHandler(c *gin.Context) {
+	memberID, kind, channel, status := c.Query("member_id"), c.Query("kind"), c.Query("channel"), c.Query("status")
+	limit := 100
+	if param := c.Query("limit"); param != "" {
+		var err error
+		if limit, err = strconv.Atoi(param); err != nil || limit < 1 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Limit must be between 1 and 1000"})
+			return
+		}
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	notices := []data.Notification{}
+	for _, notice := range data.InMemoryDB.Notifications {
+		if (memberID == "" || notice.MemberID == memberID) &&
+			(kind == "" || notice.Kind == kind) &&
+			(channel == "" || notice.Channel == channel) &&
+			(status == "" || notice.Status == status) {
+			notices = append(notices, notice)
+		}
+	}
+	sort.Slice(notices, func(i, j int) bool { return notices[i].ID > notices[j].ID })
+	if len(notices) > limit {
+		notices = notices[:limit]
+	}
+
+	c.JSON(http.StatusOK, notices)
+}
+
+func GetNotificationHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid notification ID"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	notice, ok := data.InMemoryDB.Notifications[id]
+	data.InMemoryDB.RUnlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notice)
+}
+
+// RetryNotificationHandler queues a failed or skipped notice again, to
+// the member's current address on its channel
+func RetryNotificationHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid notification ID"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	notice, ok := data.InMemoryDB.Notifications[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Notification not found"})
+		return
+	}
+	if notice.Status != data.NotificationFailed && notice.Status != data.NotificationSkipped {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Only failed or skipped notifications can be retried"})
+		return
+	}
+	member, ok := data.InMemoryDB.Members[notice.MemberID]
+	if !ok {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Member not found"})
+		return
+	}
+	channel, ok := Notifier.Channels[notice.Channel]
+	if !ok {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Channel " + notice.Channel + " is not configured"})
+		return
+	}
+	to, err := channel.Address(member)
+	if err != nil {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	before := notice
+	notice.To = to
+	notice.Status = data.NotificationPending
+	notice.Attempts = 0
+	notice.LastError = ""
+	notice.NextAttempt = time.Now()
+	data.InMemoryDB.Notifications[id] = notice
+	recordAudit(c, "retry", EntityNotification, id, before, notice)
+
+	c.JSON(http.StatusOK, notice)
+}
+
+// RunNotificationsHandler queues and delivers due notices straight away
+// rather than waiting for the next scheduled run
+func RunNotificationsHandler(c *gin.Context) {
+	queued, sent, failed, err := Notifier.Run(time.Now())
+	if err != nil {
+		c.Error(err)
+	}
+
+	c.JSON(http.StatusOK, NotificationRun{Queued: queued, Sent: sent, Failed: failed})
+}
+
+func GetMemberNotificationPrefsHandler(c *gin.Context) {
+	getNotificationPrefs(c, c.Query("id"))
+}
+
+func SetMemberNotificationPrefsHandler(c *gin.Context) {
+	setNotificationPrefs(c, c.Query("id"))
+}
+
+func GetMyNotificationPrefsHandler(c *gin.Context) {
+	getNotificationPrefs(c, c.GetString(memberIDKey))
+}
+
+func SetMyNotificationPrefsHandler(c *gin.Context) {
+	setNotificationPrefs(c, c.GetString(memberIDKey))
+}
+
+func getNotificationPrefs(c *gin.Context, memberID string) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	if _, ok := data.InMemoryDB.Members[memberID]; !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Member not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notificationPrefs(memberID))
+}
+
+func setNotificationPrefs(c *gin.Context, memberID string) {
+	var prefs data.NotificationPreferences
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	for _, kind := range prefs.OptOut {
+		if !containsString(data.NoticeKinds, kind) {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Unknown notice kind " + kind})
+			return
+		}
+	}
+	for _, channel := range prefs.Channels {
+		if !containsString(data.NotificationChannels, channel) {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Unknown channel " + channel})
+			return
+		}
+	}
+	if prefs.Language != "" && !Notifier.Templates.Supports(prefs.Language) {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Notices are not available in " + prefs.Language})
+		return
+	}
+	if prefs.OptOut == nil {
+		prefs.OptOut = []string{}
+	}
+	if len(prefs.Channels) == 0 {
+		prefs.Channels = data.DefaultChannels
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	if _, ok := data.InMemoryDB.Members[memberID]; !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Member not found"})
+		return
+	}
+	before := notificationPrefs(memberID)
+	data.InMemoryDB.NotificationPrefs[memberID] = prefs
+	recordAudit(c, "preferences", EntityMember, memberID, before, prefs)
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// notificationPrefs returns a member's preferences, which default to
+// receiving everything on the default channels.
+// The caller must hold the database lock.
+func notificationPrefs(memberID string) data.NotificationPreferences {
+	prefs := data.InMemoryDB.NotificationPrefs[memberID]
+	if prefs.OptOut == nil {
+		prefs.OptOut = []string{}
+	}
+	if len(prefs.Channels) == 0 {
+		prefs.Channels = data.DefaultChannels
+	}
+	return prefs
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMyInboxHandler lists the member's in-app messages newest first, only
+// the unseen ones with unseen=true
+func GetMyInboxHandler(c *gin.Context) {
+	memberID := c.GetString(memberIDKey)
+	unseen := c.Query("unseen") == "true"
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	messages := []data.Notification{}
+	for _, notice := range data.InMemoryDB.Notifications {
+		if notice.MemberID == memberID && notice.Channel == data.ChannelInbox &&
+			notice.Status == data.NotificationSent && (!unseen || notice.Seen == nil) {
+			messages = append(messages, notice)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID > messages[j].ID })
+
+	c.JSON(http.StatusOK, messages)
+}
+
+// MarkMyInboxSeenHandler marks one of the member's messages as seen, or
+// all of them when no id is given
+func MarkMyInboxSeenHandler(c *gin.Context) {
+	memberID := c.GetString(memberIDKey)
+	id := -1
+	if param := c.Query("id"); param != "" {
+		var err error
+		if id, err = strconv.Atoi(param); err != nil {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid message ID"})
+			return
+		}
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	now := time.Now()
+	found := false
+	for noticeID, notice := range data.InMemoryDB.Notifications {
+		if notice.MemberID != memberID || notice.Channel != data.ChannelInbox || notice.Status != data.NotificationSent {
+			continue
+		}
+		if id >= 0 && noticeID != id {
+			continue
+		}
+		found = true
+		if notice.Seen == nil {
+			notice.Seen = &now
+			data.InMemoryDB.Notifications[noticeID] = notice
+		}
+	}
+	if id >= 0 && !found {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Message not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/data"
+	"golang.org/x/oauth2"
+)
+
+// OIDC is the identity provider staff may log in with, nil when not
+// configured
+var OIDC *auth.OIDCProvider
+
+// OIDCLoginHandler starts an identity provider login, redirecting the
+// browser to the provider with a PKCE challenge
+func OIDCLoginHandler(c *gin.Context) {
+	if OIDC == nil {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Identity provider login is not configured"})
+		return
+	}
+	state, err := auth.NewToken()
+	var nonce string
+	if err == nil {
+		nonce, err = auth.NewToken()
+	}
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to start login"})
+		return
+	}
+	now := time.Now()
+	login := data.OIDCLogin{Nonce: nonce, Verifier: oauth2.GenerateVerifier(), Expires: now.Add(data.OIDCLoginTTL)}
+
+	data.InMemoryDB.Lock()
+	for key, pending := range data.InMemoryDB.OIDCLogins {
+		if now.After(pending.Expires) {
+			delete(data.InMemoryDB.OIDCLogins, key)
+		}
+	}
+	data.InMemoryDB.OIDCLogins[state] = login
+	data.InMemoryDB.Unlock()
+
+	c.Redirect(http.StatusFound, OIDC.AuthCodeURL(state, login.Nonce, login.Verifier))
+}
+
+// OIDCCallbackHandler finishes an identity provider login. The staff user
+// is created on first login, and their role follows their provider
+// groups on every login.
+func OIDCCallbackHandler(c *gin.Context) {
+	if OIDC == nil {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Identity provider login is not configured"})
+		return
+	}
+	if reason := c.Query("error"); reason != "" {
+		c.JSON(http.StatusUnauthorized, data.ErrorResponse{Error: "Identity provider refused login: " + reason})
+		return
+	}
+
+	state := c.Query("state")
+	data.InMemoryDB.Lock()
+	login, ok := data.InMemoryDB.OIDCLogins[state]
+	delete(data.InMemoryDB.OIDCLogins, state)
+	data.InMemoryDB.Unlock()
+
+	if !ok || time.Now().After(login.Expires) {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Unknown or expired login state"})
+		return
+	}
+
+	identity, err := OIDC.Exchange(c.Request.Context(), c.Query("code"), login.Nonce, login.Verifier)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusUnauthorized, data.ErrorResponse{Error: "Identity provider login failed"})
+		return
+	}
+	role, ok := OIDC.Role(identity)
+	if !ok {
+		c.JSON(http.StatusForbidden, data.ErrorResponse{Error: "None of your groups grant access"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	staff, found := findExternalStaff(identity.Subject)
+	if !found {
+		if _, taken := findStaff(identity.Username); taken {
+			c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Username is already in use by a local account"})
+			return
+		}
+		staff = storeStaff(data.StaffUser{Username: identity.Username, ExternalID: identity.Subject})
+	}
+	if staff.Disabled {
+		c.JSON(http.StatusForbidden, data.ErrorResponse{Error: "Staff account is disabled"})
+		return
+	}
+	before := staff
+	staff.Role = role
+	if identity.Name != "" {
+		staff.Name = identity.Name
+	}
+	data.InMemoryDB.Staff[staff.ID] = staff
+	c.Set(principalKey, staffPrincipal(staff))
+	if !found {
+		recordAudit(c, "create", EntityStaff, staff.ID, nil, staff)
+	} else if staff != before {
+		recordAudit(c, "update", EntityStaff, staff.ID, before, staff)
+	}
+
+	tokens, err := issueStaffTokens(staff, "")
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to create session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// findExternalStaff looks a staff user up by identity provider subject.
+// The caller must hold the database lock.
+func findExternalStaff(subject string) (data.StaffUser, bool) {
+	for _, staff := range data.InMemoryDB.Staff {
+		if staff.ExternalID == subject {
+			return staff, true
+		}
+	}
+	return data.StaffUser{}, false
+}
@@ -0,0 +1,812 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"errors"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// OPDS feed formats
+const (
+	// OPDSAtom is OPDS 1.2, an Atom feed
+	OPDSAtom = "atom"
+	// OPDSJSON is OPDS 2.0, a JSON feed
+	OPDSJSON = "json"
+)
+
+// OPDSPageSize is how many books or authors an OPDS feed lists per page
+var OPDSPageSize = 25
+
+const (
+	opdsBaseKey   = "opds_base"
+	opdsFormatKey = "opds_format"
+)
+
+const (
+	atomNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	atomAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	opdsJSONType        = "application/opds+json"
+	openSearchType      = "application/opensearchdescription+xml"
+)
+
+// OPDSFeeds serves the OPDS routes in a group in format, linking them to
+// each other under base
+func OPDSFeeds(base, format string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(opdsBaseKey, base)
+		c.Set(opdsFormatKey, format)
+		c.Next()
+	}
+}
+
+// checkDigitalCopies rejects digital copies that cannot be offered as
+// download links
+func checkDigitalCopies(copies []data.DigitalCopy) error {
+	for _, digital := range copies {
+		u, err := url.Parse(digital.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("Digital copy URL must be an absolute http or https URL")
+		}
+		if _, _, err := mime.ParseMediaType(digital.MediaType); err != nil {
+			return errors.New("Invalid digital copy media type")
+		}
+	}
+	return nil
+}
+
+// opdsFeed is a catalog feed before it is written out as Atom or JSON. A
+// navigation feed lists entries leading to other feeds; an acquisition
+// feed lists books.
+type opdsFeed struct {
+	// path is the feed's own path under the OPDS base, without a page
+	path    string
+	title   string
+	up      string
+	updated time.Time
+
+	navigation  []opdsEntry
+	acquisition bool
+	books       []data.Book
+
+	// page is the 1-based page shown, and total how many books or
+	// entries there are on every page together; zero when the feed is
+	// not paginated
+	page, total int
+}
+
+// opdsEntry is a link from a navigation feed to another feed
+type opdsEntry struct {
+	title, summary, path string
+	// rel says what the linked feed is, subsection unless set
+	rel         string
+	acquisition bool
+	count       int
+}
+
+// OPDSRootHandler serves the start of the catalog
+func OPDSRootHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	writeFeed(c, opdsFeed{
+		title:   "Library Catalog",
+		updated: catalogUpdated(),
+		navigation: []opdsEntry{
+			{title: "New Arrivals", summary: "The latest additions to the catalog", path: "/new", rel: "http://opds-spec.org/sort/new", acquisition: true},
+			{title: "Genres", summary: "Browse by genre", path: "/genres"},
+			{title: "Authors", summary: "Browse by author", path: "/authors"},
+			{title: "All Books", summary: "Every book in the catalog", path: "/books", acquisition: true, count: len(data.InMemoryDB.Books)},
+		},
+	})
+}
+
+// OPDSNewArrivalsHandler lists books newest first
+func OPDSNewArrivalsHandler(c *gin.Context) {
+	page, ok := opdsPage(c)
+	if !ok {
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	books := searchBooks(bookSearch{})
+	sort.Slice(books, func(i, j int) bool { return books[i].ID > books[j].ID })
+	writeFeed(c, acquisitionFeed("/new", "New Arrivals", books, page))
+}
+
+// OPDSBooksHandler lists the books matching q, genre and author, which
+// are matched as /books/search matches them. Without filters it lists
+// every book.
+func OPDSBooksHandler(c *gin.Context) {
+	page, ok := opdsPage(c)
+	if !ok {
+		return
+	}
+	search := bookSearch{Query: c.Query("q"), Genre: c.Query("genre"), Author: c.Query("author")}
+
+	var title string
+	var query []string
+	switch {
+	case search.Query != "":
+		title = "Search results for " + search.Query
+	case search.Genre != "":
+		title = search.Genre
+	case search.Author != "":
+		title = "Books by " + search.Author
+	default:
+		title = "All Books"
+	}
+	for _, param := range []string{"q", "genre", "author"} {
+		if value := c.Query(param); value != "" {
+			query = append(query, param+"="+url.QueryEscape(value))
+		}
+	}
+	path := "/books"
+	if len(query) > 0 {
+		path += "?" + strings.Join(query, "&")
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	writeFeed(c, acquisitionFeed(path, title, searchBooks(search), page))
+}
+
+// OPDSGenresHandler lists the genres under the genre given by id, or the
+// top of the taxonomy, that have books. A genre with sub-genres leads to
+// another genre list and the others to their books. At the top, genres
+// that books name but the taxonomy does not know are listed too.
+func OPDSGenresHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	feed := opdsFeed{path: "/genres", title: "Genres", updated: catalogUpdated()}
+	counts := genreBookCounts()
+	var parentID *int
+	if idParam := c.Query("id"); idParam != "" {
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid genre ID"})
+			return
+		}
+		genre, ok := data.InMemoryDB.Genres[id]
+		if !ok {
+			c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Genre not found"})
+			return
+		}
+		parentID = &id
+		feed.path = "/genres?id=" + strconv.Itoa(id)
+		feed.title = genre.Name
+		feed.up = "/genres"
+		if genre.ParentID != nil {
+			feed.up = "/genres?id=" + strconv.Itoa(*genre.ParentID)
+		}
+		feed.navigation = append(feed.navigation, opdsEntry{
+			title:       "All " + genre.Name,
+			path:        "/books?genre=" + url.QueryEscape(genre.Name),
+			acquisition: true,
+			count:       counts[id],
+		})
+	}
+
+	for _, node := range genreChildren(parentID) {
+		count := counts[node.ID]
+		if count == 0 {
+			continue
+		}
+		entry := opdsEntry{title: node.Name, count: count}
+		if genreHasBooksBelow(node, counts) {
+			entry.path = "/genres?id=" + strconv.Itoa(node.ID)
+		} else {
+			entry.path = "/books?genre=" + url.QueryEscape(node.Name)
+			entry.acquisition = true
+		}
+		feed.navigation = append(feed.navigation, entry)
+	}
+
+	if parentID == nil {
+		untrackedCounts := make(map[string]int)
+		names := make(map[string]string)
+		for _, book := range data.InMemoryDB.Books {
+			if len(book.GenreIDs) > 0 || strings.TrimSpace(book.Genre) == "" {
+				continue
+			}
+			key := strings.ToLower(strings.TrimSpace(book.Genre))
+			untrackedCounts[key]++
+			if _, ok := names[key]; !ok {
+				names[key] = strings.TrimSpace(book.Genre)
+			}
+		}
+		var untracked []opdsEntry
+		for key, name := range names {
+			untracked = append(untracked, opdsEntry{
+				title:       name,
+				path:        "/books?genre=" + url.QueryEscape(name),
+				acquisition: true,
+				count:       untrackedCounts[key],
+			})
+		}
+		sort.Slice(untracked, func(i, j int) bool { return untracked[i].title < untracked[j].title })
+		feed.navigation = append(feed.navigation, untracked...)
+	}
+
+	writeFeed(c, feed)
+}
+
+// OPDSAuthorsHandler lists the authors that have books, by name
+func OPDSAuthorsHandler(c *gin.Context) {
+	page, ok := opdsPage(c)
+	if !ok {
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	counts := make(map[int]int)
+	for _, book := range data.InMemoryDB.Books {
+		for _, id := range book.AuthorIDs {
+			counts[id]++
+		}
+	}
+	var authors []data.Author
+	for id := range counts {
+		if author, ok := data.InMemoryDB.Authors[id]; ok {
+			authors = append(authors, author)
+		}
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		if authors[i].Name != authors[j].Name {
+			return authors[i].Name < authors[j].Name
+		}
+		return authors[i].ID < authors[j].ID
+	})
+
+	feed := opdsFeed{path: "/authors", title: "Authors", updated: catalogUpdated(), page: page, total: len(authors)}
+	for _, author := range pageOf(authors, page) {
+		feed.navigation = append(feed.navigation, opdsEntry{
+			title:       author.Name,
+			path:        "/books?author=" + url.QueryEscape(author.Name),
+			acquisition: true,
+			count:       counts[author.ID],
+		})
+	}
+	writeFeed(c, feed)
+}
+
+// OPDSOpenSearchHandler describes how e-reader apps search the catalog
+func OPDSOpenSearchHandler(c *gin.Context) {
+	base := c.GetString(opdsBaseKey)
+	description := openSearchDescription{
+		Xmlns:         "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:     "Library",
+		Description:   "Search the library catalog by title or author",
+		InputEncoding: "UTF-8",
+		URLs: []openSearchURL{
+			{Type: atomAcquisitionType, Template: base + "/books?q={searchTerms}&page={startPage?}"},
+		},
+	}
+	c.Header("Content-Type", openSearchType+"; charset=utf-8")
+	c.Status(http.StatusOK)
+	c.Writer.WriteString(xml.Header)
+	if err := xml.NewEncoder(c.Writer).Encode(description); err != nil {
+		c.Error(err)
+	}
+}
+
+// opdsPage reads the page parameter, answering 400 when it is not a
+// positive number or is too large to page to
+func opdsPage(c *gin.Context) (int, bool) {
+	param := c.Query("page")
+	if param == "" {
+		return 1, true
+	}
+	// Refusing pages whose first item could not be counted keeps the
+	// start index arithmetic from overflowing
+	page, err := strconv.Atoi(param)
+	if err != nil || page < 1 || page > math.MaxInt/OPDSPageSize {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid page"})
+		return 0, false
+	}
+	return page, true
+}
+
+// pageOf returns the items on a page of OPDSPageSize
+func pageOf[T any](items []T, page int) []T {
+	start := len(items)
+	if page-1 <= len(items)/OPDSPageSize {
+		start = min((page-1)*OPDSPageSize, len(items))
+	}
+	end := min(start+OPDSPageSize, len(items))
+	return items[start:end]
+}
+
+// acquisitionFeed is a page of books.
+// The caller must hold the database lock.
+func acquisitionFeed(path, title string, books []data.Book, page int) opdsFeed {
+	feed := opdsFeed{
+		path:        path,
+		title:       title,
+		acquisition: true,
+		books:       pageOf(books, page),
+		page:        page,
+		total:       len(books),
+	}
+	for _, book := range feed.books {
+		if updated := bookUpdated(book.ID); updated.After(feed.updated) {
+			feed.updated = updated
+		}
+	}
+	if feed.updated.IsZero() {
+		feed.updated = catalogUpdated()
+	}
+	return feed
+}
+
+// bookUpdated is when a book was last changed.
+// The caller must hold the database lock.
+func bookUpdated(id int) time.Time {
+	versions := data.InMemoryDB.BookVersions[id]
+	if len(versions) == 0 {
+		return time.Time{}
+	}
+	return versions[len(versions)-1].Time
+}
+
+// catalogUpdated is when any book was last changed, or now when no book
+// has a history.
+// The caller must hold the database lock.
+func catalogUpdated() time.Time {
+	var updated time.Time
+	for id := range data.InMemoryDB.Books {
+		if t := bookUpdated(id); t.After(updated) {
+			updated = t
+		}
+	}
+	if updated.IsZero() {
+		return time.Now()
+	}
+	return updated
+}
+
+// genreBookCounts counts the books in each genre or any of its
+// sub-genres, in one pass over the books.
+// The caller must hold the database lock.
+func genreBookCounts() map[int]int {
+	counts := make(map[int]int)
+	for _, book := range data.InMemoryDB.Books {
+		counted := make(map[int]bool)
+		for _, id := range book.GenreIDs {
+			for !counted[id] {
+				genre, ok := data.InMemoryDB.Genres[id]
+				if !ok {
+					break
+				}
+				counted[id] = true
+				counts[id]++
+				if genre.ParentID == nil {
+					break
+				}
+				id = *genre.ParentID
+			}
+		}
+	}
+	return counts
+}
+
+// genreHasBooksBelow reports whether any sub-genre of the genre has books
+func genreHasBooksBelow(node data.GenreNode, counts map[int]int) bool {
+	for _, child := range node.Children {
+		if counts[child.ID] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// bookAuthors names a book's authors from the authority records, or from
+// the book when it has none.
+// The caller must hold the database lock.
+func bookAuthors(book data.Book) []string {
+	var names []string
+	for _, id := range book.AuthorIDs {
+		if author, ok := data.InMemoryDB.Authors[id]; ok {
+			names = append(names, author.Name)
+		}
+	}
+	if len(names) == 0 && book.Author != "" {
+		names = append(names, book.Author)
+	}
+	return names
+}
+
+// writeFeed writes a feed in the format of the route.
+// The caller must hold the database lock.
+func writeFeed(c *gin.Context, feed opdsFeed) {
+	base := c.GetString(opdsBaseKey)
+	if c.GetString(opdsFormatKey) == OPDSJSON {
+		c.Header("Content-Type", opdsJSONType)
+		c.JSON(http.StatusOK, opds2Document(base, feed))
+		return
+	}
+
+	kind := atomNavigationType
+	if feed.acquisition {
+		kind = atomAcquisitionType
+	}
+	c.Header("Content-Type", kind+"; charset=utf-8")
+	c.Status(http.StatusOK)
+	c.Writer.WriteString(xml.Header)
+	if err := xml.NewEncoder(c.Writer).Encode(atomDocument(base, feed)); err != nil {
+		c.Error(err)
+	}
+}
+
+// pageLinks are the first, previous, next and last links of a paginated
+// feed, with the href each should have
+func pageLinks(base string, feed opdsFeed) map[string]string {
+	links := make(map[string]string)
+	if feed.page == 0 {
+		return links
+	}
+	last := max(1, (feed.total+OPDSPageSize-1)/OPDSPageSize)
+	links["first"] = pageHref(base, feed.path, 1)
+	links["last"] = pageHref(base, feed.path, last)
+	if feed.page > 1 {
+		links["previous"] = pageHref(base, feed.path, min(feed.page-1, last))
+	}
+	if feed.page < last {
+		links["next"] = pageHref(base, feed.path, feed.page+1)
+	}
+	return links
+}
+
+// pageLinkOrder is the order pageLinks are written in
+var pageLinkOrder = []string{"first", "previous", "next", "last"}
+
+func pageHref(base, path string, page int) string {
+	if page == 1 {
+		return base + path
+	}
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return base + path + separator + "page=" + strconv.Itoa(page)
+}
+
+func selfHref(base string, feed opdsFeed) string {
+	if feed.page > 1 {
+		return pageHref(base, feed.path, feed.page)
+	}
+	return base + feed.path
+}
+
+func bookCount(n int) string {
+	if n == 1 {
+		return "1 book"
+	}
+	return strconv.Itoa(n) + " books"
+}
+
+// feedURN identifies the feed at a path under the OPDS base
+func feedURN(path string) string {
+	if path == "" {
+		return "urn:gogo:opds:catalog"
+	}
+	return "urn:gogo:opds:" + url.QueryEscape(path)
+}
+
+func bookURN(book data.Book) string {
+	return "urn:gogo:book:" + book.UniqueID
+}
+
+// Atom feeds, OPDS 1.2
+
+type atomFeed struct {
+	XMLName         xml.Name    `xml:"feed"`
+	Xmlns           string      `xml:"xmlns,attr"`
+	XmlnsDC         string      `xml:"xmlns:dc,attr"`
+	XmlnsOPDS       string      `xml:"xmlns:opds,attr"`
+	XmlnsOpenSearch string      `xml:"xmlns:opensearch,attr"`
+	XmlnsThread     string      `xml:"xmlns:thr,attr"`
+	ID              string      `xml:"id"`
+	Title           string      `xml:"title"`
+	Updated         time.Time   `xml:"updated"`
+	Links           []atomLink  `xml:"link"`
+	TotalResults    *int        `xml:"opensearch:totalResults"`
+	ItemsPerPage    *int        `xml:"opensearch:itemsPerPage"`
+	StartIndex      *int        `xml:"opensearch:startIndex"`
+	Entries         []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    time.Time      `xml:"updated"`
+	Authors    []atomAuthor   `xml:"author"`
+	Issued     string         `xml:"dc:issued,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Content    *atomContent   `xml:"content"`
+	Links      []atomLink     `xml:"link"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	// Count is how many books the linked feed holds
+	Count int `xml:"thr:count,attr,omitempty"`
+}
+
+type openSearchDescription struct {
+	XMLName       xml.Name        `xml:"OpenSearchDescription"`
+	Xmlns         string          `xml:"xmlns,attr"`
+	ShortName     string          `xml:"ShortName"`
+	Description   string          `xml:"Description"`
+	InputEncoding string          `xml:"InputEncoding"`
+	URLs          []openSearchURL `xml:"Url"`
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// atomDocument writes a feed as OPDS 1.2.
+// The caller must hold the database lock.
+func atomDocument(base string, feed opdsFeed) atomFeed {
+	kind := atomNavigationType
+	if feed.acquisition {
+		kind = atomAcquisitionType
+	}
+	doc := atomFeed{
+		Xmlns:           "http://www.w3.org/2005/Atom",
+		XmlnsDC:         "http://purl.org/dc/terms/",
+		XmlnsOPDS:       "http://opds-spec.org/2010/catalog",
+		XmlnsOpenSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		XmlnsThread:     "http://purl.org/syndication/thread/1.0",
+		ID:              feedURN(feed.path),
+		Title:           feed.title,
+		Updated:         feed.updated.UTC(),
+		Links: []atomLink{
+			{Rel: "self", Href: selfHref(base, feed), Type: kind},
+			{Rel: "start", Href: base, Type: atomNavigationType},
+			{Rel: "search", Href: base + "/opensearch.xml", Type: openSearchType},
+		},
+	}
+	if feed.path != "" {
+		doc.Links = append(doc.Links, atomLink{Rel: "up", Href: base + feed.up, Type: atomNavigationType})
+	}
+	links := pageLinks(base, feed)
+	for _, rel := range pageLinkOrder {
+		if href, ok := links[rel]; ok {
+			doc.Links = append(doc.Links, atomLink{Rel: rel, Href: href, Type: kind})
+		}
+	}
+	if feed.page > 0 {
+		perPage, start := OPDSPageSize, (feed.page-1)*OPDSPageSize+1
+		doc.TotalResults, doc.ItemsPerPage, doc.StartIndex = &feed.total, &perPage, &start
+	}
+
+	for _, entry := range feed.navigation {
+		rel, kind := entry.rel, atomNavigationType
+		if rel == "" {
+			rel = "subsection"
+		}
+		if entry.acquisition {
+			kind = atomAcquisitionType
+		}
+		atom := atomEntry{
+			Title:   entry.title,
+			ID:      feedURN(entry.path),
+			Updated: feed.updated.UTC(),
+			Links:   []atomLink{{Rel: rel, Href: base + entry.path, Type: kind, Count: entry.count}},
+		}
+		summary := entry.summary
+		if entry.count > 0 {
+			summary = bookCount(entry.count)
+			if entry.summary != "" {
+				summary = entry.summary + " (" + summary + ")"
+			}
+		}
+		if summary != "" {
+			atom.Content = &atomContent{Type: "text", Text: summary}
+		}
+		doc.Entries = append(doc.Entries, atom)
+	}
+
+	for _, book := range feed.books {
+		entry := atomEntry{
+			Title:   book.Title,
+			ID:      bookURN(book),
+			Updated: bookUpdated(book.ID).UTC(),
+		}
+		if entry.Updated.IsZero() {
+			entry.Updated = feed.updated.UTC()
+		}
+		for _, name := range bookAuthors(book) {
+			entry.Authors = append(entry.Authors, atomAuthor{Name: name, URI: base + "/books?author=" + url.QueryEscape(name)})
+		}
+		if book.Year != 0 {
+			entry.Issued = strconv.Itoa(book.Year)
+		}
+		if book.Genre != "" {
+			entry.Categories = append(entry.Categories, atomCategory{Term: book.Genre, Label: book.Genre})
+		}
+		if book.Cover != nil {
+			entry.Links = append(entry.Links,
+				atomLink{Rel: "http://opds-spec.org/image", Href: book.Cover.URLs["original"], Type: book.Cover.ContentType},
+				atomLink{Rel: "http://opds-spec.org/image/thumbnail", Href: book.Cover.URLs["medium"], Type: "image/jpeg"})
+		}
+		for _, digital := range book.DigitalCopies {
+			entry.Links = append(entry.Links, atomLink{Rel: "http://opds-spec.org/acquisition", Href: digital.URL, Type: digital.MediaType})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return doc
+}
+
+// JSON feeds, OPDS 2.0
+
+type opds2Feed struct {
+	Metadata opds2Metadata `json:"metadata"`
+	Links    []opds2Link   `json:"links"`
+	// Navigation and Publications are nil when the feed has no such
+	// collection, and an empty list when the collection is empty
+	Navigation   any `json:"navigation,omitempty"`
+	Publications any `json:"publications,omitempty"`
+}
+
+type opds2Metadata struct {
+	Title         string    `json:"title"`
+	Modified      time.Time `json:"modified"`
+	NumberOfItems *int      `json:"numberOfItems,omitempty"`
+	ItemsPerPage  int       `json:"itemsPerPage,omitempty"`
+	CurrentPage   int       `json:"currentPage,omitempty"`
+}
+
+type opds2Link struct {
+	Href       string           `json:"href"`
+	Type       string           `json:"type,omitempty"`
+	Rel        string           `json:"rel,omitempty"`
+	Title      string           `json:"title,omitempty"`
+	Templated  bool             `json:"templated,omitempty"`
+	Properties *opds2Properties `json:"properties,omitempty"`
+}
+
+type opds2Properties struct {
+	NumberOfItems int `json:"numberOfItems"`
+}
+
+type opds2Publication struct {
+	Metadata opds2PublicationMetadata `json:"metadata"`
+	Links    []opds2Link              `json:"links"`
+	Images   []opds2Link              `json:"images,omitempty"`
+}
+
+type opds2PublicationMetadata struct {
+	Type       string         `json:"@type"`
+	Identifier string         `json:"identifier"`
+	Title      string         `json:"title"`
+	Author     []opds2Contrib `json:"author,omitempty"`
+	Published  string         `json:"published,omitempty"`
+	Modified   time.Time      `json:"modified"`
+	Subject    []opds2Contrib `json:"subject,omitempty"`
+}
+
+// opds2Contrib is an author or subject, linked to its books
+type opds2Contrib struct {
+	Name  string      `json:"name"`
+	Links []opds2Link `json:"links,omitempty"`
+}
+
+// opds2Document writes a feed as OPDS 2.0.
+// The caller must hold the database lock.
+func opds2Document(base string, feed opdsFeed) opds2Feed {
+	doc := opds2Feed{
+		Metadata: opds2Metadata{Title: feed.title, Modified: feed.updated.UTC()},
+		Links: []opds2Link{
+			{Rel: "self", Href: selfHref(base, feed), Type: opdsJSONType},
+			{Rel: "start", Href: base, Type: opdsJSONType},
+			{Rel: "search", Href: base + "/books{?q}", Type: opdsJSONType, Templated: true},
+		},
+	}
+	if feed.path != "" {
+		doc.Links = append(doc.Links, opds2Link{Rel: "up", Href: base + feed.up, Type: opdsJSONType})
+	}
+	links := pageLinks(base, feed)
+	for _, rel := range pageLinkOrder {
+		if href, ok := links[rel]; ok {
+			doc.Links = append(doc.Links, opds2Link{Rel: rel, Href: href, Type: opdsJSONType})
+		}
+	}
+	if feed.page > 0 {
+		doc.Metadata.NumberOfItems = &feed.total
+		doc.Metadata.ItemsPerPage = OPDSPageSize
+		doc.Metadata.CurrentPage = feed.page
+	}
+
+	if !feed.acquisition {
+		navigation := []opds2Link{}
+		for _, entry := range feed.navigation {
+			link := opds2Link{Href: base + entry.path, Type: opdsJSONType, Title: entry.title, Rel: entry.rel}
+			if entry.count > 0 {
+				link.Properties = &opds2Properties{NumberOfItems: entry.count}
+			}
+			navigation = append(navigation, link)
+		}
+		doc.Navigation = navigation
+		return doc
+	}
+
+	publications := []opds2Publication{}
+	for _, book := range feed.books {
+		publication := opds2Publication{
+			Metadata: opds2PublicationMetadata{
+				Type:       "http://schema.org/Book",
+				Identifier: bookURN(book),
+				Title:      book.Title,
+				Modified:   bookUpdated(book.ID).UTC(),
+			},
+			Links: []opds2Link{},
+		}
+		if publication.Metadata.Modified.IsZero() {
+			publication.Metadata.Modified = feed.updated.UTC()
+		}
+		for _, name := range bookAuthors(book) {
+			publication.Metadata.Author = append(publication.Metadata.Author, opds2Contrib{
+				Name:  name,
+				Links: []opds2Link{{Href: base + "/books?author=" + url.QueryEscape(name), Type: opdsJSONType}},
+			})
+		}
+		if book.Year != 0 {
+			publication.Metadata.Published = strconv.Itoa(book.Year)
+		}
+		if book.Genre != "" {
+			publication.Metadata.Subject = []opds2Contrib{{
+				Name:  book.Genre,
+				Links: []opds2Link{{Href: base + "/books?genre=" + url.QueryEscape(book.Genre), Type: opdsJSONType}},
+			}}
+		}
+		for _, digital := range book.DigitalCopies {
+			publication.Links = append(publication.Links, opds2Link{Rel: "http://opds-spec.org/acquisition", Href: digital.URL, Type: digital.MediaType})
+		}
+		if book.Cover != nil {
+			publication.Images = []opds2Link{
+				{Href: book.Cover.URLs["original"], Type: book.Cover.ContentType},
+				{Href: book.Cover.URLs["medium"], Type: "image/jpeg"},
+			}
+		}
+		publications = append(publications, publication)
+	}
+	doc.Publications = publications
+	return doc
+}
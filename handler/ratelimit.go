@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/data"
+	"github.com/jerrylovee2/gogo/ratelimit"
+)
+
+// Rate limit groups. Each route belongs to one, and each client has a
+// separate bucket per group.
+const (
+	LimitDefault = "default"
+	LimitSearch  = "search"
+	LimitLogin   = "login"
+)
+
+// RateLimits holds the token buckets, nil to turn rate limiting off
+var RateLimits ratelimit.Store
+
+// RateLimitGroups are the limits for each group
+var RateLimitGroups = map[string]ratelimit.Limit{
+	LimitDefault: {Requests: 300, Per: time.Minute, Burst: 100},
+	LimitSearch:  {Requests: 60, Per: time.Minute, Burst: 20},
+	LimitLogin:   {Requests: 10, Per: time.Minute, Burst: 5},
+}
+
+// rateLimitRoutes puts routes outside the default group. Searches scan
+// every book and logins are worth guessing at, so both are held tighter.
+// A GraphQL query can hold many searches, so it counts as one too, as do
+// the public OPDS book feeds, which search the catalog for anyone.
+var rateLimitRoutes = map[string]string{
+	"/graphql":             LimitSearch,
+	"/opds/books":          LimitSearch,
+	"/opds/v2/books":       LimitSearch,
+	"/books/search":        LimitSearch,
+	"/books/shelf":         LimitSearch,
+	"/authors/search":      LimitSearch,
+	"/members/search":      LimitSearch,
+	"/labels/sheet":        LimitSearch,
+	"/staff/login":         LimitLogin,
+	"/staff/refresh":       LimitLogin,
+	"/staff/oidc/login":    LimitLogin,
+	"/staff/oidc/callback": LimitLogin,
+	"/me/login":            LimitLogin,
+}
+
+// RateLimit takes a token from the client's bucket for the route's group,
+// answering 429 when it is empty. Every response carries RateLimit
+// headers. If the store fails the request is let through.
+func RateLimit(c *gin.Context) {
+	if RateLimits == nil {
+		c.Next()
+		return
+	}
+	group, ok := rateLimitRoutes[c.FullPath()]
+	if !ok {
+		group = LimitDefault
+	}
+	limit := RateLimitGroups[group]
+	if limit.Unlimited() {
+		c.Next()
+		return
+	}
+
+	result, err := RateLimits.Take(c.Request.Context(), group+"|"+rateLimitClient(c), limit)
+	if err != nil {
+		c.Error(err)
+		c.Next()
+		return
+	}
+
+	c.Header("RateLimit-Policy", strconv.Itoa(limit.Requests)+";w="+strconv.Itoa(int(limit.Per.Seconds()))+";burst="+strconv.Itoa(limit.Burst))
+	c.Header("RateLimit-Limit", strconv.Itoa(limit.Burst))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", ceilSeconds(result.Reset))
+	if !result.Allowed {
+		c.Header("Retry-After", ceilSeconds(result.RetryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, data.ErrorResponse{Error: "Too many requests"})
+		return
+	}
+	c.Next()
+}
+
+// rateLimitClient identifies who a request counts against: the API key,
+// staff user or member it authenticates as, or else its address.
+// Credentials that do not check out count against the address, so
+// inventing tokens does not buy new buckets.
+func rateLimitClient(c *gin.Context) string {
+	return rateLimitKey(c.GetHeader("X-API-Key"), c.GetHeader("Authorization"), c.ClientIP())
+}
+
+// rateLimitKey identifies a client from its API key, its authorization
+// header and its address, as rateLimitClient does. gRPC calls use the
+// same keys, so a client shares its buckets between the two.
+func rateLimitKey(apiKey, authorization, ip string) string {
+	if apiKey != "" {
+		data.InMemoryDB.RLock()
+		id, ok := data.InMemoryDB.APIKeyHashes[auth.HashToken(apiKey)]
+		data.InMemoryDB.RUnlock()
+		if ok {
+			return "apikey:" + strconv.Itoa(id)
+		}
+	}
+
+	if token, ok := strings.CutPrefix(authorization, "Bearer "); ok && token != "" {
+		if claims, err := Tokens.Verify(token); err == nil {
+			return claims.Kind + ":" + claims.Subject
+		}
+
+		data.InMemoryDB.RLock()
+		session, ok := data.InMemoryDB.Sessions[auth.HashToken(token)]
+		data.InMemoryDB.RUnlock()
+		if ok && time.Now().Before(session.Expires) {
+			return "member:" + session.MemberID
+		}
+	}
+
+	return "ip:" + ip
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
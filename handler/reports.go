@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/circulation"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// GetReportsHandler lists circulation reports, latest period first
+func GetReportsHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	reports := make([]data.Report, 0, len(data.InMemoryDB.Reports))
+	for _, report := range data.InMemoryDB.Reports {
+		reports = append(reports, report)
+	}
+	data.InMemoryDB.RUnlock()
+
+	sort.Slice(reports, func(i, j int) bool {
+		if !reports[i].From.Equal(reports[j].From) {
+			return reports[i].From.After(reports[j].From)
+		}
+		return reports[i].ID > reports[j].ID
+	})
+
+	c.JSON(http.StatusOK, reports)
+}
+
+func GetReportHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid report ID"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	report, ok := data.InMemoryDB.Reports[id]
+	data.InMemoryDB.RUnlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Report not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// CreateReportHandler generates a report for the days from and to,
+// inclusive, given as dates
+func CreateReportHandler(c *gin.Context) {
+	var period struct {
+		From data.Date `json:"from"`
+		To   data.Date `json:"to"`
+	}
+	if err := c.ShouldBindJSON(&period); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if period.From.IsZero() || period.To.IsZero() || period.To.Before(period.From.Time) {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "From and to must be dates with from no later than to"})
+		return
+	}
+
+	report := circulation.GenerateReport(period.From.Time, period.To.AddDate(0, 0, 1), time.Now())
+	recordAudit(c, "generate", EntityReport, report.ID, nil, report)
+
+	c.JSON(http.StatusCreated, report)
+}
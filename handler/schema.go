@@ -0,0 +1,897 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/circulation"
+	"github.com/jerrylovee2/gogo/data"
+	"github.com/jerrylovee2/gogo/loader"
+)
+
+const (
+	// defaultPageSize is how many items a paginated field returns when
+	// first is not given
+	defaultPageSize = 20
+	// maxPageSize is the most items a paginated field returns at once
+	maxPageSize = 100
+)
+
+// paginatedFields names the fields that take first and after, wherever
+// they appear
+var paginatedFields = map[string]bool{"books": true, "members": true, "loans": true, "holds": true}
+
+// loaders batch the lookups made while resolving one request, so that a
+// field selected on every item of a list is looked up once for the list
+type loaders struct {
+	books       *loader.Loader[int, data.Book]
+	members     *loader.Loader[string, data.Member]
+	authors     *loader.Loader[int, data.Author]
+	bookLoans   *loader.Loader[int, []data.Borrower]
+	memberLoans *loader.Loader[string, []data.Borrower]
+	bookHolds   *loader.Loader[int, []data.Hold]
+	memberHolds *loader.Loader[string, []data.Hold]
+	memberFines *loader.Loader[string, []data.Fine]
+}
+
+func newLoaders() *loaders {
+	return &loaders{
+		books:   loader.New(lookupAll(func() map[int]data.Book { return data.InMemoryDB.Books })),
+		members: loader.New(lookupAll(func() map[string]data.Member { return data.InMemoryDB.Members })),
+		authors: loader.New(lookupAll(func() map[int]data.Author { return data.InMemoryDB.Authors })),
+		bookLoans: loader.New(groupAll(func() map[int]data.Borrower { return data.InMemoryDB.Borrowers },
+			func(loan data.Borrower) int { return loan.BookID })),
+		memberLoans: loader.New(groupAll(func() map[int]data.Borrower { return data.InMemoryDB.Borrowers },
+			func(loan data.Borrower) string { return loan.MemberID })),
+		bookHolds: loader.New(groupAll(func() map[int]data.Hold { return data.InMemoryDB.Holds },
+			func(hold data.Hold) int { return hold.BookID })),
+		memberHolds: loader.New(groupAll(func() map[int]data.Hold { return data.InMemoryDB.Holds },
+			func(hold data.Hold) string { return hold.MemberID })),
+		memberFines: loader.New(groupAll(func() map[int]data.Fine { return data.InMemoryDB.Fines },
+			func(fine data.Fine) string { return fine.MemberID })),
+	}
+}
+
+// lookupAll fetches the records with the given keys from a table, under
+// one read lock
+func lookupAll[K comparable, V any](table func() map[K]V) func([]K) map[K]V {
+	return func(keys []K) map[K]V {
+		data.InMemoryDB.RLock()
+		defer data.InMemoryDB.RUnlock()
+
+		records := table()
+		found := make(map[K]V, len(keys))
+		for _, key := range keys {
+			if record, ok := records[key]; ok {
+				found[key] = record
+			}
+		}
+		return found
+	}
+}
+
+// groupAll fetches the records belonging to each of the given keys with
+// one pass over a table
+func groupAll[K, ID comparable, V any](table func() map[ID]V, owner func(V) K) func([]K) map[K][]V {
+	return func(keys []K) map[K][]V {
+		data.InMemoryDB.RLock()
+		defer data.InMemoryDB.RUnlock()
+
+		wanted := make(map[K]bool, len(keys))
+		for _, key := range keys {
+			wanted[key] = true
+		}
+		groups := make(map[K][]V)
+		for _, record := range table() {
+			if key := owner(record); wanted[key] {
+				groups[key] = append(groups[key], record)
+			}
+		}
+		return groups
+	}
+}
+
+// dateType is a calendar date, written as in the REST API
+var dateType = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Date",
+	Description: "A calendar date, such as 2024-05-01",
+	Serialize: func(value any) any {
+		if date, ok := value.(data.Date); ok && !date.IsZero() {
+			return date.Format(data.DateLayout)
+		}
+		return nil
+	},
+	ParseValue: func(value any) any {
+		s, _ := value.(string)
+		return parseDate(s)
+	},
+	ParseLiteral: func(value ast.Value) any {
+		s, _ := value.(*ast.StringValue)
+		if s == nil {
+			return nil
+		}
+		return parseDate(s.Value)
+	},
+})
+
+// parseDate returns nil for a malformed date, which graphql reports as
+// an invalid value
+func parseDate(s string) any {
+	t, err := time.Parse(data.DateLayout, s)
+	if err != nil {
+		return nil
+	}
+	return data.Date{Time: t}
+}
+
+// field resolves a field from the record it belongs to
+func field[T any](t graphql.Output, get func(T) any) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (any, error) {
+		return get(p.Source.(T)), nil
+	}}
+}
+
+// guarded refuses to resolve a field for a caller without the permission
+func guarded(permission string, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		if !requestFrom(p).principal.Can(permission) {
+			return nil, &graphqlError{message: "Missing permission " + permission, code: errorCode(http.StatusForbidden)}
+		}
+		return resolve(p)
+	}
+}
+
+// pageArgs adds first and after to a paginated field's filters
+func pageArgs(filters graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	filters["first"] = &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize}
+	filters["after"] = &graphql.ArgumentConfig{Type: graphql.String}
+	return filters
+}
+
+// connectionType is a page of a paginated field
+func connectionType(name string, node *graphql.Object, pageInfo *graphql.Object) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Connection",
+		Fields: graphql.Fields{
+			"nodes":      &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(node)))},
+			"totalCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"pageInfo":   &graphql.Field{Type: graphql.NewNonNull(pageInfo)},
+		},
+	})
+}
+
+// connection returns the page of items that follows the after cursor.
+// Items must be sorted by cursor; a cursor is the ID of a record.
+func connection[T any](p graphql.ResolveParams, items []T, cursor func(T) string) (any, error) {
+	first, err := pageSize(p)
+	if err != nil {
+		return nil, err
+	}
+	start := 0
+	if after, ok := p.Args["after"].(string); ok {
+		start = sort.Search(len(items), func(i int) bool { return cursorLess(after, cursor(items[i])) })
+	}
+	end := min(start+first, len(items))
+	page := items[start:end]
+
+	var endCursor any
+	if len(page) > 0 {
+		endCursor = cursor(page[len(page)-1])
+	}
+	return map[string]any{
+		"nodes":      page,
+		"totalCount": len(items),
+		"pageInfo":   map[string]any{"hasNextPage": end < len(items), "endCursor": endCursor},
+	}, nil
+}
+
+// pageSize is a paginated field's first argument. Fields that load their
+// items in batches check it up front, so that the error keeps its code.
+func pageSize(p graphql.ResolveParams) (int, error) {
+	first, _ := p.Args["first"].(int)
+	if first < 1 || first > maxPageSize {
+		return 0, &graphqlError{message: fmt.Sprintf("First must be between 1 and %d", maxPageSize), code: errorCode(http.StatusBadRequest)}
+	}
+	return first, nil
+}
+
+// cursorLess orders record IDs, which are numbers, some zero-padded
+func cursorLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+func bookCursor(book data.Book) string       { return strconv.Itoa(book.ID) }
+func memberCursor(member data.Member) string { return member.ID }
+func loanCursor(loan data.Borrower) string   { return strconv.Itoa(loan.ID) }
+func holdCursor(hold data.Hold) string       { return strconv.Itoa(hold.ID) }
+
+// filterLoans keeps the loans matching the active and overdue arguments,
+// sorted by ID
+func filterLoans(p graphql.ResolveParams, loans []data.Borrower) []data.Borrower {
+	now := time.Now()
+	active, filterActive := p.Args["active"].(bool)
+	overdue, filterOverdue := p.Args["overdue"].(bool)
+	filtered := []data.Borrower{}
+	for _, loan := range loans {
+		if (!filterActive || loan.Active() == active) &&
+			(!filterOverdue || loan.Overdue(now) == overdue) {
+			filtered = append(filtered, loan)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].ID < filtered[j].ID })
+	return filtered
+}
+
+// filterHolds keeps the holds matching the status argument, sorted by ID
+func filterHolds(p graphql.ResolveParams, holds []data.Hold) []data.Hold {
+	status, _ := p.Args["status"].(string)
+	filtered := []data.Hold{}
+	for _, hold := range holds {
+		if status == "" || hold.Status == status {
+			filtered = append(filtered, hold)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].ID < filtered[j].ID })
+	return filtered
+}
+
+// bookInput is a book built from a BookInput
+func bookInput(input map[string]any) data.Book {
+	var book data.Book
+	book.Title, _ = input["title"].(string)
+	book.Author, _ = input["author"].(string)
+	book.AuthorIDs = intList(input["authorIds"])
+	book.Genre, _ = input["genre"].(string)
+	book.GenreIDs = intList(input["genreIds"])
+	book.Year, _ = input["year"].(int)
+	book.CallNumber, _ = input["callNumber"].(string)
+	book.CallNumberScheme, _ = input["callNumberScheme"].(string)
+	book.Branch, _ = input["branch"].(string)
+	copies, _ := input["digitalCopies"].([]any)
+	for _, value := range copies {
+		if input, ok := value.(map[string]any); ok {
+			var digital data.DigitalCopy
+			digital.URL, _ = input["url"].(string)
+			digital.MediaType, _ = input["mediaType"].(string)
+			book.DigitalCopies = append(book.DigitalCopies, digital)
+		}
+	}
+	return book
+}
+
+// memberInput is a member built from a MemberInput
+func memberInput(input map[string]any) data.Member {
+	var member data.Member
+	member.Name, _ = input["name"].(string)
+	member.Email, _ = input["email"].(string)
+	member.PhoneNumber, _ = input["phoneNumber"].(string)
+	member.Category, _ = input["category"].(string)
+	member.DateOfBirth, _ = input["dateOfBirth"].(data.Date)
+	member.ExpiryDate, _ = input["expiryDate"].(data.Date)
+	if address, ok := input["address"].(map[string]any); ok {
+		member.Address.Line1, _ = address["line1"].(string)
+		member.Address.Line2, _ = address["line2"].(string)
+		member.Address.City, _ = address["city"].(string)
+		member.Address.Region, _ = address["region"].(string)
+		member.Address.PostalCode, _ = address["postalCode"].(string)
+		member.Address.Country, _ = address["country"].(string)
+	}
+	return member
+}
+
+func intList(value any) []int {
+	values, _ := value.([]any)
+	var ints []int
+	for _, v := range values {
+		if i, ok := v.(int); ok {
+			ints = append(ints, i)
+		}
+	}
+	return ints
+}
+
+// newGraphQLSchema builds the schema served by GraphQLHandler
+func newGraphQLSchema() (graphql.Schema, error) {
+	nonNull := graphql.NewNonNull
+	list := func(t graphql.Type) graphql.Output { return nonNull(graphql.NewList(nonNull(t))) }
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{Type: nonNull(graphql.Boolean)},
+			"endCursor":   &graphql.Field{Type: graphql.String, Description: "Pass as after to fetch the next page"},
+		},
+	})
+
+	digitalCopyType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "DigitalCopy",
+		Fields: graphql.Fields{
+			"url":       field(nonNull(graphql.String), func(d data.DigitalCopy) any { return d.URL }),
+			"mediaType": field(nonNull(graphql.String), func(d data.DigitalCopy) any { return d.MediaType }),
+		},
+	})
+
+	authorType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Author",
+		Fields: graphql.Fields{
+			"id":             field(nonNull(graphql.Int), func(a data.Author) any { return a.ID }),
+			"name":           field(nonNull(graphql.String), func(a data.Author) any { return a.Name }),
+			"alternateNames": field(list(graphql.String), func(a data.Author) any { return a.AlternateNames }),
+			"birthYear":      field(graphql.Int, func(a data.Author) any { return a.BirthYear }),
+			"deathYear":      field(graphql.Int, func(a data.Author) any { return a.DeathYear }),
+		},
+	})
+
+	fineType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Fine",
+		Fields: graphql.Fields{
+			"id":          field(nonNull(graphql.Int), func(f data.Fine) any { return f.ID }),
+			"loanId":      field(nonNull(graphql.Int), func(f data.Fine) any { return f.BorrowerID }),
+			"amount":      field(nonNull(graphql.Float), func(f data.Fine) any { return f.Amount }),
+			"reason":      field(nonNull(graphql.String), func(f data.Fine) any { return f.Reason }),
+			"assessed":    field(nonNull(graphql.DateTime), func(f data.Fine) any { return f.Assessed }),
+			"paid":        field(graphql.DateTime, func(f data.Fine) any { return f.Paid }),
+			"waived":      field(graphql.DateTime, func(f data.Fine) any { return f.Waived }),
+			"outstanding": field(nonNull(graphql.Boolean), func(f data.Fine) any { return f.Outstanding() }),
+		},
+	})
+
+	var bookType, memberType, loanType, holdType *graphql.Object
+	var loanConnection, holdConnection *graphql.Object
+
+	// loansOf and holdsOf resolve a book's or member's loans and holds from
+	// a batched loader
+	loansOf := func(load func(p graphql.ResolveParams) func() ([]data.Borrower, bool)) *graphql.Field {
+		return &graphql.Field{
+			Type: loanConnection,
+			Args: pageArgs(graphql.FieldConfigArgument{
+				"active":  &graphql.ArgumentConfig{Type: graphql.Boolean},
+				"overdue": &graphql.ArgumentConfig{Type: graphql.Boolean},
+			}),
+			Resolve: guarded(auth.CirculationRead, func(p graphql.ResolveParams) (any, error) {
+				if _, err := pageSize(p); err != nil {
+					return nil, err
+				}
+				loans := load(p)
+				return func() (any, error) {
+					all, _ := loans()
+					return connection(p, filterLoans(p, all), loanCursor)
+				}, nil
+			}),
+		}
+	}
+	holdsOf := func(load func(p graphql.ResolveParams) func() ([]data.Hold, bool)) *graphql.Field {
+		return &graphql.Field{
+			Type: holdConnection,
+			Args: pageArgs(graphql.FieldConfigArgument{
+				"status": &graphql.ArgumentConfig{Type: graphql.String},
+			}),
+			Resolve: guarded(auth.CirculationRead, func(p graphql.ResolveParams) (any, error) {
+				if _, err := pageSize(p); err != nil {
+					return nil, err
+				}
+				holds := load(p)
+				return func() (any, error) {
+					all, _ := holds()
+					return connection(p, filterHolds(p, all), holdCursor)
+				}, nil
+			}),
+		}
+	}
+
+	// bookOf and memberOf resolve the book or member a loan or hold is for.
+	// A book or member since moved to the trash is null.
+	bookOf := func(id func(source any) int) *graphql.Field {
+		return &graphql.Field{Type: bookType, Resolve: func(p graphql.ResolveParams) (any, error) {
+			book := requestFrom(p).loaders.books.Load(id(p.Source))
+			return func() (any, error) {
+				if book, ok := book(); ok {
+					return book, nil
+				}
+				return nil, nil
+			}, nil
+		}}
+	}
+	memberOf := func(id func(source any) string) *graphql.Field {
+		return &graphql.Field{Type: memberType, Resolve: guarded(auth.MembersRead, func(p graphql.ResolveParams) (any, error) {
+			member := requestFrom(p).loaders.members.Load(id(p.Source))
+			return func() (any, error) {
+				if member, ok := member(); ok {
+					return member, nil
+				}
+				return nil, nil
+			}, nil
+		})}
+	}
+
+	bookType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Book",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":               field(nonNull(graphql.Int), func(b data.Book) any { return b.ID }),
+				"uniqueId":         field(nonNull(graphql.String), func(b data.Book) any { return b.UniqueID }),
+				"title":            field(nonNull(graphql.String), func(b data.Book) any { return b.Title }),
+				"author":           field(nonNull(graphql.String), func(b data.Book) any { return b.Author }),
+				"genre":            field(nonNull(graphql.String), func(b data.Book) any { return b.Genre }),
+				"year":             field(nonNull(graphql.Int), func(b data.Book) any { return b.Year }),
+				"callNumber":       field(graphql.String, func(b data.Book) any { return b.CallNumber }),
+				"callNumberScheme": field(graphql.String, func(b data.Book) any { return b.CallNumberScheme }),
+				"branch":           field(graphql.String, func(b data.Book) any { return b.Branch }),
+				"digitalCopies":    field(list(digitalCopyType), func(b data.Book) any { return b.DigitalCopies }),
+				"authors": &graphql.Field{
+					Type:        list(authorType),
+					Description: "The authority records of the book's authors",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						authors := requestFrom(p).loaders.authors
+						var loads []func() (data.Author, bool)
+						for _, id := range p.Source.(data.Book).AuthorIDs {
+							loads = append(loads, authors.Load(id))
+						}
+						return func() (any, error) {
+							found := []data.Author{}
+							for _, load := range loads {
+								if author, ok := load(); ok {
+									found = append(found, author)
+								}
+							}
+							return found, nil
+						}, nil
+					},
+				},
+				"loans": loansOf(func(p graphql.ResolveParams) func() ([]data.Borrower, bool) {
+					return requestFrom(p).loaders.bookLoans.Load(p.Source.(data.Book).ID)
+				}),
+				"holds": holdsOf(func(p graphql.ResolveParams) func() ([]data.Hold, bool) {
+					return requestFrom(p).loaders.bookHolds.Load(p.Source.(data.Book).ID)
+				}),
+			}
+		}),
+	})
+
+	memberType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Member",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":             field(nonNull(graphql.ID), func(m data.Member) any { return m.ID }),
+				"name":           field(nonNull(graphql.String), func(m data.Member) any { return m.Name }),
+				"email":          field(graphql.String, func(m data.Member) any { return m.Email }),
+				"phoneNumber":    field(graphql.String, func(m data.Member) any { return m.PhoneNumber }),
+				"category":       field(nonNull(graphql.String), func(m data.Member) any { return m.Category }),
+				"dateOfBirth":    field(dateType, func(m data.Member) any { return m.DateOfBirth }),
+				"joinDate":       field(dateType, func(m data.Member) any { return m.JoinDate }),
+				"expiryDate":     field(dateType, func(m data.Member) any { return m.ExpiryDate }),
+				"status":         field(nonNull(graphql.String), func(m data.Member) any { return m.Status }),
+				"statusReason":   field(graphql.String, func(m data.Member) any { return m.StatusReason }),
+				"suspendedUntil": field(dateType, func(m data.Member) any { return m.SuspendedUntil }),
+				"loans": loansOf(func(p graphql.ResolveParams) func() ([]data.Borrower, bool) {
+					return requestFrom(p).loaders.memberLoans.Load(p.Source.(data.Member).ID)
+				}),
+				"holds": holdsOf(func(p graphql.ResolveParams) func() ([]data.Hold, bool) {
+					return requestFrom(p).loaders.memberHolds.Load(p.Source.(data.Member).ID)
+				}),
+				"fines": &graphql.Field{
+					Type: graphql.NewList(nonNull(fineType)),
+					Args: graphql.FieldConfigArgument{
+						"outstanding": &graphql.ArgumentConfig{Type: graphql.Boolean},
+					},
+					Resolve: guarded(auth.CirculationRead, func(p graphql.ResolveParams) (any, error) {
+						fines := requestFrom(p).loaders.memberFines.Load(p.Source.(data.Member).ID)
+						outstanding, filter := p.Args["outstanding"].(bool)
+						return func() (any, error) {
+							all, _ := fines()
+							filtered := []data.Fine{}
+							for _, fine := range all {
+								if !filter || fine.Outstanding() == outstanding {
+									filtered = append(filtered, fine)
+								}
+							}
+							sort.Slice(filtered, func(i, j int) bool { return filtered[i].ID < filtered[j].ID })
+							return filtered, nil
+						}, nil
+					}),
+				},
+			}
+		}),
+	})
+
+	loanType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Loan",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":       field(nonNull(graphql.Int), func(l data.Borrower) any { return l.ID }),
+				"borrowed": field(nonNull(graphql.DateTime), func(l data.Borrower) any { return l.Borrowed }),
+				"dueDate":  field(nonNull(graphql.DateTime), func(l data.Borrower) any { return l.DueDate }),
+				"renewals": field(nonNull(graphql.Int), func(l data.Borrower) any { return l.Renewals }),
+				"returned": field(graphql.DateTime, func(l data.Borrower) any { return l.Returned }),
+				"lost":     field(graphql.DateTime, func(l data.Borrower) any { return l.Lost }),
+				"found":    field(graphql.DateTime, func(l data.Borrower) any { return l.Found }),
+				"branch":   field(graphql.String, func(l data.Borrower) any { return l.Branch }),
+				"active":   field(nonNull(graphql.Boolean), func(l data.Borrower) any { return l.Active() }),
+				"overdue":  field(nonNull(graphql.Boolean), func(l data.Borrower) any { return l.Overdue(time.Now()) }),
+				"book":     bookOf(func(source any) int { return source.(data.Borrower).BookID }),
+				"member":   memberOf(func(source any) string { return source.(data.Borrower).MemberID }),
+			}
+		}),
+	})
+
+	holdType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Hold",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        field(nonNull(graphql.Int), func(h data.Hold) any { return h.ID }),
+				"status":    field(nonNull(graphql.String), func(h data.Hold) any { return h.Status }),
+				"placed":    field(nonNull(graphql.DateTime), func(h data.Hold) any { return h.Placed }),
+				"readyAt":   field(graphql.DateTime, func(h data.Hold) any { return h.ReadyAt }),
+				"expiresAt": field(graphql.DateTime, func(h data.Hold) any { return h.ExpiresAt }),
+				"branch":    field(graphql.String, func(h data.Hold) any { return h.Branch }),
+				"book":      bookOf(func(source any) int { return source.(data.Hold).BookID }),
+				"member":    memberOf(func(source any) string { return source.(data.Hold).MemberID }),
+			}
+		}),
+	})
+
+	bookConnection := connectionType("Book", bookType, pageInfoType)
+	memberConnection := connectionType("Member", memberType, pageInfoType)
+	loanConnection = connectionType("Loan", loanType, pageInfoType)
+	holdConnection = connectionType("Hold", holdType, pageInfoType)
+
+	returnType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ReturnResult",
+		Fields: graphql.Fields{
+			"loan": &graphql.Field{Type: nonNull(loanType)},
+			"fine": &graphql.Field{Type: fineType, Description: "The fine charged for a late return, if any"},
+		},
+	})
+
+	digitalCopyInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "DigitalCopyInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"url":       &graphql.InputObjectFieldConfig{Type: nonNull(graphql.String)},
+			"mediaType": &graphql.InputObjectFieldConfig{Type: nonNull(graphql.String)},
+		},
+	})
+	bookInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "BookInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":            &graphql.InputObjectFieldConfig{Type: nonNull(graphql.String)},
+			"author":           &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"authorIds":        &graphql.InputObjectFieldConfig{Type: graphql.NewList(nonNull(graphql.Int))},
+			"genre":            &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"genreIds":         &graphql.InputObjectFieldConfig{Type: graphql.NewList(nonNull(graphql.Int))},
+			"year":             &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"callNumber":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"callNumberScheme": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"branch":           &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"digitalCopies":    &graphql.InputObjectFieldConfig{Type: graphql.NewList(nonNull(digitalCopyInputType))},
+		},
+	})
+	addressInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "AddressInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"line1":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"line2":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"city":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"region":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"postalCode": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"country":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+	memberInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "MemberInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":        &graphql.InputObjectFieldConfig{Type: nonNull(graphql.String)},
+			"email":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"phoneNumber": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"category":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"dateOfBirth": &graphql.InputObjectFieldConfig{Type: dateType},
+			"expiryDate":  &graphql.InputObjectFieldConfig{Type: dateType},
+			"address":     &graphql.InputObjectFieldConfig{Type: addressInputType},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"book": &graphql.Field{
+				Type: bookType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNull(graphql.Int)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					data.InMemoryDB.RLock()
+					defer data.InMemoryDB.RUnlock()
+
+					if book, ok := data.InMemoryDB.Books[p.Args["id"].(int)]; ok {
+						return book, nil
+					}
+					return nil, nil
+				},
+			},
+			"books": &graphql.Field{
+				Type:        bookConnection,
+				Description: "Books matching every filter given, as /books/search matches them",
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"title":  &graphql.ArgumentConfig{Type: graphql.String},
+					"author": &graphql.ArgumentConfig{Type: graphql.String},
+					"genre":  &graphql.ArgumentConfig{Type: graphql.String},
+					"year":   &graphql.ArgumentConfig{Type: graphql.Int},
+					"branch": &graphql.ArgumentConfig{Type: graphql.String},
+				}),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					search := bookSearch{}
+					search.Title, _ = p.Args["title"].(string)
+					search.Author, _ = p.Args["author"].(string)
+					search.Genre, _ = p.Args["genre"].(string)
+					search.Year, _ = p.Args["year"].(int)
+					search.Branch, _ = p.Args["branch"].(string)
+
+					data.InMemoryDB.RLock()
+					defer data.InMemoryDB.RUnlock()
+
+					books := searchBooks(search)
+					return connection(p, books, bookCursor)
+				},
+			},
+			"member": &graphql.Field{
+				Type: memberType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNull(graphql.ID)}},
+				Resolve: guarded(auth.MembersRead, func(p graphql.ResolveParams) (any, error) {
+					data.InMemoryDB.RLock()
+					defer data.InMemoryDB.RUnlock()
+
+					if member, ok := data.InMemoryDB.Members[p.Args["id"].(string)]; ok {
+						return member, nil
+					}
+					return nil, nil
+				}),
+			},
+			"members": &graphql.Field{
+				Type:        memberConnection,
+				Description: "Members matching every filter given; query matches name, email or phone number",
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"query":    &graphql.ArgumentConfig{Type: graphql.String},
+					"category": &graphql.ArgumentConfig{Type: graphql.String},
+					"status":   &graphql.ArgumentConfig{Type: graphql.String},
+				}),
+				Resolve: guarded(auth.MembersRead, func(p graphql.ResolveParams) (any, error) {
+					query, _ := p.Args["query"].(string)
+					category, _ := p.Args["category"].(string)
+					status, _ := p.Args["status"].(string)
+
+					data.InMemoryDB.RLock()
+					defer data.InMemoryDB.RUnlock()
+
+					members := []data.Member{}
+					for _, member := range data.InMemoryDB.Members {
+						if memberMatches(member, query) &&
+							(category == "" || member.Category == category) &&
+							(status == "" || member.Status == status) {
+							members = append(members, member)
+						}
+					}
+					sort.Slice(members, func(i, j int) bool { return cursorLess(members[i].ID, members[j].ID) })
+					return connection(p, members, memberCursor)
+				}),
+			},
+			"loan": &graphql.Field{
+				Type: loanType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNull(graphql.Int)}},
+				Resolve: guarded(auth.CirculationRead, func(p graphql.ResolveParams) (any, error) {
+					data.InMemoryDB.RLock()
+					defer data.InMemoryDB.RUnlock()
+
+					if loan, ok := data.InMemoryDB.Borrowers[p.Args["id"].(int)]; ok {
+						return loan, nil
+					}
+					return nil, nil
+				}),
+			},
+			"loans": &graphql.Field{
+				Type: loanConnection,
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"memberId": &graphql.ArgumentConfig{Type: graphql.ID},
+					"bookId":   &graphql.ArgumentConfig{Type: graphql.Int},
+					"branch":   &graphql.ArgumentConfig{Type: graphql.String},
+					"active":   &graphql.ArgumentConfig{Type: graphql.Boolean},
+					"overdue":  &graphql.ArgumentConfig{Type: graphql.Boolean},
+				}),
+				Resolve: guarded(auth.CirculationRead, func(p graphql.ResolveParams) (any, error) {
+					memberID, _ := p.Args["memberId"].(string)
+					bookID, filterBook := p.Args["bookId"].(int)
+					branch, _ := p.Args["branch"].(string)
+
+					data.InMemoryDB.RLock()
+					defer data.InMemoryDB.RUnlock()
+
+					var loans []data.Borrower
+					for _, loan := range data.InMemoryDB.Borrowers {
+						if (memberID == "" || loan.MemberID == memberID) &&
+							(!filterBook || loan.BookID == bookID) &&
+							(branch == "" || loan.Branch == branch) {
+							loans = append(loans, loan)
+						}
+					}
+					return connection(p, filterLoans(p, loans), loanCursor)
+				}),
+			},
+			"hold": &graphql.Field{
+				Type: holdType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNull(graphql.Int)}},
+				Resolve: guarded(auth.CirculationRead, func(p graphql.ResolveParams) (any, error) {
+					data.InMemoryDB.RLock()
+					defer data.InMemoryDB.RUnlock()
+
+					if hold, ok := data.InMemoryDB.Holds[p.Args["id"].(int)]; ok {
+						return hold, nil
+					}
+					return nil, nil
+				}),
+			},
+			"holds": &graphql.Field{
+				Type: holdConnection,
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"memberId": &graphql.ArgumentConfig{Type: graphql.ID},
+					"bookId":   &graphql.ArgumentConfig{Type: graphql.Int},
+					"branch":   &graphql.ArgumentConfig{Type: graphql.String},
+					"status":   &graphql.ArgumentConfig{Type: graphql.String},
+				}),
+				Resolve: guarded(auth.CirculationRead, func(p graphql.ResolveParams) (any, error) {
+					memberID, _ := p.Args["memberId"].(string)
+					bookID, filterBook := p.Args["bookId"].(int)
+					branch, _ := p.Args["branch"].(string)
+
+					data.InMemoryDB.RLock()
+					defer data.InMemoryDB.RUnlock()
+
+					var holds []data.Hold
+					for _, hold := range data.InMemoryDB.Holds {
+						if (memberID == "" || hold.MemberID == memberID) &&
+							(!filterBook || hold.BookID == bookID) &&
+							(branch == "" || hold.Branch == branch) {
+							holds = append(holds, hold)
+						}
+					}
+					return connection(p, filterHolds(p, holds), holdCursor)
+				}),
+			},
+		},
+	})
+
+	// Mutations make the same changes as the REST routes, with the same
+	// checks, events and audit entries
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createBook": &graphql.Field{
+				Type: bookType,
+				Args: graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: nonNull(bookInputType)}},
+				Resolve: guarded(auth.CatalogWrite, func(p graphql.ResolveParams) (any, error) {
+					req := requestFrom(p)
+					book, err := createBook(p.Context, bookInput(p.Args["input"].(map[string]any)))
+					if err != nil {
+						return nil, resolverError(req, changeStatus(err), err)
+					}
+					return book, nil
+				}),
+			},
+			"updateBook": &graphql.Field{
+				Type:        bookType,
+				Description: "Replaces a book's details, as PUT /books/update does",
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: nonNull(graphql.Int)},
+					"input": &graphql.ArgumentConfig{Type: nonNull(bookInputType)},
+				},
+				Resolve: guarded(auth.CatalogWrite, func(p graphql.ResolveParams) (any, error) {
+					req := requestFrom(p)
+					book, err := updateBook(p.Context, p.Args["id"].(int), bookInput(p.Args["input"].(map[string]any)))
+					if err != nil {
+						return nil, resolverError(req, changeStatus(err), err)
+					}
+					return book, nil
+				}),
+			},
+			"createMember": &graphql.Field{
+				Type: memberType,
+				Args: graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: nonNull(memberInputType)}},
+				Resolve: guarded(auth.MembersWrite, func(p graphql.ResolveParams) (any, error) {
+					req := requestFrom(p)
+					member, err := createMember(p.Context, memberInput(p.Args["input"].(map[string]any)))
+					if err != nil {
+						return nil, resolverError(req, changeStatus(err), err)
+					}
+					return member, nil
+				}),
+			},
+			"updateMember": &graphql.Field{
+				Type:        memberType,
+				Description: "Replaces a member's details, as PUT /members/update does",
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: nonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: nonNull(memberInputType)},
+				},
+				Resolve: guarded(auth.MembersWrite, func(p graphql.ResolveParams) (any, error) {
+					req := requestFrom(p)
+					member, err := updateMember(p.Context, p.Args["id"].(string), memberInput(p.Args["input"].(map[string]any)))
+					if err != nil {
+						return nil, resolverError(req, changeStatus(err), err)
+					}
+					return member, nil
+				}),
+			},
+			"checkout": &graphql.Field{
+				Type: loanType,
+				Args: graphql.FieldConfigArgument{
+					"memberId": &graphql.ArgumentConfig{Type: nonNull(graphql.ID)},
+					"bookId":   &graphql.ArgumentConfig{Type: nonNull(graphql.Int)},
+				},
+				Resolve: guarded(auth.CirculationWrite, func(p graphql.ResolveParams) (any, error) {
+					loan, err := circulation.Checkout(p.Context, p.Args["memberId"].(string), p.Args["bookId"].(int), time.Now())
+					if err != nil {
+						return nil, resolverError(requestFrom(p), circulationStatus(err), err)
+					}
+					return loan, nil
+				}),
+			},
+			"renewLoan": &graphql.Field{
+				Type: loanType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNull(graphql.Int)}},
+				Resolve: guarded(auth.CirculationWrite, func(p graphql.ResolveParams) (any, error) {
+					loan, err := circulation.Renew(p.Context, p.Args["id"].(int), time.Now())
+					if err != nil {
+						return nil, resolverError(requestFrom(p), circulationStatus(err), err)
+					}
+					return loan, nil
+				}),
+			},
+			"returnLoan": &graphql.Field{
+				Type: returnType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNull(graphql.Int)}},
+				Resolve: guarded(auth.CirculationWrite, func(p graphql.ResolveParams) (any, error) {
+					loan, fine, err := circulation.Return(p.Context, p.Args["id"].(int), time.Now())
+					if err != nil {
+						return nil, resolverError(requestFrom(p), circulationStatus(err), err)
+					}
+					result := map[string]any{"loan": loan, "fine": nil}
+					if fine != nil {
+						result["fine"] = *fine
+					}
+					return result, nil
+				}),
+			},
+			"placeHold": &graphql.Field{
+				Type: holdType,
+				Args: graphql.FieldConfigArgument{
+					"memberId": &graphql.ArgumentConfig{Type: nonNull(graphql.ID)},
+					"bookId":   &graphql.ArgumentConfig{Type: nonNull(graphql.Int)},
+				},
+				Resolve: guarded(auth.CirculationWrite, func(p graphql.ResolveParams) (any, error) {
+					hold, err := circulation.PlaceHold(p.Context, p.Args["memberId"].(string), p.Args["bookId"].(int), time.Now())
+					if err != nil {
+						return nil, resolverError(requestFrom(p), circulationStatus(err), err)
+					}
+					return hold, nil
+				}),
+			},
+			"cancelHold": &graphql.Field{
+				Type: holdType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNull(graphql.Int)}},
+				Resolve: guarded(auth.CirculationWrite, func(p graphql.ResolveParams) (any, error) {
+					hold, err := circulation.CancelHold(p.Context, p.Args["id"].(int), time.Now())
+					if err != nil {
+						return nil, resolverError(requestFrom(p), circulationStatus(err), err)
+					}
+					return hold, nil
+				}),
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+const defaultShelfSize = 5
+
+// GetShelfHandler returns the virtual shelf around a call number: the
+// closest books filed before it and the books filed at or after it.
+func GetShelfHandler(c *gin.Context) {
+	target, err := data.ParseCallNumber(c.Query("scheme"), c.Query("call_number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	size := defaultShelfSize
+	if sizeParam := c.Query("limit"); sizeParam != "" {
+		size, err = strconv.Atoi(sizeParam)
+		if err != nil || size <= 0 {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid limit"})
+			return
+		}
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	var shelved []data.Book
+	for _, book := range data.InMemoryDB.Books {
+		if book.CallNumberScheme == target.Scheme {
+			shelved = append(shelved, book)
+		}
+	}
+	sortShelfOrder(shelved)
+
+	pos := sort.Search(len(shelved), func(i int) bool {
+		return bookCallNumber(shelved[i]).Compare(target) >= 0
+	})
+
+	view := data.ShelfView{CallNumber: target}
+	view.Before = append([]data.Book{}, shelved[max(0, pos-size):pos]...)
+	view.After = append([]data.Book{}, shelved[pos:min(len(shelved), pos+size)]...)
+
+	c.JSON(http.StatusOK, view)
+}
+
+// classifyBook validates the book's call number and stores it in
+// normalized form, or clears the scheme when there is no call number.
+func classifyBook(book *data.Book) error {
+	if book.CallNumber == "" {
+		book.CallNumberScheme = ""
+		return nil
+	}
+	callNumber, err := data.ParseCallNumber(book.CallNumberScheme, book.CallNumber)
+	if err != nil {
+		return err
+	}
+	book.CallNumber = callNumber.Normalized
+	book.CallNumberScheme = callNumber.Scheme
+	return nil
+}
+
+// bookCallNumber parses a stored call number. Stored call numbers were
+// validated by classifyBook, so parsing cannot fail.
+func bookCallNumber(book data.Book) data.CallNumber {
+	callNumber, _ := data.ParseCallNumber(book.CallNumberScheme, book.CallNumber)
+	return callNumber
+}
+
+// sortShelfOrder sorts books by call number, with unclassified books last
+func sortShelfOrder(books []data.Book) {
+	sort.SliceStable(books, func(i, j int) bool {
+		if books[i].CallNumber == "" || books[j].CallNumber == "" {
+			return books[j].CallNumber == "" && books[i].CallNumber != ""
+		}
+		if cmp := bookCallNumber(books[i]).Compare(bookCallNumber(books[j])); cmp != 0 {
+			return cmp < 0
+		}
+		return books[i].ID < books[j].ID
+	})
+}
+
+// callNumberRange is an inclusive range of call numbers. The upper bound
+// also takes in everything it prefixes, so 800 to 899 includes 899.5.
+type callNumberRange struct {
+	from, to *data.CallNumber
+}
+
+// parseCallNumberRange parses the search range bounds, returning nil when
+// neither bound is given.
+func parseCallNumberRange(scheme, from, to string) (*callNumberRange, error) {
+	if from == "" && to == "" {
+		return nil, nil
+	}
+	r := &callNumberRange{}
+	if from != "" {
+		callNumber, err := data.ParseCallNumber(scheme, from)
+		if err != nil {
+			return nil, err
+		}
+		r.from = &callNumber
+	}
+	if to != "" {
+		callNumber, err := data.ParseCallNumber(scheme, to)
+		if err != nil {
+			return nil, err
+		}
+		r.to = &callNumber
+	}
+	return r, nil
+}
+
+func (r *callNumberRange) contains(book data.Book) bool {
+	if book.CallNumber == "" {
+		return false
+	}
+	callNumber := bookCallNumber(book)
+	if r.from != nil && (callNumber.Scheme != r.from.Scheme || callNumber.Compare(*r.from) < 0) {
+		return false
+	}
+	if r.to != nil && (callNumber.Scheme != r.to.Scheme || (callNumber.Compare(*r.to) > 0 && !callNumber.HasPrefix(*r.to))) {
+		return false
+	}
+	return true
+}
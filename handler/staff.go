@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// principalKey is the context key Require stores the caller under
+const principalKey = "principal"
+
+// StaffRequest creates or updates a staff user
+type StaffRequest struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	Password string `json:"password"`
+	Disabled bool   `json:"disabled"`
+}
+
+// Require authenticates a staff caller and checks that they hold the
+// permission, answering 401 or 403 otherwise.
+func Require(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := authenticate(c)
+		if !ok {
+			return
+		}
+		if !principal.Can(permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, data.ErrorResponse{Error: "Missing permission " + permission})
+			return
+		}
+		c.Next()
+	}
+}
+
+// authenticate resolves the caller's principal from an X-API-Key header
+// or the bearer token, aborting with 401 when there is neither. The
+// principal is cached on the context for later handlers.
+func authenticate(c *gin.Context) (auth.Principal, bool) {
+	if principal, ok := c.Get(principalKey); ok {
+		return principal.(auth.Principal), true
+	}
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		principal, ok := authenticateAPIKey(c, key)
+		if ok {
+			c.Set(principalKey, principal)
+		}
+		return principal, ok
+	}
+
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		unauthorized(c, "Missing bearer token")
+		return auth.Principal{}, false
+	}
+	principal, err := tokenPrincipal(token)
+	if err != nil {
+		unauthorized(c, err.Error())
+		return auth.Principal{}, false
+	}
+	c.Set(principalKey, principal)
+	return principal, true
+}
+
+// tokenPrincipal resolves the principal for a staff access token, which
+// stops working once the staff user is disabled or removed
+func tokenPrincipal(token string) (auth.Principal, error) {
+	claims, err := Tokens.Verify(token)
+	if err != nil || claims.Kind != auth.PrincipalStaff {
+		return auth.Principal{}, auth.ErrInvalidToken
+	}
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return auth.Principal{}, auth.ErrInvalidToken
+	}
+
+	data.InMemoryDB.RLock()
+	staff, found := data.InMemoryDB.Staff[id]
+	data.InMemoryDB.RUnlock()
+
+	if !found || staff.Disabled {
+		return auth.Principal{}, auth.ErrInvalidToken
+	}
+	return staffPrincipal(staff), nil
+}
+
+// EnsureAdmin creates the first admin account when there are no staff
+// users yet, so a fresh deployment can be administered.
+func EnsureAdmin(username, password string) error {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	if len(data.InMemoryDB.Staff) > 0 {
+		return nil
+	}
+	storeStaff(data.StaffUser{Username: username, Name: username, Role: auth.RoleAdmin, PasswordHash: hash})
+	return nil
+}
+
+func StaffLoginHandler(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	staff, _ := findStaff(req.Login)
+	data.InMemoryDB.RUnlock()
+
+	if !auth.CheckPassword(staff.PasswordHash, req.Password) || staff.Disabled {
+		c.JSON(http.StatusUnauthorized, data.ErrorResponse{Error: "Invalid login or password"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	tokens, err := issueStaffTokens(staff, "")
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to create session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// GetCurrentStaffHandler returns the authenticated caller and their
+// permissions
+func GetCurrentStaffHandler(c *gin.Context) {
+	principal, ok := authenticate(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, principal)
+}
+
+func GetRolesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, auth.RolePermissions)
+}
+
+func CreateStaffHandler(c *gin.Context) {
+	var req StaffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	req.Username = strings.ToLower(strings.TrimSpace(req.Username))
+	if req.Username == "" {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Username is required"})
+		return
+	}
+	if !auth.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Unknown role"})
+		return
+	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		passwordError(c, err)
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	if _, ok := findStaff(req.Username); ok {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Username is already in use"})
+		return
+	}
+
+	staff := storeStaff(data.StaffUser{
+		Username:     req.Username,
+		Name:         req.Name,
+		Role:         req.Role,
+		Disabled:     req.Disabled,
+		PasswordHash: hash,
+	})
+	recordAudit(c, "create", EntityStaff, staff.ID, nil, staff)
+
+	c.JSON(http.StatusOK, staff)
+}
+
+func GetAllStaffHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	staff := make([]data.StaffUser, 0, len(data.InMemoryDB.Staff))
+	for id := 0; id < data.InMemoryDB.NextStaffID; id++ {
+		if user, ok := data.InMemoryDB.Staff[id]; ok {
+			staff = append(staff, user)
+		}
+	}
+
+	c.JSON(http.StatusOK, staff)
+}
+
+// UpdateStaffHandler changes a staff user's name, role or disabled flag.
+// Disabling a user ends their sessions. Callers may rename themselves but
+// not change their own role or disable themselves, so that an admin cannot
+// leave the service without one.
+func UpdateStaffHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid staff ID"})
+		return
+	}
+
+	var req StaffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if !auth.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Unknown role"})
+		return
+	}
+	principal, _ := authenticate(c)
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	staff, ok := data.InMemoryDB.Staff[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Staff user not found"})
+		return
+	}
+	if principal.ID == strconv.Itoa(id) && (req.Role != staff.Role || req.Disabled) {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Cannot change your own role or disable your own account"})
+		return
+	}
+
+	before := staff
+	staff.Name = req.Name
+	staff.Role = req.Role
+	staff.Disabled = req.Disabled
+	data.InMemoryDB.Staff[id] = staff
+	if staff.Disabled {
+		endStaffSessions(id)
+	}
+	recordAudit(c, "update", EntityStaff, id, before, staff)
+
+	c.JSON(http.StatusOK, staff)
+}
+
+// SetStaffPasswordHandler sets a staff user's password and ends their
+// sessions
+func SetStaffPasswordHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid staff ID"})
+		return
+	}
+
+	var req PasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		passwordError(c, err)
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	staff, ok := data.InMemoryDB.Staff[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Staff user not found"})
+		return
+	}
+	staff.PasswordHash = hash
+	data.InMemoryDB.Staff[id] = staff
+	endStaffSessions(id)
+	recordAudit(c, "password", EntityStaff, id, nil, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+func DeleteStaffHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid staff ID"})
+		return
+	}
+	principal, _ := authenticate(c)
+	if principal.ID == strconv.Itoa(id) {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Cannot delete your own account"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	staff, ok := data.InMemoryDB.Staff[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Staff user not found"})
+		return
+	}
+	delete(data.InMemoryDB.Staff, id)
+	endStaffSessions(id)
+	recordAudit(c, "delete", EntityStaff, id, staff, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// findStaff looks a staff user up by username.
+// The caller must hold the database lock.
+func findStaff(username string) (data.StaffUser, bool) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	for _, staff := range data.InMemoryDB.Staff {
+		if staff.Username == username {
+			return staff, true
+		}
+	}
+	return data.StaffUser{}, false
+}
+
+// storeStaff assigns the next ID to a new staff user and saves it.
+// The caller must hold the database lock.
+func storeStaff(staff data.StaffUser) data.StaffUser {
+	staff.ID = data.InMemoryDB.NextStaffID
+	staff.Username = strings.ToLower(strings.TrimSpace(staff.Username))
+	staff.Created = time.Now()
+	data.InMemoryDB.Staff[staff.ID] = staff
+	data.InMemoryDB.NextStaffID++
+	return staff
+}
+
+// staffPrincipal builds the principal for a staff user from their
+// current role
+func staffPrincipal(staff data.StaffUser) auth.Principal {
+	return auth.NewStaffPrincipal(strconv.Itoa(staff.ID), staff.Username, staff.Role)
+}
+
+// endStaffSessions revokes all of a staff user's refresh tokens. Access
+// tokens already issued stay valid until they expire, unless the user is
+// disabled or deleted.
+// The caller must hold the database lock.
+func endStaffSessions(staffID int) {
+	for key, token := range data.InMemoryDB.RefreshTokens {
+		if token.StaffID == staffID {
+			delete(data.InMemoryDB.RefreshTokens, key)
+		}
+	}
+}
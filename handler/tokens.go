@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// Tokens signs and verifies staff access tokens
+var Tokens *auth.TokenIssuer
+
+// TokenResponse carries a new access token and the refresh token that
+// replaces it when it expires
+type TokenResponse struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresIn    int       `json:"expires_in"`
+	Expires      time.Time `json:"expires"`
+	RefreshToken string    `json:"refresh_token"`
+}
+
+// RefreshRequest carries a refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token
+// and refresh token. Presenting a refresh token that was already used
+// revokes every token descended from the same login.
+func RefreshTokenHandler(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	key := auth.HashToken(req.RefreshToken)
+	now := time.Now()
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	token, ok := data.InMemoryDB.RefreshTokens[key]
+	if !ok || now.After(token.Expires) {
+		c.JSON(http.StatusUnauthorized, data.ErrorResponse{Error: "Invalid or expired refresh token"})
+		return
+	}
+	if token.Revoked != nil {
+		revokeTokenFamily(token.Family)
+		c.JSON(http.StatusUnauthorized, data.ErrorResponse{Error: "Invalid or expired refresh token"})
+		return
+	}
+	staff, ok := data.InMemoryDB.Staff[token.StaffID]
+	if !ok || staff.Disabled {
+		c.JSON(http.StatusUnauthorized, data.ErrorResponse{Error: "Invalid or expired refresh token"})
+		return
+	}
+
+	token.Revoked = &now
+	data.InMemoryDB.RefreshTokens[key] = token
+
+	tokens, err := issueStaffTokens(staff, token.Family)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to create session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// StaffLogoutHandler revokes the refresh token and every token issued
+// from the same login
+func StaffLogoutHandler(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	if token, ok := data.InMemoryDB.RefreshTokens[auth.HashToken(req.RefreshToken)]; ok {
+		revokeTokenFamily(token.Family)
+	}
+	data.InMemoryDB.Unlock()
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeStaffSessionsHandler revokes all of a staff user's refresh tokens
+func RevokeStaffSessionsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid staff ID"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	if _, ok := data.InMemoryDB.Staff[id]; !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Staff user not found"})
+		return
+	}
+	endStaffSessions(id)
+	recordAudit(c, "revoke", EntityStaff, id, nil, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetJWKSHandler publishes the public keys access tokens can be verified
+// with
+func GetJWKSHandler(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, Tokens.Keys.JWKS())
+}
+
+// issueStaffTokens signs an access token for the staff user and stores a
+// new refresh token in the family, starting a new family when it is
+// empty. Expired refresh tokens are pruned along the way.
+// The caller must hold the database lock.
+func issueStaffTokens(staff data.StaffUser, family string) (TokenResponse, error) {
+	now := time.Now()
+	access, expires, err := Tokens.Issue(staffPrincipal(staff), now)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	refresh, err := auth.NewToken()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if family == "" {
+		if family, err = auth.NewToken(); err != nil {
+			return TokenResponse{}, err
+		}
+	}
+
+	for key, token := range data.InMemoryDB.RefreshTokens {
+		if now.After(token.Expires) {
+			delete(data.InMemoryDB.RefreshTokens, key)
+		}
+	}
+	data.InMemoryDB.RefreshTokens[auth.HashToken(refresh)] = data.RefreshToken{
+		StaffID: staff.ID,
+		Family:  family,
+		Created: now,
+		Expires: now.Add(data.RefreshTokenTTL),
+	}
+
+	return TokenResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(expires.Sub(now).Seconds()),
+		Expires:      expires,
+		RefreshToken: refresh,
+	}, nil
+}
+
+// revokeTokenFamily removes every refresh token issued from one login.
+// The caller must hold the database lock.
+func revokeTokenFamily(family string) {
+	for key, token := range data.InMemoryDB.RefreshTokens {
+		if token.Family == family {
+			delete(data.InMemoryDB.RefreshTokens, key)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// trash wraps a record being deleted so it can be restored
+func trash[T any](c *gin.Context, value T) data.Trashed[T] {
+	actor, _ := auditActor(c)
+	now := time.Now()
+	return data.Trashed[T]{
+		Value:     value,
+		Deleted:   now,
+		DeletedBy: actor,
+		Expires:   now.Add(data.TrashRetention),
+	}
+}
+
+// pruneBookGenres drops genres that have since been merged away from a
+// book being brought back, so its genre name can be resolved again.
+// The caller must hold the database lock.
+func pruneBookGenres(book *data.Book) {
+	var ids []int
+	for _, id := range book.GenreIDs {
+		if _, ok := data.InMemoryDB.Genres[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	book.GenreIDs = ids
+}
+
+func GetTrashedBooksHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	books := make([]data.Trashed[data.Book], 0, len(data.InMemoryDB.TrashedBooks))
+	for _, book := range data.InMemoryDB.TrashedBooks {
+		books = append(books, book)
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].Deleted.After(books[j].Deleted) })
+
+	c.JSON(http.StatusOK, books)
+}
+
+// RestoreBookHandler brings a book back from the trash under its old ID
+func RestoreBookHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid book ID"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	trashed, ok := data.InMemoryDB.TrashedBooks[id]
+	if !ok || time.Now().After(trashed.Expires) {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Book not in trash"})
+		return
+	}
+
+	book := trashed.Value
+	pruneBookGenres(&book)
+	if err := linkBookAuthors(&book); err != nil {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Cannot restore: " + err.Error()})
+		return
+	}
+	if err := linkBookGenres(&book); err != nil {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Cannot restore: " + err.Error()})
+		return
+	}
+
+	delete(data.InMemoryDB.TrashedBooks, id)
+	data.InMemoryDB.Books[id] = book
+	recordVersion(eventContext(c), data.InMemoryDB.BookVersions, id, "restore", book)
+	bus.Publish(eventContext(c), data.BookRestored{Book: book})
+
+	c.JSON(http.StatusOK, book)
+}
+
+func GetTrashedMembersHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	members := make([]data.Trashed[data.Member], 0, len(data.InMemoryDB.TrashedMembers))
+	for _, member := range data.InMemoryDB.TrashedMembers {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Deleted.After(members[j].Deleted) })
+
+	c.JSON(http.StatusOK, members)
+}
+
+// RestoreMemberHandler brings a member back from the trash under their old
+// ID. They sign in again with their old password.
+func RestoreMemberHandler(c *gin.Context) {
+	id := c.Query("id")
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	trashed, ok := data.InMemoryDB.TrashedMembers[id]
+	if !ok || time.Now().After(trashed.Expires) {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Member not in trash"})
+		return
+	}
+
+	member := trashed.Value
+	if !emailAvailable(member.Email, member.ID) {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Cannot restore: email is already in use"})
+		return
+	}
+
+	delete(data.InMemoryDB.TrashedMembers, id)
+	storeMember(member)
+	recordVersion(eventContext(c), data.InMemoryDB.MemberVersions, id, "restore", member)
+	bus.Publish(eventContext(c), data.MemberRestored{Member: member})
+
+	c.JSON(http.StatusOK, member)
+}
+
+// PurgeTrash permanently removes books and members whose retention period
+// has run out, with their version history and cover images, and returns
+// how many were removed. Loans, holds and fines that refer to them are
+// kept.
+func PurgeTrash(now time.Time) int {
+	data.InMemoryDB.Lock()
+
+	var covers []data.Book
+	purged := 0
+	for id, trashed := range data.InMemoryDB.TrashedBooks {
+		if now.After(trashed.Expires) {
+			if trashed.Value.Cover != nil {
+				covers = append(covers, trashed.Value)
+			}
+			delete(data.InMemoryDB.TrashedBooks, id)
+			delete(data.InMemoryDB.BookVersions, id)
+			purged++
+		}
+	}
+	for id, trashed := range data.InMemoryDB.TrashedMembers {
+		if now.After(trashed.Expires) {
+			delete(data.InMemoryDB.TrashedMembers, id)
+			delete(data.InMemoryDB.MemberVersions, id)
+			delete(data.InMemoryDB.NotificationPrefs, id)
+			purged++
+		}
+	}
+
+	data.InMemoryDB.Unlock()
+
+	for _, book := range covers {
+		deleteCoverBlobs(book.ID, book.Cover)
+	}
+	return purged
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// recordVersion appends a record's new state to its history, attributed to
+// the caller carried by ctx.
+// The caller must hold the database lock.
+func recordVersion[K comparable, T any](ctx context.Context, history map[K][]data.Version[T], id K, action string, value T) {
+	actor := bus.MetaFrom(ctx).Actor
+	versions := history[id]
+	history[id] = append(versions, data.Version[T]{
+		Number: len(versions) + 1,
+		Action: action,
+		Actor:  actor,
+		Time:   time.Now(),
+		Value:  value,
+	})
+}
+
+func findVersion[T any](versions []data.Version[T], number int) (data.Version[T], bool) {
+	if number < 1 || number > len(versions) {
+		return data.Version[T]{}, false
+	}
+	return versions[number-1], true
+}
+
+// diffVersions answers with the fields that differ between the versions
+// named by the from and to parameters
+func diffVersions[T any](c *gin.Context, versions []data.Version[T]) {
+	fromNumber, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid from version"})
+		return
+	}
+	toNumber, err := strconv.Atoi(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid to version"})
+		return
+	}
+	from, ok := findVersion(versions, fromNumber)
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Version " + c.Query("from") + " not found"})
+		return
+	}
+	to, ok := findVersion(versions, toNumber)
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Version " + c.Query("to") + " not found"})
+		return
+	}
+
+	changes, err := diffFields(from.Value, to.Value)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to compare versions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, data.VersionDiff{From: fromNumber, To: toNumber, Changes: changes})
+}
+
+// diffFields compares two records by their top-level JSON fields
+func diffFields(from, to any) ([]data.FieldChange, error) {
+	before, err := jsonFields(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := jsonFields(to)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	changes := []data.FieldChange{}
+	for _, name := range sorted {
+		if !reflect.DeepEqual(before[name], after[name]) {
+			changes = append(changes, data.FieldChange{Field: name, From: before[name], To: after[name]})
+		}
+	}
+	return changes, nil
+}
+
+func jsonFields(v any) (map[string]any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	err = json.Unmarshal(b, &fields)
+	return fields, err
+}
+
+func GetBookVersionsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid book ID"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	versions, ok := data.InMemoryDB.BookVersions[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Book not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+func GetBookDiffHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid book ID"})
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	versions, ok := data.InMemoryDB.BookVersions[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Book not found"})
+		return
+	}
+
+	diffVersions(c, versions)
+}
+
+// RevertBookHandler saves an earlier version of a book as its newest
+// version. The current cover is kept.
+func RevertBookHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid book ID"})
+		return
+	}
+	number, err := strconv.Atoi(c.Query("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid version"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	old, ok := data.InMemoryDB.Books[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Book not found"})
+		return
+	}
+	version, ok := findVersion(data.InMemoryDB.BookVersions[id], number)
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Version not found"})
+		return
+	}
+
+	reverted := version.Value
+	pruneBookGenres(&reverted)
+	reverted, err = replaceBook(old, reverted)
+	if err != nil {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Cannot revert: " + err.Error()})
+		return
+	}
+	recordVersion(eventContext(c), data.InMemoryDB.BookVersions, id, "revert", reverted)
+	bus.Publish(eventContext(c), data.BookReverted{Before: old, After: reverted})
+
+	c.JSON(http.StatusOK, reverted)
+}
+
+func GetMemberVersionsHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	versions, ok := data.InMemoryDB.MemberVersions[c.Query("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Member not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+func GetMemberDiffHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	versions, ok := data.InMemoryDB.MemberVersions[c.Query("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Member not found"})
+		return
+	}
+
+	diffVersions(c, versions)
+}
+
+// RevertMemberHandler saves an earlier version of a member's details as
+// their newest version. Status and password are not reverted.
+func RevertMemberHandler(c *gin.Context) {
+	id := c.Query("id")
+	number, err := strconv.Atoi(c.Query("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid version"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	old, ok := data.InMemoryDB.Members[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Member not found"})
+		return
+	}
+	version, ok := findVersion(data.InMemoryDB.MemberVersions[id], number)
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Version not found"})
+		return
+	}
+
+	reverted := version.Value
+	reverted.ID = old.ID
+	reverted.Status = old.Status
+	reverted.StatusReason = old.StatusReason
+	reverted.SuspendedUntil = old.SuspendedUntil
+	reverted.PasswordHash = old.PasswordHash
+	if err := validateMember(&reverted); err != nil {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Cannot revert: " + err.Error()})
+		return
+	}
+	if !emailAvailable(reverted.Email, reverted.ID) {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Cannot revert: email is already in use"})
+		return
+	}
+
+	delete(data.InMemoryDB.MemberEmails, strings.ToLower(old.Email))
+	storeMember(reverted)
+	recordVersion(eventContext(c), data.InMemoryDB.MemberVersions, id, "revert", reverted)
+	bus.Publish(eventContext(c), data.MemberReverted{Before: old, After: reverted})
+
+	c.JSON(http.StatusOK, reverted)
+}
@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/data"
+	"github.com/jerrylovee2/gogo/webhook"
+)
+
+// Webhooks delivers events to subscribers' webhooks
+var Webhooks = newWebhooks()
+
+func newWebhooks() *webhook.Dispatcher {
+	d := webhook.New()
+	d.Allowed = webhookOwnerAllowed
+	return d
+}
+
+// WebhookRequest creates or replaces a webhook. Active defaults to true
+// for a new webhook and is left as it was when updating.
+type WebhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+// WebhookResponse carries a new webhook or rotated secret. The secret is
+// only ever shown here.
+type WebhookResponse struct {
+	data.Webhook
+	Secret string `json:"secret"`
+}
+
+func GetWebhookEventsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, data.EventTypes)
+}
+
+func CreateWebhookHandler(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if !validWebhookRequest(c, req) {
+		return
+	}
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to create webhook"})
+		return
+	}
+	owner, _ := auditActor(c)
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	hook := data.Webhook{
+		ID:          data.InMemoryDB.NextWebhookID,
+		URL:         req.URL,
+		Events:      req.Events,
+		Description: req.Description,
+		Active:      req.Active == nil || *req.Active,
+		Owner:       owner,
+		Created:     time.Now(),
+		Secret:      secret,
+	}
+	data.InMemoryDB.Webhooks[hook.ID] = hook
+	data.InMemoryDB.NextWebhookID++
+	recordAudit(c, "create", EntityWebhook, hook.ID, nil, hook)
+
+	c.JSON(http.StatusOK, WebhookResponse{Webhook: hook, Secret: secret})
+}
+
+// GetWebhooksHandler lists the caller's webhooks, or every webhook for
+// staff administrators
+func GetWebhooksHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	hooks := []data.Webhook{}
+	for _, hook := range data.InMemoryDB.Webhooks {
+		if ownsWebhook(c, hook) {
+			hooks = append(hooks, hook)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+
+	c.JSON(http.StatusOK, hooks)
+}
+
+func GetWebhookHandler(c *gin.Context) {
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	hook, ok := findWebhook(c, c.Query("id"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, hook)
+}
+
+// UpdateWebhookHandler replaces a webhook's URL, events and description,
+// and pauses or resumes it. Deliveries to a paused webhook wait until it
+// is resumed.
+func UpdateWebhookHandler(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid JSON"})
+		return
+	}
+	if !validWebhookRequest(c, req) {
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	hook, ok := findWebhook(c, c.Query("id"))
+	if !ok {
+		return
+	}
+	before := hook
+	hook.URL = req.URL
+	hook.Events = req.Events
+	hook.Description = req.Description
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	data.InMemoryDB.Webhooks[hook.ID] = hook
+	recordAudit(c, "update", EntityWebhook, hook.ID, before, hook)
+	if hook.Active {
+		Webhooks.Wake()
+	}
+
+	c.JSON(http.StatusOK, hook)
+}
+
+// DeleteWebhookHandler removes a webhook along with its deliveries
+func DeleteWebhookHandler(c *gin.Context) {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	hook, ok := findWebhook(c, c.Query("id"))
+	if !ok {
+		return
+	}
+	delete(data.InMemoryDB.Webhooks, hook.ID)
+	for id, delivery := range data.InMemoryDB.WebhookDeliveries {
+		if delivery.WebhookID == hook.ID {
+			delete(data.InMemoryDB.WebhookDeliveries, id)
+		}
+	}
+	recordAudit(c, "delete", EntityWebhook, hook.ID, hook, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// RotateWebhookSecretHandler replaces a webhook's signing secret. Attempts
+// from then on are signed with the new one.
+func RotateWebhookSecretHandler(c *gin.Context) {
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, data.ErrorResponse{Error: "Failed to create secret"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	hook, ok := findWebhook(c, c.Query("id"))
+	if !ok {
+		return
+	}
+	hook.Secret = secret
+	data.InMemoryDB.Webhooks[hook.ID] = hook
+	recordAudit(c, "rotate", EntityWebhook, hook.ID, nil, hook)
+
+	c.JSON(http.StatusOK, WebhookResponse{Webhook: hook, Secret: secret})
+}
+
+// GetWebhookDeliveriesHandler is a webhook's delivery log, newest first,
+// optionally only deliveries with a given status
+func GetWebhookDeliveriesHandler(c *gin.Context) {
+	status := c.Query("status")
+	limit, ok := deliveryLimit(c)
+	if !ok {
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	hook, ok := findWebhook(c, c.Query("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, webhookDeliveries(c, limit, func(delivery data.WebhookDelivery) bool {
+		return delivery.WebhookID == hook.ID && (status == "" || delivery.Status == status)
+	}))
+}
+
+// GetDeadLettersHandler lists deliveries that failed every attempt, newest
+// first, across the caller's webhooks
+func GetDeadLettersHandler(c *gin.Context) {
+	limit, ok := deliveryLimit(c)
+	if !ok {
+		return
+	}
+
+	data.InMemoryDB.RLock()
+	defer data.InMemoryDB.RUnlock()
+
+	c.JSON(http.StatusOK, webhookDeliveries(c, limit, func(delivery data.WebhookDelivery) bool {
+		return delivery.Status == data.DeliveryDead
+	}))
+}
+
+// RedeliverWebhookHandler queues a delivery again with a fresh set of
+// attempts, typically a dead letter once the subscriber has recovered
+func RedeliverWebhookHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("delivery_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid delivery ID"})
+		return
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	delivery, ok := data.InMemoryDB.WebhookDeliveries[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Delivery not found"})
+		return
+	}
+	if _, ok := findWebhook(c, strconv.Itoa(delivery.WebhookID)); !ok {
+		return
+	}
+	if delivery.Status == data.DeliveryPending {
+		c.JSON(http.StatusConflict, data.ErrorResponse{Error: "Delivery is already pending"})
+		return
+	}
+
+	before := delivery
+	delivery.Status = data.DeliveryPending
+	delivery.Failures = 0
+	delivery.NextAttempt = time.Now()
+	data.InMemoryDB.WebhookDeliveries[id] = delivery
+	recordAudit(c, "redeliver", EntityWebhookDelivery, id, before, delivery)
+	Webhooks.Wake()
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// validWebhookRequest checks a webhook's URL and events, answering 400 or
+// 403 when they will not do
+func validWebhookRequest(c *gin.Context, req WebhookRequest) bool {
+	if err := webhook.CheckURL(c.Request.Context(), req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if len(req.Events) == 0 {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "At least one event is required"})
+		return false
+	}
+	principal, _ := authenticate(c)
+	for _, event := range req.Events {
+		permission, ok := eventPermissions[event]
+		if !ok {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Unknown event " + event})
+			return false
+		}
+		if !principal.Can(permission) {
+			c.JSON(http.StatusForbidden, data.ErrorResponse{Error: "Subscribing to " + event + " requires " + permission})
+			return false
+		}
+	}
+	return true
+}
+
+// webhookOwnerAllowed reports whether a webhook's owner, as kind:id, still
+// exists and may receive an event type. Webhooks of staff users who have
+// been disabled, removed or demoted, and of revoked API keys, stop
+// receiving the events they can no longer read.
+// The caller must hold the database lock.
+func webhookOwnerAllowed(owner, eventType string) bool {
+	principal, ok := ownerPrincipal(owner)
+	return ok && principal.Can(eventPermissions[eventType])
+}
+
+// ownerPrincipal resolves the current principal for a caller recorded as
+// kind:id.
+// The caller must hold the database lock.
+func ownerPrincipal(owner string) (auth.Principal, bool) {
+	kind, idText, _ := strings.Cut(owner, ":")
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return auth.Principal{}, false
+	}
+	switch kind {
+	case auth.PrincipalStaff:
+		staff, ok := data.InMemoryDB.Staff[id]
+		if !ok || staff.Disabled {
+			return auth.Principal{}, false
+		}
+		return staffPrincipal(staff), true
+	case auth.PrincipalAPIKey:
+		apiKey, ok := data.InMemoryDB.APIKeys[id]
+		if !ok || apiKey.Revoked != nil {
+			return auth.Principal{}, false
+		}
+		return auth.NewAPIKeyPrincipal(strconv.Itoa(apiKey.ID), apiKey.Name, apiKey.Scopes), true
+	}
+	return auth.Principal{}, false
+}
+
+// findWebhook looks up a webhook the caller may manage, answering 400 or
+// 404 when there is none. Other subscribers' webhooks are not found.
+// The caller must hold the database lock.
+func findWebhook(c *gin.Context, idParam string) (data.Webhook, bool) {
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Invalid webhook ID"})
+		return data.Webhook{}, false
+	}
+	hook, ok := data.InMemoryDB.Webhooks[id]
+	if !ok || !ownsWebhook(c, hook) {
+		c.JSON(http.StatusNotFound, data.ErrorResponse{Error: "Webhook not found"})
+		return data.Webhook{}, false
+	}
+	return hook, true
+}
+
+// ownsWebhook reports whether the caller created the webhook or is a
+// staff administrator
+func ownsWebhook(c *gin.Context, hook data.Webhook) bool {
+	principal, _ := authenticate(c)
+	owner, _ := auditActor(c)
+	return hook.Owner == owner || principal.Can(auth.StaffAdmin)
+}
+
+func deliveryLimit(c *gin.Context) (int, bool) {
+	limit := 100
+	if param := c.Query("limit"); param != "" {
+		var err error
+		if limit, err = strconv.Atoi(param); err != nil || limit < 1 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, data.ErrorResponse{Error: "Limit must be between 1 and 1000"})
+			return 0, false
+		}
+	}
+	return limit, true
+}
+
+// webhookDeliveries returns up to limit matching deliveries to the
+// caller's webhooks, newest first.
+// The caller must hold the database lock.
+func webhookDeliveries(c *gin.Context, limit int, match func(data.WebhookDelivery) bool) []data.WebhookDelivery {
+	deliveries := []data.WebhookDelivery{}
+	for _, delivery := range data.InMemoryDB.WebhookDeliveries {
+		if hook, ok := data.InMemoryDB.Webhooks[delivery.WebhookID]; ok && ownsWebhook(c, hook) && match(delivery) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries
+}
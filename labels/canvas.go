@@ -0,0 +1,49 @@
+package labels
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// canvas is a drawing surface with a top-left origin. Label sheets are
+// drawn once against this interface and emitted as either SVG or PDF.
+type canvas interface {
+	rect(x, y, w, h float64)
+	// text draws left-aligned text with its baseline at y
+	text(x, y, size float64, s string)
+	// centeredText draws text centred on x with its baseline at y
+	centeredText(x, y, size float64, s string)
+}
+
+type svgCanvas struct {
+	strings.Builder
+}
+
+// newSVGCanvas starts an SVG document whose user units are the given
+// physical unit, e.g. "mm" for label sheets or "px" for screen images.
+func newSVGCanvas(width, height float64, unit string) *svgCanvas {
+	cv := &svgCanvas{}
+	fmt.Fprintf(cv, `<svg xmlns="http://www.w3.org/2000/svg" width="%g%s" height="%g%s" viewBox="0 0 %g %g">`,
+		width, unit, height, unit, width, height)
+	fmt.Fprintf(cv, `<rect width="%g" height="%g" fill="#fff"/>`, width, height)
+	return cv
+}
+
+func (cv *svgCanvas) rect(x, y, w, h float64) {
+	fmt.Fprintf(cv, `<rect x="%.3f" y="%.3f" width="%.3f" height="%.3f"/>`, x, y, w, h)
+}
+
+func (cv *svgCanvas) text(x, y, size float64, s string) {
+	fmt.Fprintf(cv, `<text x="%.3f" y="%.3f" font-family="Helvetica,Arial,sans-serif" font-size="%.3f">%s</text>`,
+		x, y, size, html.EscapeString(s))
+}
+
+func (cv *svgCanvas) centeredText(x, y, size float64, s string) {
+	fmt.Fprintf(cv, `<text x="%.3f" y="%.3f" font-family="Helvetica,Arial,sans-serif" font-size="%.3f" text-anchor="middle">%s</text>`,
+		x, y, size, html.EscapeString(s))
+}
+
+func (cv *svgCanvas) String() string {
+	return cv.Builder.String() + "</svg>"
+}
@@ -0,0 +1,97 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// pointsPerMM converts millimetres to PDF points
+const pointsPerMM = 72 / 25.4
+
+// pdfPage is one page of a PDF document, drawn in millimetres with a
+// top-left origin and converted to PDF's bottom-left point space.
+type pdfPage struct {
+	height  float64
+	content bytes.Buffer
+}
+
+func (p *pdfPage) rect(x, y, w, h float64) {
+	fmt.Fprintf(&p.content, "%.2f %.2f %.2f %.2f re f\n",
+		x*pointsPerMM, (p.height-y-h)*pointsPerMM, w*pointsPerMM, h*pointsPerMM)
+}
+
+func (p *pdfPage) text(x, y, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F1 %.2f Tf %.2f %.2f Td (%s) Tj ET\n",
+		size*pointsPerMM, x*pointsPerMM, (p.height-y)*pointsPerMM, pdfString(s))
+}
+
+// centeredText estimates the text width from Helvetica's average glyph
+// width, which is close enough for short labels and barcode digits.
+func (p *pdfPage) centeredText(x, y, size float64, s string) {
+	p.text(x-textWidth(size, s)/2, y, size, s)
+}
+
+// textWidth approximates the width of s set in Helvetica at the given size
+func textWidth(size float64, s string) float64 {
+	return float64(len([]rune(s))) * size * 0.55
+}
+
+// pdfString escapes text for a PDF literal string. The font uses
+// WinAnsiEncoding, so characters outside Latin-1 become '?'.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '…':
+			b.WriteString(`\205`)
+		case r < 0x20 || r > 0xff:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
+
+// writePDF assembles the pages into a PDF document of the given page size
+// in millimetres, using the built-in Helvetica font.
+func writePDF(w io.Writer, pages []*pdfPage, width, height float64) error {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// Objects 1-3 are the catalog, page tree and font; each page then
+	// takes two objects, the page and its content stream.
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %.2f %.2f] >>",
+		strings.Join(kids, " "), len(pages), width*pointsPerMM, height*pointsPerMM))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	for i, page := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.content.Len(), page.content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := out.WriteTo(w)
+	return err
+}
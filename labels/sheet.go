@@ -0,0 +1,143 @@
+package labels
+
+import (
+	"fmt"
+	"io"
+)
+
+// Stock describes a sheet of label stock. All measurements are in
+// millimetres from the top-left corner of the page.
+type Stock struct {
+	Name            string  `json:"name"`
+	PageWidth       float64 `json:"page_width"`
+	PageHeight      float64 `json:"page_height"`
+	Columns         int     `json:"columns"`
+	Rows            int     `json:"rows"`
+	LabelWidth      float64 `json:"label_width"`
+	LabelHeight     float64 `json:"label_height"`
+	TopMargin       float64 `json:"top_margin"`
+	LeftMargin      float64 `json:"left_margin"`
+	HorizontalPitch float64 `json:"horizontal_pitch"`
+	VerticalPitch   float64 `json:"vertical_pitch"`
+}
+
+// Stocks lists the supported label stock by name
+var Stocks = map[string]Stock{
+	"avery-5160": {
+		Name: "avery-5160", PageWidth: 215.9, PageHeight: 279.4,
+		Columns: 3, Rows: 10, LabelWidth: 66.675, LabelHeight: 25.4,
+		TopMargin: 12.7, LeftMargin: 4.7625, HorizontalPitch: 69.85, VerticalPitch: 25.4,
+	},
+	"avery-5163": {
+		Name: "avery-5163", PageWidth: 215.9, PageHeight: 279.4,
+		Columns: 2, Rows: 5, LabelWidth: 101.6, LabelHeight: 50.8,
+		TopMargin: 12.7, LeftMargin: 3.96875, HorizontalPitch: 106.3625, VerticalPitch: 50.8,
+	},
+	"avery-l7160": {
+		Name: "avery-l7160", PageWidth: 210, PageHeight: 297,
+		Columns: 3, Rows: 7, LabelWidth: 63.5, LabelHeight: 38.1,
+		TopMargin: 15.15, LeftMargin: 7.21, HorizontalPitch: 66.04, VerticalPitch: 38.1,
+	},
+}
+
+// PerPage is the number of labels on one sheet
+func (s Stock) PerPage() int {
+	return s.Columns * s.Rows
+}
+
+// Label is the content printed on one label. Code is encoded as the
+// barcode and also printed as text.
+type Label struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle"`
+	Code     string `json:"code"`
+}
+
+const (
+	labelPadding = 2.0
+	titleSize    = 2.8
+	subtitleSize = 2.4
+	codeSize     = 2.2
+)
+
+// WriteSheetSVG renders the labels onto a single SVG page. Batches larger
+// than one sheet need the PDF format.
+func WriteSheetSVG(w io.Writer, stock Stock, kind string, labels []Label) error {
+	if len(labels) > stock.PerPage() {
+		return fmt.Errorf("%d labels do not fit on one %s sheet of %d", len(labels), stock.Name, stock.PerPage())
+	}
+	cv := newSVGCanvas(stock.PageWidth, stock.PageHeight, "mm")
+	if err := drawSheet(cv, stock, kind, labels); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, cv.String())
+	return err
+}
+
+// WriteSheetPDF renders the labels onto as many PDF pages as needed
+func WriteSheetPDF(w io.Writer, stock Stock, kind string, labels []Label) error {
+	var pages []*pdfPage
+	for start := 0; start < len(labels) || start == 0; start += stock.PerPage() {
+		page := &pdfPage{height: stock.PageHeight}
+		if err := drawSheet(page, stock, kind, labels[start:min(len(labels), start+stock.PerPage())]); err != nil {
+			return err
+		}
+		pages = append(pages, page)
+	}
+	return writePDF(w, pages, stock.PageWidth, stock.PageHeight)
+}
+
+// drawSheet lays the labels out row by row across one sheet
+func drawSheet(cv canvas, stock Stock, kind string, labels []Label) error {
+	for i, label := range labels {
+		symbol, err := NewSymbol(kind, label.Code)
+		if err != nil {
+			return fmt.Errorf("label %q: %w", label.Code, err)
+		}
+		x := stock.LeftMargin + float64(i%stock.Columns)*stock.HorizontalPitch
+		y := stock.TopMargin + float64(i/stock.Columns)*stock.VerticalPitch
+		drawLabel(cv, symbol, label, x, y, stock.LabelWidth, stock.LabelHeight)
+	}
+	return nil
+}
+
+// drawLabel places the text above a linear barcode, or beside a QR code
+func drawLabel(cv canvas, symbol *Symbol, label Label, x, y, w, h float64) {
+	x, y = x+labelPadding, y+labelPadding
+	w, h = w-2*labelPadding, h-2*labelPadding
+
+	textX, textWidth := x, w
+	if !symbol.linear() {
+		symbol.draw(cv, x, y, h, h)
+		textX, textWidth = x+h+labelPadding, w-h-labelPadding
+	}
+
+	lineY := y
+	if label.Title != "" {
+		lineY += titleSize
+		cv.text(textX, lineY, titleSize, fitText(label.Title, titleSize, textWidth))
+	}
+	if label.Subtitle != "" {
+		lineY += subtitleSize + 0.6
+		cv.text(textX, lineY, subtitleSize, fitText(label.Subtitle, subtitleSize, textWidth))
+	}
+
+	if symbol.linear() {
+		top := lineY + 1
+		bottom := y + h - codeSize - 0.6
+		symbol.draw(cv, x, top, w, bottom-top)
+		cv.centeredText(x+w/2, y+h, codeSize, label.Code)
+	} else {
+		cv.text(textX, y+h, codeSize, fitText(label.Code, codeSize, textWidth))
+	}
+}
+
+// fitText truncates s with an ellipsis so it fits within width
+func fitText(s string, size, width float64) string {
+	runes := []rune(s)
+	if textWidth(size, s) <= width {
+		return s
+	}
+	n := max(0, int(width/(size*0.55))-1)
+	return string(runes[:min(n, len(runes))]) + "…"
+}
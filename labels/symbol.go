@@ -0,0 +1,148 @@
+// Package labels renders barcodes and printable label sheets for library
+// items and member cards.
+package labels
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
+)
+
+// Supported barcode symbologies
+const (
+	Code128 = "code128"
+	QR      = "qr"
+)
+
+// Symbol is an encoded barcode ready to be drawn at any size
+type Symbol struct {
+	Kind    string
+	Content string
+	code    barcode.Barcode
+}
+
+// NewSymbol encodes content in the given symbology
+func NewSymbol(kind, content string) (*Symbol, error) {
+	var code barcode.Barcode
+	var err error
+	switch kind {
+	case Code128:
+		code, err = code128.Encode(content)
+	case QR:
+		code, err = qr.Encode(content, qr.M, qr.Auto)
+	default:
+		return nil, fmt.Errorf("unknown barcode type %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Symbol{Kind: kind, Content: content, code: code}, nil
+}
+
+// linear reports whether the symbol is a one-dimensional barcode
+func (s *Symbol) linear() bool {
+	return s.Kind == Code128
+}
+
+// quietZone is the blank margin required around the symbol, in modules
+func (s *Symbol) quietZone() int {
+	if s.linear() {
+		return 10
+	}
+	return 4
+}
+
+// modules returns the symbol size in modules including the quiet zone.
+// Linear barcodes have a height of one module row.
+func (s *Symbol) modules() (int, int) {
+	bounds := s.code.Bounds()
+	if s.linear() {
+		return bounds.Dx() + 2*s.quietZone(), 1
+	}
+	return bounds.Dx() + 2*s.quietZone(), bounds.Dy() + 2*s.quietZone()
+}
+
+// dark reports whether the module at x, y (quiet zone included) is dark
+func (s *Symbol) dark(x, y int) bool {
+	bounds := s.code.Bounds()
+	x -= s.quietZone()
+	if !s.linear() {
+		y -= s.quietZone()
+	}
+	if x < 0 || y < 0 || x >= bounds.Dx() || y >= bounds.Dy() {
+		return false
+	}
+	r, _, _, _ := s.code.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+	return r < 0x8000
+}
+
+// draw paints the symbol's dark modules into the box at x, y sized w by h,
+// merging horizontal runs so each bar is a single rectangle.
+func (s *Symbol) draw(cv canvas, x, y, w, h float64) {
+	cols, rows := s.modules()
+	mw, mh := w/float64(cols), h/float64(rows)
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; {
+			if !s.dark(col, row) {
+				col++
+				continue
+			}
+			start := col
+			for col < cols && s.dark(col, row) {
+				col++
+			}
+			cv.rect(x+float64(start)*mw, y+float64(row)*mh, float64(col-start)*mw, mh)
+		}
+	}
+}
+
+// WritePNG renders the symbol as a PNG with the given module size in
+// pixels. Linear barcodes are drawn 60 modules tall.
+func (s *Symbol) WritePNG(w io.Writer, module int) error {
+	cols, rows := s.modules()
+	height := rows * module
+	if s.linear() {
+		height = 60 * module
+	}
+	img := image.NewGray(image.Rect(0, 0, cols*module, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < cols*module; x++ {
+			row := y / module
+			if s.linear() {
+				row = 0
+			}
+			if s.dark(x/module, row) {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 0xff})
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// WriteSVG renders the symbol as a standalone SVG image with the given
+// module size in pixels. Linear barcodes carry their text underneath.
+func (s *Symbol) WriteSVG(w io.Writer, module int) error {
+	cols, rows := s.modules()
+	width, height := float64(cols*module), float64(rows*module)
+	barHeight := height
+	if s.linear() {
+		barHeight = float64(60 * module)
+		height = barHeight + float64(14*module)
+	}
+
+	cv := newSVGCanvas(width, height, "px")
+	s.draw(cv, 0, 0, width, barHeight)
+	if s.linear() {
+		cv.centeredText(width/2, height-float64(3*module), float64(10*module), s.Content)
+	}
+	_, err := io.WriteString(w, cv.String())
+	return err
+}
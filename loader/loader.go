@@ -0,0 +1,60 @@
+// Package loader batches lookups by key. Resolving a field for every item
+// in a list queues one key per item; the first result that is needed
+// fetches all the keys queued so far in one call, instead of one lookup
+// per item. Results are kept, so each key is fetched at most once.
+package loader
+
+import "sync"
+
+// Loader fetches values by key in batches. A Loader is meant to live for
+// one request, so it never sees changes made after a key was fetched.
+type Loader[K comparable, V any] struct {
+	fetch func(keys []K) map[K]V
+
+	mu    sync.Mutex
+	queue []K
+	// fetched is false for a queued key and true once it has been fetched
+	fetched map[K]bool
+	values  map[K]V
+}
+
+// New returns a loader that fetches with fetch. The map fetch returns
+// leaves out keys that have no value.
+func New[K comparable, V any](fetch func(keys []K) map[K]V) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, fetched: make(map[K]bool), values: make(map[K]V)}
+}
+
+// Load queues a key and returns a function that gives its value, and
+// whether there is one. Calling the function fetches every queued key.
+func (l *Loader[K, V]) Load(key K) func() (V, bool) {
+	l.mu.Lock()
+	if _, ok := l.fetched[key]; !ok {
+		l.fetched[key] = false
+		l.queue = append(l.queue, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, bool) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if !l.fetched[key] {
+			l.flush()
+		}
+		value, ok := l.values[key]
+		return value, ok
+	}
+}
+
+// flush fetches the queued keys.
+// The caller must hold l.mu.
+func (l *Loader[K, V]) flush() {
+	keys := l.queue
+	l.queue = nil
+	for key, value := range l.fetch(keys) {
+		l.values[key] = value
+	}
+	for _, key := range keys {
+		l.fetched[key] = true
+	}
+}
@@ -1,20 +1,136 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jerrylovee2/gogo/audit"
+	"github.com/jerrylovee2/gogo/auth"
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/circulation"
+	"github.com/jerrylovee2/gogo/data"
 	_ "github.com/jerrylovee2/gogo/docs"
 	handlers "github.com/jerrylovee2/gogo/handler"
+	"github.com/jerrylovee2/gogo/notify"
+	"github.com/jerrylovee2/gogo/ratelimit"
+	"github.com/jerrylovee2/gogo/scheduler"
+	"github.com/jerrylovee2/gogo/storage"
+	"github.com/jerrylovee2/gogo/stream"
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
 func main() {
+	blobDir := os.Getenv("BLOB_STORAGE_DIR")
+	if blobDir == "" {
+		blobDir = "blobs"
+	}
+	blobStore, err := storage.NewLocalStore(blobDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	handlers.CoverStore = blobStore
+
+	tokens, err := loadTokenIssuer()
+	if err != nil {
+		log.Fatal(err)
+	}
+	handlers.Tokens = tokens
+
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		provider, err := loadOIDCProvider(issuer)
+		if err != nil {
+			log.Fatal(err)
+		}
+		handlers.OIDC = provider
+	}
+
+	if path := os.Getenv("AUDIT_LOG_FILE"); path != "" {
+		auditLog, err := audit.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		handlers.Audit = auditLog
+	}
+
+	if err := loadRateLimits(os.Getenv("RATE_LIMITS")); err != nil {
+		log.Fatal(err)
+	}
+
+	notifier, err := loadNotifier()
+	if err != nil {
+		log.Fatal(err)
+	}
+	handlers.Notifier = notifier
+
+	switch username, password := os.Getenv("ADMIN_USERNAME"), os.Getenv("ADMIN_PASSWORD"); {
+	case username == "":
+		log.Println("ADMIN_USERNAME is not set; no staff account can log in")
+	case password == "":
+		log.Println("ADMIN_PASSWORD is not set; no admin account is created")
+	default:
+		if err := handlers.EnsureAdmin(username, password); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if value := os.Getenv("EVENT_BUFFER_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 0 {
+			log.Fatal(fmt.Errorf("EVENT_BUFFER_SIZE: invalid size %q", value))
+		}
+		handlers.Events = stream.NewBroker(size)
+	}
+	if value := os.Getenv("GRAPHQL_MAX_DEPTH"); value != "" {
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth < 1 {
+			log.Fatal(fmt.Errorf("GRAPHQL_MAX_DEPTH: invalid depth %q", value))
+		}
+		handlers.GraphQLMaxDepth = depth
+	}
+	if value := os.Getenv("GRAPHQL_MAX_COMPLEXITY"); value != "" {
+		complexity, err := strconv.Atoi(value)
+		if err != nil || complexity < 1 {
+			log.Fatal(fmt.Errorf("GRAPHQL_MAX_COMPLEXITY: invalid complexity %q", value))
+		}
+		handlers.GraphQLMaxComplexity = complexity
+	}
+	go handlers.Webhooks.Run(context.Background())
+
+	// The index and audit log are kept in step with each change; notices
+	// are sent in the background
+	bus.Subscribe("search-index", handlers.IndexBooks)
+	bus.Subscribe("audit", handlers.AuditEvents)
+	bus.Subscribe("events", handlers.BroadcastEvents)
+	bus.Subscribe("metrics", handlers.CountEvents)
+	bus.SubscribeAsync("notifications", notifier.HandleEvent)
+
+	jobs, err := loadJobs(notifier)
+	if err != nil {
+		log.Fatal(err)
+	}
+	handlers.Jobs = jobs
+	jobs.Start(context.Background())
+
 	r := gin.Default()
 
+	// Client addresses decide API key IP restrictions, so forwarding
+	// headers are only believed from configured proxies
+	var proxies []string
+	if list := os.Getenv("TRUSTED_PROXIES"); list != "" {
+		proxies = strings.Split(list, ",")
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Fatal(err)
+	}
+
 	r.Use(func(c *gin.Context) {
 		c.Next()
 		if len(c.Errors) > 0 {
@@ -23,22 +139,185 @@ func main() {
 			}
 		}
 	})
+	r.Use(handlers.RequestID)
+	r.Use(handlers.RateLimit)
 
-	r.POST("/books/create", handlers.CreateBookHandler)
-	r.DELETE("/books/delete", handlers.DeleteBookHandler)
+	r.POST("/books/create", handlers.Require(auth.CatalogWrite), handlers.CreateBookHandler)
+	r.PUT("/books/update", handlers.Require(auth.CatalogWrite), handlers.UpdateBookHandler)
+	r.DELETE("/books/delete", handlers.Require(auth.CatalogWrite), handlers.DeleteBookHandler)
 	r.GET("/books/all", handlers.GetAllBooksHandler)
 	r.GET("/books/search", handlers.SearchBooksHandler)
+	r.GET("/books/shelf", handlers.GetShelfHandler)
+	r.POST("/books/cover", handlers.Require(auth.CatalogWrite), handlers.UploadCoverHandler)
+	r.GET("/books/cover", handlers.GetCoverHandler)
+	r.DELETE("/books/cover", handlers.Require(auth.CatalogWrite), handlers.DeleteCoverHandler)
+	r.GET("/books/barcode", handlers.Require(auth.CatalogRead), handlers.GetBookBarcodeHandler)
+	r.GET("/books/versions", handlers.Require(auth.CatalogRead), handlers.GetBookVersionsHandler)
+	r.GET("/books/diff", handlers.Require(auth.CatalogRead), handlers.GetBookDiffHandler)
+	r.POST("/books/revert", handlers.Require(auth.CatalogWrite), handlers.RevertBookHandler)
+	r.GET("/books/trash", handlers.Require(auth.CatalogRead), handlers.GetTrashedBooksHandler)
+	r.POST("/books/restore", handlers.Require(auth.CatalogWrite), handlers.RestoreBookHandler)
+	r.GET("/books/history", handlers.Require(auth.CirculationRead), handlers.GetBookHistoryHandler)
+
+	r.GET("/labels/stocks", handlers.Require(auth.CatalogRead), handlers.GetLabelStocksHandler)
+	r.POST("/labels/sheet", handlers.Require(auth.CatalogRead), handlers.CreateLabelSheetHandler)
+
+	r.POST("/authors/create", handlers.Require(auth.CatalogWrite), handlers.CreateAuthorHandler)
+	r.PUT("/authors/update", handlers.Require(auth.CatalogWrite), handlers.UpdateAuthorHandler)
+	r.GET("/authors/get", handlers.GetAuthorByIDHandler)
+	r.GET("/authors/all", handlers.GetAllAuthorsHandler)
+	r.GET("/authors/search", handlers.SearchAuthorsHandler)
+
+	r.POST("/genres/create", handlers.Require(auth.CatalogWrite), handlers.CreateGenreHandler)
+	r.GET("/genres/all", handlers.GetGenreTreeHandler)
+	r.GET("/genres/get", handlers.GetGenreByIDHandler)
+	r.GET("/genres/books", handlers.GetGenreBooksHandler)
+	r.PUT("/genres/rename", handlers.Require(auth.CatalogWrite), handlers.RenameGenreHandler)
+	r.POST("/genres/move", handlers.Require(auth.CatalogWrite), handlers.MoveGenreHandler)
+	r.POST("/genres/merge", handlers.Require(auth.CatalogWrite), handlers.MergeGenreHandler)
+
+	r.POST("/members/create", handlers.Require(auth.MembersWrite), handlers.CreateMemberHandler)
+	r.PUT("/members/update", handlers.Require(auth.MembersWrite), handlers.UpdateMemberHandler)
+	r.GET("/members/get", handlers.Require(auth.MembersRead), handlers.GetMemberByIDHandler)
+	r.GET("/members/all", handlers.Require(auth.MembersRead), handlers.GetAllMembersHandler)
+	r.GET("/members/search", handlers.Require(auth.MembersRead), handlers.SearchMembersHandler)
+	r.GET("/members/categories", handlers.Require(auth.MembersRead), handlers.GetMembershipCategoriesHandler)
+	r.DELETE("/members/delete", handlers.Require(auth.MembersWrite), handlers.DeleteMemberByIDHandler)
+	r.GET("/members/barcode", handlers.Require(auth.MembersRead), handlers.GetMemberBarcodeHandler)
+	r.GET("/members/account", handlers.Require(auth.MembersRead), handlers.GetMemberAccountHandler)
+	r.POST("/members/password", handlers.Require(auth.MembersWrite), handlers.SetMemberPasswordHandler)
+	r.POST("/members/status", handlers.Require(auth.MembersWrite), handlers.SetMemberStatusHandler)
+	r.GET("/members/loans", handlers.Require(auth.CirculationRead), handlers.GetMemberLoansHandler)
+	r.GET("/members/holds", handlers.Require(auth.CirculationRead), handlers.GetMemberHoldsHandler)
+	r.GET("/members/fines", handlers.Require(auth.CirculationRead), handlers.GetMemberFinesHandler)
+	r.GET("/members/history", handlers.Require(auth.CirculationRead), handlers.GetMemberHistoryHandler)
+	r.GET("/members/versions", handlers.Require(auth.MembersRead), handlers.GetMemberVersionsHandler)
+	r.GET("/members/diff", handlers.Require(auth.MembersRead), handlers.GetMemberDiffHandler)
+	r.POST("/members/revert", handlers.Require(auth.MembersWrite), handlers.RevertMemberHandler)
+	r.GET("/members/trash", handlers.Require(auth.MembersRead), handlers.GetTrashedMembersHandler)
+	r.POST("/members/restore", handlers.Require(auth.MembersWrite), handlers.RestoreMemberHandler)
+	r.GET("/members/notifications", handlers.Require(auth.MembersRead), handlers.GetMemberNotificationPrefsHandler)
+	r.PUT("/members/notifications", handlers.Require(auth.MembersWrite), handlers.SetMemberNotificationPrefsHandler)
+
+	r.POST("/staff/login", handlers.StaffLoginHandler)
+	r.POST("/staff/refresh", handlers.RefreshTokenHandler)
+	r.GET("/staff/oidc/login", handlers.OIDCLoginHandler)
+	r.GET("/staff/oidc/callback", handlers.OIDCCallbackHandler)
+	r.POST("/staff/logout", handlers.StaffLogoutHandler)
+	r.GET("/staff/me", handlers.GetCurrentStaffHandler)
+	r.GET("/staff/roles", handlers.Require(auth.StaffAdmin), handlers.GetRolesHandler)
+	r.POST("/staff/create", handlers.Require(auth.StaffAdmin), handlers.CreateStaffHandler)
+	r.GET("/staff/all", handlers.Require(auth.StaffAdmin), handlers.GetAllStaffHandler)
+	r.PUT("/staff/update", handlers.Require(auth.StaffAdmin), handlers.UpdateStaffHandler)
+	r.POST("/staff/password", handlers.Require(auth.StaffAdmin), handlers.SetStaffPasswordHandler)
+	r.DELETE("/staff/delete", handlers.Require(auth.StaffAdmin), handlers.DeleteStaffHandler)
+	r.POST("/staff/revoke", handlers.Require(auth.StaffAdmin), handlers.RevokeStaffSessionsHandler)
+
+	r.POST("/apikeys/create", handlers.Require(auth.StaffAdmin), handlers.CreateAPIKeyHandler)
+	r.GET("/apikeys/all", handlers.Require(auth.StaffAdmin), handlers.GetAllAPIKeysHandler)
+	r.GET("/apikeys/get", handlers.Require(auth.StaffAdmin), handlers.GetAPIKeyHandler)
+	r.POST("/apikeys/revoke", handlers.Require(auth.StaffAdmin), handlers.RevokeAPIKeyHandler)
+	r.POST("/apikeys/rotate", handlers.Require(auth.StaffAdmin), handlers.RotateAPIKeyHandler)
+
+	r.GET("/audit/log", handlers.Require(auth.AuditRead), handlers.GetAuditLogHandler)
+	r.GET("/audit/verify", handlers.Require(auth.AuditRead), handlers.VerifyAuditLogHandler)
+
+	r.GET("/notifications/all", handlers.Require(auth.MembersRead), handlers.GetNotificationsHandler)
+	r.GET("/notifications/get", handlers.Require(auth.MembersRead), handlers.GetNotificationHandler)
+	r.POST("/notifications/retry", handlers.Require(auth.MembersWrite), handlers.RetryNotificationHandler)
+	r.POST("/notifications/run", handlers.Require(auth.MembersWrite), handlers.RunNotificationsHandler)
 
-	r.POST("/members/create", handlers.CreateMemberHandler)
-	r.GET("/members/get", handlers.GetMemberByIDHandler)
-	r.DELETE("/members/delete", handlers.DeleteMemberByIDHandler)
+	r.GET("/events/stream", handlers.Require(auth.CatalogRead), handlers.StreamEventsHandler)
+	r.GET("/metrics", handlers.Require(auth.StaffAdmin), handlers.GetMetricsHandler)
 
-	r.POST("/borrowers/create", handlers.CreateBorrowerHandler)
-	r.GET("/borrowers/get", handlers.GetBorrowerByIDHandler)
-	r.DELETE("/borrowers/delete", handlers.DeleteBorrowerByIDHandler)
+	r.GET("/webhooks/events", handlers.Require(auth.WebhooksManage), handlers.GetWebhookEventsHandler)
+	r.POST("/webhooks/create", handlers.Require(auth.WebhooksManage), handlers.CreateWebhookHandler)
+	r.GET("/webhooks/all", handlers.Require(auth.WebhooksManage), handlers.GetWebhooksHandler)
+	r.GET("/webhooks/get", handlers.Require(auth.WebhooksManage), handlers.GetWebhookHandler)
+	r.PUT("/webhooks/update", handlers.Require(auth.WebhooksManage), handlers.UpdateWebhookHandler)
+	r.DELETE("/webhooks/delete", handlers.Require(auth.WebhooksManage), handlers.DeleteWebhookHandler)
+	r.POST("/webhooks/rotate", handlers.Require(auth.WebhooksManage), handlers.RotateWebhookSecretHandler)
+	r.GET("/webhooks/deliveries", handlers.Require(auth.WebhooksManage), handlers.GetWebhookDeliveriesHandler)
+	r.GET("/webhooks/dead", handlers.Require(auth.WebhooksManage), handlers.GetDeadLettersHandler)
+	r.POST("/webhooks/redeliver", handlers.Require(auth.WebhooksManage), handlers.RedeliverWebhookHandler)
+
+	r.GET("/jobs/all", handlers.Require(auth.StaffAdmin), handlers.GetJobsHandler)
+	r.GET("/jobs/history", handlers.Require(auth.StaffAdmin), handlers.GetJobHistoryHandler)
+	r.POST("/jobs/trigger", handlers.Require(auth.StaffAdmin), handlers.TriggerJobHandler)
+	r.POST("/jobs/pause", handlers.Require(auth.StaffAdmin), handlers.PauseJobHandler)
+	r.POST("/jobs/resume", handlers.Require(auth.StaffAdmin), handlers.ResumeJobHandler)
+
+	r.GET("/reports/all", handlers.Require(auth.CirculationRead), handlers.GetReportsHandler)
+	r.GET("/reports/get", handlers.Require(auth.CirculationRead), handlers.GetReportHandler)
+	r.POST("/reports/create", handlers.Require(auth.CirculationWrite), handlers.CreateReportHandler)
+
+	r.GET("/.well-known/jwks.json", handlers.GetJWKSHandler)
+
+	r.POST("/me/login", handlers.MemberLoginHandler)
+	me := r.Group("/me", handlers.MemberAuth)
+	me.POST("/logout", handlers.MemberLogoutHandler)
+	me.PUT("/password", handlers.ChangeMyPasswordHandler)
+	me.GET("/profile", handlers.GetMyProfileHandler)
+	me.GET("/account", handlers.GetMyAccountHandler)
+	me.GET("/loans", handlers.GetMyLoansHandler)
+	me.GET("/holds", handlers.GetMyHoldsHandler)
+	me.GET("/fines", handlers.GetMyFinesHandler)
+	me.GET("/history", handlers.GetMyHistoryHandler)
+	me.POST("/renew", handlers.RenewMyLoanHandler)
+	me.POST("/holds/create", handlers.PlaceMyHoldHandler)
+	me.POST("/holds/cancel", handlers.CancelMyHoldHandler)
+	me.GET("/notifications", handlers.GetMyNotificationPrefsHandler)
+	me.PUT("/notifications", handlers.SetMyNotificationPrefsHandler)
+	me.GET("/inbox", handlers.GetMyInboxHandler)
+	me.POST("/inbox/seen", handlers.MarkMyInboxSeenHandler)
+
+	r.POST("/borrowers/create", handlers.Require(auth.CirculationWrite), handlers.CreateBorrowerHandler)
+	r.GET("/borrowers/get", handlers.Require(auth.CirculationRead), handlers.GetBorrowerByIDHandler)
+	r.DELETE("/borrowers/delete", handlers.Require(auth.CirculationWrite), handlers.DeleteBorrowerByIDHandler)
+	r.POST("/borrowers/renew", handlers.Require(auth.CirculationWrite), handlers.RenewBorrowerHandler)
+	r.POST("/borrowers/return", handlers.Require(auth.CirculationWrite), handlers.ReturnBorrowerHandler)
+	r.POST("/borrowers/lost", handlers.Require(auth.CirculationWrite), handlers.MarkLostHandler)
+	r.POST("/borrowers/found", handlers.Require(auth.CirculationWrite), handlers.MarkFoundHandler)
+	r.POST("/borrowers/rebuild", handlers.Require(auth.StaffAdmin), handlers.RebuildLoansHandler)
+
+	r.POST("/holds/create", handlers.Require(auth.CirculationWrite), handlers.CreateHoldHandler)
+	r.GET("/holds/get", handlers.Require(auth.CirculationRead), handlers.GetHoldByIDHandler)
+	r.POST("/holds/cancel", handlers.Require(auth.CirculationWrite), handlers.CancelHoldHandler)
+
+	r.POST("/fines/pay", handlers.Require(auth.CirculationWrite), handlers.PayFineHandler)
+	r.POST("/fines/waive", handlers.Require(auth.CirculationWrite), handlers.WaiveFineHandler)
+
+	// OPDS catalog feeds for e-reader apps, as Atom (OPDS 1.2) and JSON
+	// (OPDS 2.0)
+	for base, format := range map[string]string{"/opds": handlers.OPDSAtom, "/opds/v2": handlers.OPDSJSON} {
+		opds := r.Group(base, handlers.OPDSFeeds(base, format))
+		opds.GET("", handlers.OPDSRootHandler)
+		opds.GET("/new", handlers.OPDSNewArrivalsHandler)
+		opds.GET("/genres", handlers.OPDSGenresHandler)
+		opds.GET("/authors", handlers.OPDSAuthorsHandler)
+		opds.GET("/books", handlers.OPDSBooksHandler)
+	}
+	r.GET("/opds/opensearch.xml", handlers.OPDSFeeds("/opds", handlers.OPDSAtom), handlers.OPDSOpenSearchHandler)
+
+	// Each GraphQL field checks its own permission
+	r.POST("/graphql", handlers.GraphQLHandler)
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 
+	// Internal services call the same operations over gRPC on their own port
+	grpcPort := os.Getenv("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "9090"
+	}
+	listener, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		log.Fatal(fmt.Errorf("GRPC_PORT: %w", err))
+	}
+	go func() {
+		fmt.Printf("Starting gRPC server on port %s...\n", grpcPort)
+		log.Fatal(handlers.NewGRPCServer().Serve(listener))
+	}()
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8081"
@@ -47,3 +326,239 @@ func main() {
 	fmt.Printf("Starting server on port %s...\n", port)
 	log.Fatal(r.Run(":" + port))
 }
+
+// loadTokenIssuer configures access token signing from JWT_KEYS, a list of
+// id=path pairs, and JWT_ACTIVE_KEY. Without keys an ephemeral ECDSA key
+// is generated, so tokens stop working when the service restarts.
+func loadTokenIssuer() (*auth.TokenIssuer, error) {
+	issuer := &auth.TokenIssuer{Issuer: os.Getenv("JWT_ISSUER"), TTL: auth.DefaultAccessTTL}
+	if issuer.Issuer == "" {
+		issuer.Issuer = "gogo"
+	}
+	if ttl := os.Getenv("JWT_ACCESS_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_ACCESS_TTL: %w", err)
+		}
+		issuer.TTL = d
+	}
+
+	if spec := os.Getenv("JWT_KEYS"); spec != "" {
+		keys, err := auth.LoadKeySet(spec, os.Getenv("JWT_ACTIVE_KEY"))
+		if err != nil {
+			return nil, err
+		}
+		issuer.Keys = keys
+		return issuer, nil
+	}
+
+	log.Println("JWT_KEYS is not set; signing tokens with a temporary key")
+	key, err := auth.GenerateKey(strconv.FormatInt(time.Now().Unix(), 10))
+	if err != nil {
+		return nil, err
+	}
+	issuer.Keys, err = auth.NewKeySet(key)
+	return issuer, err
+}
+
+// loadOIDCProvider configures staff login through the identity provider
+// at issuer from the OIDC_* variables
+func loadOIDCProvider(issuer string) (*auth.OIDCProvider, error) {
+	roles, err := auth.ParseRoleMap(os.Getenv("OIDC_ROLE_MAP"))
+	if err != nil {
+		return nil, fmt.Errorf("OIDC_ROLE_MAP: %w", err)
+	}
+	config := auth.OIDCConfig{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		GroupsClaim:  os.Getenv("OIDC_GROUPS_CLAIM"),
+		RoleMap:      roles,
+	}
+	if scopes := os.Getenv("OIDC_SCOPES"); scopes != "" {
+		config.Scopes = strings.Fields(scopes)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return auth.NewOIDCProvider(ctx, config)
+}
+
+// loadNotifier sets up notices to members from the SMTP_*, SMS_* and
+// NOTIFY_* variables. The in-app inbox is always available; the other
+// channels are used when configured.
+func loadNotifier() (*notify.Notifier, error) {
+	notifier := notify.New()
+
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		from := os.Getenv("SMTP_FROM")
+		if from == "" {
+			from = "Library <library@localhost>"
+		}
+		notifier.Channels[data.ChannelEmail] = &notify.EmailChannel{Mailer: &notify.SMTPMailer{
+			Addr:     addr,
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}}
+	} else {
+		log.Println("SMTP_ADDR is not set; members will not be emailed")
+	}
+	if url := os.Getenv("SMS_GATEWAY_URL"); url != "" {
+		notifier.Channels[data.ChannelSMS] = notify.NewSMSChannel(url, os.Getenv("SMS_GATEWAY_TOKEN"), os.Getenv("SMS_FROM"))
+	}
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		notifier.Channels[data.ChannelWebhook] = notify.NewWebhookChannel(url, os.Getenv("NOTIFY_WEBHOOK_SECRET"))
+	}
+
+	for name, days := range map[string]*int{
+		"NOTIFY_COURTESY_DAYS":            &notifier.Schedule.CourtesyDays,
+		"NOTIFY_HOLD_EXPIRING_DAYS":       &notifier.Schedule.HoldExpiringDays,
+		"NOTIFY_MEMBERSHIP_EXPIRING_DAYS": &notifier.Schedule.MembershipExpiringDays,
+	} {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%s: invalid number of days %q", name, value)
+			}
+			*days = n
+		}
+	}
+	if value := os.Getenv("NOTIFY_OVERDUE_DAYS"); value != "" {
+		days, err := notify.ParseDays(value)
+		if err != nil {
+			return nil, fmt.Errorf("NOTIFY_OVERDUE_DAYS: %w", err)
+		}
+		notifier.Schedule.OverdueDays = days
+	}
+	if dir := os.Getenv("NOTIFY_TEMPLATE_DIR"); dir != "" {
+		templates, err := notify.LoadTemplates(os.DirFS(dir), ".")
+		if err != nil {
+			return nil, fmt.Errorf("NOTIFY_TEMPLATE_DIR: %w", err)
+		}
+		notifier.Templates = templates
+	}
+	return notifier, nil
+}
+
+// loadJobs sets up the recurring jobs, keeping their state in
+// SCHEDULER_STATE_FILE when set. JOB_SCHEDULES overrides schedules with a
+// list of name=schedule pairs such as "notices=@every 10m,purge-trash=@weekly".
+func loadJobs(notifier *notify.Notifier) (*scheduler.Scheduler, error) {
+	jobs := []scheduler.Job{
+		{
+			Name:     "notices",
+			Schedule: "@every 5m",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				queued, err := notifier.Scan(now)
+				return fmt.Sprintf("Queued %d loan and hold notices", queued), err
+			},
+		},
+		{
+			// Failed notices are retried by the notifier itself
+			Name:     "deliver-notices",
+			Schedule: "@every 1m",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				sent, failed := notifier.Deliver(now)
+				return fmt.Sprintf("Sent %d notices, %d failed", sent, failed), nil
+			},
+		},
+		{
+			Name:     "expire-holds",
+			Schedule: "*/15 * * * *",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				return fmt.Sprintf("Expired %d holds", len(circulation.ExpireHolds(ctx, now))), nil
+			},
+		},
+		{
+			Name:     "membership-expiry",
+			Schedule: "0 1 * * *",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				queued, err := notifier.ScanMemberships(now)
+				return fmt.Sprintf("Queued %d renewal reminders", queued), err
+			},
+		},
+		{
+			// Reports cover the previous day
+			Name:     "daily-report",
+			Schedule: "10 0 * * *",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				to := data.NewDate(now).Time
+				report := circulation.GenerateReport(to.AddDate(0, 0, -1), to, now)
+				return fmt.Sprintf("Generated report %d", report.ID), nil
+			},
+		},
+		{
+			// Deleted books and members are kept for a while so they can
+			// be restored, then purged
+			Name:     "purge-trash",
+			Schedule: "0 3 * * *",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				return fmt.Sprintf("Purged %d records", handlers.PurgeTrash(now)), nil
+			},
+		},
+		{
+			// Pending deliveries are kept until they are delivered or dead
+			Name:     "purge-webhook-deliveries",
+			Schedule: "30 3 * * *",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				return fmt.Sprintf("Purged %d webhook deliveries", handlers.Webhooks.Purge(now)), nil
+			},
+		},
+	}
+
+	schedules := make(map[string]string)
+	if spec := os.Getenv("JOB_SCHEDULES"); spec != "" {
+		for _, entry := range strings.Split(spec, ",") {
+			name, schedule, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok {
+				return nil, fmt.Errorf("JOB_SCHEDULES: invalid entry %q", entry)
+			}
+			schedules[name] = schedule
+		}
+	}
+
+	for i := range jobs {
+		if schedule, ok := schedules[jobs[i].Name]; ok {
+			jobs[i].Schedule = schedule
+			delete(schedules, jobs[i].Name)
+		}
+		jobs[i].MaxAttempts, jobs[i].Backoff = 3, 30*time.Second
+	}
+	for name := range schedules {
+		return nil, fmt.Errorf("JOB_SCHEDULES: unknown job %q", name)
+	}
+
+	s, err := scheduler.New(os.Getenv("SCHEDULER_STATE_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if err := s.Add(job); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// loadRateLimits turns on rate limiting with an in-process store,
+// overriding group limits from a list of group=limit pairs such as
+// "search=30/m,login=off"
+func loadRateLimits(spec string) error {
+	if spec != "" {
+		for _, entry := range strings.Split(spec, ",") {
+			group, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if _, known := handlers.RateLimitGroups[group]; !ok || !known {
+				return fmt.Errorf("RATE_LIMITS: invalid entry %q", entry)
+			}
+			limit, err := ratelimit.ParseLimit(value)
+			if err != nil {
+				return fmt.Errorf("RATE_LIMITS: %w", err)
+			}
+			handlers.RateLimitGroups[group] = limit
+		}
+	}
+	handlers.RateLimits = ratelimit.NewMemoryStore()
+	return nil
+}
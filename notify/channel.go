@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"errors"
+
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// Channel delivers notices one way, such as by email or SMS
+type Channel interface {
+	// Address returns where the member is reached on the channel, or an
+	// error saying why they cannot be
+	Address(member data.Member) (string, error)
+	// Send delivers a notice to its To address
+	Send(notice data.Notification) error
+}
+
+// EmailChannel sends notices through a Mailer
+type EmailChannel struct {
+	Mailer Mailer
+}
+
+func (e *EmailChannel) Address(member data.Member) (string, error) {
+	if member.Email == "" {
+		return "", errors.New("Member has no email address")
+	}
+	return member.Email, nil
+}
+
+func (e *EmailChannel) Send(notice data.Notification) error {
+	return e.Mailer.Send(notice.To, notice.Subject, notice.Body)
+}
+
+// InboxChannel keeps notices in the member's in-app inbox. The notice is
+// the inbox message, so delivering it only marks it sent.
+type InboxChannel struct{}
+
+func (InboxChannel) Address(member data.Member) (string, error) {
+	return member.ID, nil
+}
+
+func (InboxChannel) Send(data.Notification) error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// locale holds the names and layouts used to write dates in a language
+type locale struct {
+	days   [7]string
+	months [12]string
+	// date is a fmt format taking the weekday, day, month and year
+	date string
+	// datetime adds the time of day
+	datetime string
+}
+
+var locales = map[string]locale{
+	"en": {
+		days:     [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		months:   [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		date:     "%[1]s %[2]d %[3]s %[4]d",
+		datetime: "%[1]s %[2]d %[3]s %[4]d at %[5]s",
+	},
+	"es": {
+		days:     [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		months:   [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		date:     "%[1]s %[2]d de %[3]s de %[4]d",
+		datetime: "%[1]s %[2]d de %[3]s de %[4]d a las %[5]s",
+	},
+}
+
+// localeFor finds the locale for a language tag such as "es-MX", falling
+// back to its base language and then to English
+func localeFor(lang string) locale {
+	if l, ok := locales[lang]; ok {
+		return l
+	}
+	base, _, _ := strings.Cut(lang, "-")
+	if l, ok := locales[base]; ok {
+		return l
+	}
+	return locales[DefaultLanguage]
+}
+
+// funcs are the functions templates in the language can call
+func (l locale) funcs() template.FuncMap {
+	return template.FuncMap{
+		"date": func(t time.Time) string {
+			return fmt.Sprintf(l.date, l.days[t.Weekday()], t.Day(), l.months[t.Month()-1], t.Year())
+		},
+		"datetime": func(t time.Time) string {
+			return fmt.Sprintf(l.datetime, l.days[t.Weekday()], t.Day(), l.months[t.Month()-1], t.Year(), t.Format("15:04"))
+		},
+	}
+}
@@ -0,0 +1,349 @@
+// Package notify tells members about their loans, holds and membership:
+// courtesy reminders before a book is due, escalating overdue notices,
+// notices when a hold is ready for pickup or about to expire, and a
+// reminder to renew before a membership lapses. Notices are queued
+// in the in-memory database, one for each channel the member wants them
+// on, and delivered with retries.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jerrylovee2/gogo/bus"
+	"github.com/jerrylovee2/gogo/circulation"
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// Schedule decides when notices are sent
+type Schedule struct {
+	// CourtesyDays is how long before the due date a reminder is sent,
+	// zero for none
+	CourtesyDays int
+	// OverdueDays lists how many days late each escalating overdue
+	// notice is sent, in ascending order
+	OverdueDays []int
+	// HoldExpiringDays is how long before a ready hold expires a last
+	// reminder is sent, zero for none
+	HoldExpiringDays int
+	// MembershipExpiringDays is how long before a membership lapses a
+	// renewal reminder is sent, zero for none
+	MembershipExpiringDays int
+}
+
+// DefaultSchedule reminds members two days before a book is due, chases
+// it one, seven and fourteen days late, warns a day before a hold expires
+// and two weeks before a membership lapses
+var DefaultSchedule = Schedule{CourtesyDays: 2, OverdueDays: []int{1, 7, 14}, HoldExpiringDays: 1, MembershipExpiringDays: 14}
+
+// ParseDays reads a comma separated, ascending list of days such as
+// "1,7,14"
+func ParseDays(spec string) ([]int, error) {
+	var days []int
+	for _, field := range strings.Split(spec, ",") {
+		day, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || day < 1 || (len(days) > 0 && day <= days[len(days)-1]) {
+			return nil, fmt.Errorf("invalid day list %q", spec)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// Notifier queues and delivers notices
+type Notifier struct {
+	// Channels are the configured channels by name. Members who want
+	// notices on a channel that is not configured do not get them there.
+	Channels  map[string]Channel
+	Templates *Templates
+	Schedule  Schedule
+	// MaxAttempts is how many times delivery is tried before a notice
+	// is marked failed
+	MaxAttempts int
+	// RetryDelay is the wait after the first failed attempt. It doubles
+	// with each further attempt.
+	RetryDelay time.Duration
+
+	// mu stops deliveries overlapping, which could send a notice twice
+	mu sync.Mutex
+}
+
+// New returns a notifier with only the in-app inbox, the built-in
+// templates and the default schedule
+func New() *Notifier {
+	return &Notifier{
+		Channels:    map[string]Channel{data.ChannelInbox: InboxChannel{}},
+		Templates:   DefaultTemplates(),
+		Schedule:    DefaultSchedule,
+		MaxAttempts: 5,
+		RetryDelay:  time.Minute,
+	}
+}
+
+// Run queues the notices that have fallen due and delivers those waiting
+func (n *Notifier) Run(now time.Time) (queued, sent, failed int, err error) {
+	queued, err = n.Scan(now)
+	renewals, membershipErr := n.ScanMemberships(now)
+	sent, failed = n.Deliver(now)
+	return queued + renewals, sent, failed, errors.Join(err, membershipErr)
+}
+
+// scan counts the notices queued by a scan and collects its errors.
+// Notices whose template fails to render are reported and left for the
+// next scan.
+type scan struct {
+	n      *Notifier
+	now    time.Time
+	queued int
+	errs   []error
+}
+
+// queue queues a notice unless one was queued under key before.
+// The caller must hold the database lock.
+func (s *scan) queue(key string, notice data.Notification, msg Message) {
+	if _, ok := data.InMemoryDB.NoticeKeys[key]; ok {
+		return
+	}
+	ok, err := s.n.queue(key, notice, msg, s.now)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("%s notice: %w", notice.Kind, err))
+	} else if ok {
+		s.queued++
+	}
+}
+
+// Scan queues every loan and hold notice that has fallen due and not been
+// queued before, and returns how many it queued
+func (n *Notifier) Scan(now time.Time) (int, error) {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	s := &scan{n: n, now: now}
+	for _, loan := range data.InMemoryDB.Borrowers {
+		if !loan.Active() {
+			continue
+		}
+		loan := loan
+		notice := data.Notification{MemberID: loan.MemberID, LoanID: &loan.ID}
+		msg := Message{Loan: &loan}
+
+		if loan.Overdue(now) {
+			late := int(now.Sub(loan.DueDate).Hours() / 24)
+			level := 0
+			for _, after := range n.Schedule.OverdueDays {
+				if late >= after {
+					level++
+				}
+			}
+			if level == 0 {
+				continue
+			}
+			notice.Kind, notice.Level = data.NoticeOverdue, level
+			msg.Level, msg.DaysLate, msg.Penalty = level, late, circulation.Penalty(loan.DueDate, now)
+			s.queue(fmt.Sprintf("%s:%d:%d:%d", notice.Kind, loan.ID, loan.DueDate.Unix(), level), notice, msg)
+		} else if n.Schedule.CourtesyDays > 0 && loan.DueDate.Sub(now) <= days(n.Schedule.CourtesyDays) {
+			notice.Kind = data.NoticeCourtesy
+			s.queue(fmt.Sprintf("%s:%d:%d", notice.Kind, loan.ID, loan.DueDate.Unix()), notice, msg)
+		}
+	}
+
+	for _, hold := range data.InMemoryDB.Holds {
+		if hold.Status != data.HoldReady || hold.ExpiresAt == nil {
+			continue
+		}
+		hold := hold
+		notice := data.Notification{MemberID: hold.MemberID, HoldID: &hold.ID, Kind: data.NoticeHoldReady}
+		msg := Message{Hold: &hold}
+		s.queue(fmt.Sprintf("%s:%d", notice.Kind, hold.ID), notice, msg)
+
+		if n.Schedule.HoldExpiringDays > 0 && hold.ExpiresAt.Sub(now) <= days(n.Schedule.HoldExpiringDays) {
+			notice.Kind = data.NoticeHoldExpiring
+			s.queue(fmt.Sprintf("%s:%d", notice.Kind, hold.ID), notice, msg)
+		}
+	}
+
+	return s.queued, errors.Join(s.errs...)
+}
+
+// HandleEvent queues a hold's ready notice as soon as the hold becomes
+// ready, rather than at the next scan, and sends it. It is an
+// asynchronous subscriber, taking the database lock itself; a hold
+// already picked up or cancelled by then is left alone.
+func (n *Notifier) HandleEvent(env bus.Envelope) error {
+	ready, ok := env.Event.(data.HoldReadyForPickup)
+	if !ok {
+		return nil
+	}
+
+	data.InMemoryDB.Lock()
+	s := &scan{n: n, now: env.Time}
+	if hold, ok := data.InMemoryDB.Holds[ready.Hold.ID]; ok && hold.Status == data.HoldReady {
+		notice := data.Notification{MemberID: hold.MemberID, HoldID: &hold.ID, Kind: data.NoticeHoldReady}
+		s.queue(fmt.Sprintf("%s:%d", notice.Kind, hold.ID), notice, Message{Hold: &hold})
+	}
+	data.InMemoryDB.Unlock()
+
+	if s.queued > 0 {
+		n.Deliver(time.Now())
+	}
+	return errors.Join(s.errs...)
+}
+
+// ScanMemberships queues a renewal reminder for each membership lapsing
+// within the schedule's notice period, once for each expiry date, and
+// returns how many it queued
+func (n *Notifier) ScanMemberships(now time.Time) (int, error) {
+	if n.Schedule.MembershipExpiringDays == 0 {
+		return 0, nil
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	s := &scan{n: n, now: now}
+	today := data.NewDate(now)
+	for _, member := range data.InMemoryDB.Members {
+		if member.ExpiryDate.IsZero() || member.Expired(today) ||
+			member.ExpiryDate.Sub(today.Time) > days(n.Schedule.MembershipExpiringDays) {
+			continue
+		}
+		notice := data.Notification{MemberID: member.ID, Kind: data.NoticeMembership}
+		s.queue(fmt.Sprintf("%s:%s:%s", notice.Kind, member.ID, member.ExpiryDate.Format(data.DateLayout)), notice, Message{})
+	}
+	return s.queued, errors.Join(s.errs...)
+}
+
+// queue renders a notice and stores it under key on each channel the
+// member wants, unless the member has gone or opted out of its kind.
+// Notices to members who cannot be reached on a channel are stored as
+// skipped.
+// The caller must hold the database lock.
+func (n *Notifier) queue(key string, notice data.Notification, msg Message, now time.Time) (bool, error) {
+	member, ok := data.InMemoryDB.Members[notice.MemberID]
+	prefs := data.InMemoryDB.NotificationPrefs[notice.MemberID]
+	if !ok || !prefs.Wants(notice.Kind) {
+		return false, nil
+	}
+	msg.Member = member
+	if msg.Loan != nil || msg.Hold != nil {
+		msg.Book = book(bookID(msg))
+	}
+
+	lang := n.Templates.Language(prefs.Language, notice.Kind)
+	content, err := n.Templates.Render(notice.Kind, lang, msg)
+	if err != nil {
+		return false, err
+	}
+
+	channels := prefs.Channels
+	if len(channels) == 0 {
+		channels = data.DefaultChannels
+	}
+	queued := false
+	for _, name := range channels {
+		channel, ok := n.Channels[name]
+		if !ok {
+			continue
+		}
+
+		notice := notice
+		notice.ID = data.InMemoryDB.NextNotificationID
+		notice.Channel = name
+		notice.Language = lang
+		notice.Subject = content.Subject
+		notice.Body = content.Body
+		if name == data.ChannelSMS {
+			notice.Body = content.Text
+		}
+		notice.Status = data.NotificationPending
+		notice.Created = now
+		notice.NextAttempt = now
+		if notice.To, err = channel.Address(member); err != nil {
+			notice.Status = data.NotificationSkipped
+			notice.LastError = err.Error()
+		}
+		data.InMemoryDB.Notifications[notice.ID] = notice
+		data.InMemoryDB.NoticeKeys[key] = notice.ID
+		data.InMemoryDB.NextNotificationID++
+		queued = true
+	}
+	return queued, nil
+}
+
+// Deliver sends every pending notice whose next attempt is due and
+// returns how many were sent and how many failed for good
+func (n *Notifier) Deliver(now time.Time) (sent, failed int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	data.InMemoryDB.RLock()
+	var due []data.Notification
+	for _, notice := range data.InMemoryDB.Notifications {
+		if notice.Status == data.NotificationPending && !notice.NextAttempt.After(now) {
+			due = append(due, notice)
+		}
+	}
+	data.InMemoryDB.RUnlock()
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+
+	for _, notice := range due {
+		err := errors.New("Channel " + notice.Channel + " is not configured")
+		if channel, ok := n.Channels[notice.Channel]; ok {
+			err = channel.Send(notice)
+		}
+
+		data.InMemoryDB.Lock()
+		// Staff may have changed the notice while it was being sent
+		current, ok := data.InMemoryDB.Notifications[notice.ID]
+		if ok && current.Status == data.NotificationPending {
+			current.Attempts++
+			if err == nil {
+				sentAt := time.Now()
+				current.Status = data.NotificationSent
+				current.Sent = &sentAt
+				current.LastError = ""
+				sent++
+			} else {
+				current.LastError = err.Error()
+				if current.Attempts >= n.MaxAttempts {
+					current.Status = data.NotificationFailed
+					failed++
+				} else {
+					current.NextAttempt = now.Add(n.RetryDelay << (current.Attempts - 1))
+				}
+			}
+			data.InMemoryDB.Notifications[notice.ID] = current
+		}
+		data.InMemoryDB.Unlock()
+	}
+	return sent, failed
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+func bookID(msg Message) int {
+	if msg.Loan != nil {
+		return msg.Loan.BookID
+	}
+	return msg.Hold.BookID
+}
+
+// book finds a book for a notice, looking in the trash for one deleted
+// while on loan.
+// The caller must hold the database lock.
+func book(id int) data.Book {
+	if book, ok := data.InMemoryDB.Books[id]; ok {
+		return book
+	}
+	if trashed, ok := data.InMemoryDB.TrashedBooks[id]; ok {
+		return trashed.Value
+	}
+	return data.Book{ID: id, Title: fmt.Sprintf("Book %d", id)}
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// SMSChannel sends text messages through an HTTP gateway. Each message is
+// POSTed to URL as {"from": ..., "to": ..., "text": ...}, with the token
+// as a bearer token when set; any 2xx answer counts as accepted.
+type SMSChannel struct {
+	URL    string
+	Token  string
+	From   string
+	Client *http.Client
+}
+
+// NewSMSChannel returns a channel sending through the gateway at url
+func NewSMSChannel(url, token, from string) *SMSChannel {
+	return &SMSChannel{URL: url, Token: token, From: from, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type smsMessage struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+func (s *SMSChannel) Address(member data.Member) (string, error) {
+	if member.PhoneNumber == "" {
+		return "", errors.New("Member has no phone number")
+	}
+	return member.PhoneNumber, nil
+}
+
+func (s *SMSChannel) Send(notice data.Notification) error {
+	body, err := json.Marshal(smsMessage{From: s.From, To: notice.To, Text: notice.Body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	return post(s.Client, req)
+}
+
+// post sends a request, treating any answer but 2xx as a failure
+func post(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
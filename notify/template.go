@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// DefaultLanguage is used for members who have not chosen a language, and
+// for any notice not translated into the one they chose
+const DefaultLanguage = "en"
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+// Message is what a notice template is rendered from. Loan is set for
+// courtesy and overdue notices and Hold for hold notices; membership
+// notices have neither, nor a Book.
+type Message struct {
+	Member   data.Member
+	Book     data.Book
+	Loan     *data.Borrower
+	Hold     *data.Hold
+	Level    int
+	DaysLate int
+	Penalty  float64
+}
+
+// Content is a rendered notice. Text is a one-line version for channels
+// that carry short messages, such as SMS.
+type Content struct {
+	Subject string
+	Body    string
+	Text    string
+}
+
+// Templates holds a template for each notice kind in each language. Each
+// defines a "subject" and a "body", and may define a short "text".
+type Templates struct {
+	languages map[string]map[string]*template.Template
+}
+
+// DefaultTemplates returns the built-in templates
+func DefaultTemplates() *Templates {
+	templates, err := LoadTemplates(defaultTemplates, "templates")
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+// LoadTemplates reads templates from a directory per language, such as
+// en/courtesy.tmpl and es/courtesy.tmpl. The default language must have
+// every notice kind; others fall back to it for any they lack.
+func LoadTemplates(fsys fs.FS, dir string) (*Templates, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{languages: make(map[string]map[string]*template.Template)}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		lang := entry.Name()
+		kinds := make(map[string]*template.Template)
+		for _, kind := range data.NoticeKinds {
+			file := path.Join(dir, lang, kind+".tmpl")
+			if _, err := fs.Stat(fsys, file); err != nil {
+				if lang == DefaultLanguage {
+					return nil, fmt.Errorf("%s: %w", file, err)
+				}
+				continue
+			}
+			tmpl, err := template.New(kind+".tmpl").Funcs(localeFor(lang).funcs()).ParseFS(fsys, file)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range []string{"subject", "body"} {
+				if tmpl.Lookup(name) == nil {
+					return nil, fmt.Errorf("%s does not define %q", file, name)
+				}
+			}
+			kinds[kind] = tmpl
+		}
+		t.languages[lang] = kinds
+	}
+	if _, ok := t.languages[DefaultLanguage]; !ok {
+		return nil, fmt.Errorf("no templates for the default language %q", DefaultLanguage)
+	}
+	return t, nil
+}
+
+// Languages lists the languages with templates
+func (t *Templates) Languages() []string {
+	langs := make([]string, 0, len(t.languages))
+	for lang := range t.languages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Supports reports whether there are notices in lang or, for a regional
+// tag such as es-MX, in its base language, the same fallback Language
+// uses
+func (t *Templates) Supports(lang string) bool {
+	base, _, _ := strings.Cut(lang, "-")
+	for _, candidate := range []string{lang, base} {
+		if _, ok := t.languages[candidate]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Language returns the language a notice in lang is written in: lang
+// itself, its base language, or the default language
+func (t *Templates) Language(lang, kind string) string {
+	base, _, _ := strings.Cut(lang, "-")
+	for _, candidate := range []string{lang, base} {
+		if _, ok := t.languages[candidate][kind]; ok {
+			return candidate
+		}
+	}
+	return DefaultLanguage
+}
+
+// Render produces a notice in the given language, which must be one
+// returned by Language
+func (t *Templates) Render(kind, lang string, msg Message) (Content, error) {
+	tmpl, ok := t.languages[lang][kind]
+	if !ok {
+		return Content{}, fmt.Errorf("no %s template for %s notices", lang, kind)
+	}
+
+	var subject, body, text bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", msg); err != nil {
+		return Content{}, err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", msg); err != nil {
+		return Content{}, err
+	}
+	if tmpl.Lookup("text") != nil {
+		if err := tmpl.ExecuteTemplate(&text, "text", msg); err != nil {
+			return Content{}, err
+		}
+	}
+
+	// A subject is a single header line
+	content := Content{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Body:    strings.TrimSpace(body.String()) + "\n",
+		Text:    strings.Join(strings.Fields(text.String()), " "),
+	}
+	if content.Text == "" {
+		content.Text = content.Subject
+	}
+	return content, nil
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// WebhookChannel POSTs each notice as JSON to a URL, for example a push
+// notification service. When Secret is set the body is signed with
+// HMAC-SHA256 in the X-Signature header as sha256=<hex>.
+type WebhookChannel struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// NewWebhookChannel returns a channel posting notices to url
+func NewWebhookChannel(url, secret string) *WebhookChannel {
+	return &WebhookChannel{URL: url, Secret: secret, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Address is the member ID, which the receiver uses to find the member
+func (w *WebhookChannel) Address(member data.Member) (string, error) {
+	return member.ID, nil
+}
+
+func (w *WebhookChannel) Send(notice data.Notification) error {
+	body, err := json.Marshal(notice)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return post(w.Client, req)
+}
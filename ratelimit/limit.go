@@ -0,0 +1,112 @@
+// Package ratelimit implements token bucket rate limiting with a
+// pluggable store, so several instances of the service can share limits.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Per on average, with bursts of up to Burst
+// requests
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// Unlimited reports whether the limit lets every request through
+func (l Limit) Unlimited() bool {
+	return l.Requests <= 0
+}
+
+// rate is how many tokens the bucket gains per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// String formats the limit the way ParseLimit reads it
+func (l Limit) String() string {
+	if l.Unlimited() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s:%d", l.Requests, l.Per, l.Burst)
+}
+
+// ParseLimit reads a limit written as requests/period with an optional
+// :burst, such as "60/m", "10/30s" or "300/1m:50". The burst defaults to
+// the request count. "off" means unlimited.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" {
+		return Limit{}, nil
+	}
+	spec, burst, hasBurst := strings.Cut(s, ":")
+	count, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected requests/period", s)
+	}
+
+	var limit Limit
+	var err error
+	if limit.Requests, err = strconv.Atoi(count); err != nil || limit.Requests <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: bad request count", s)
+	}
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	if limit.Per, err = time.ParseDuration(period); err != nil || limit.Per <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: bad period", s)
+	}
+	limit.Burst = limit.Requests
+	if hasBurst {
+		if limit.Burst, err = strconv.Atoi(burst); err != nil || limit.Burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid limit %q: bad burst", s)
+		}
+	}
+	return limit, nil
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until a token is available, zero when one is
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets. MemoryStore keeps them in process; a store
+// shared between instances, such as one backed by Redis, must take tokens
+// atomically.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// fill returns the tokens in a bucket that held tokens at updated
+func fill(tokens float64, updated, now time.Time, limit Limit) float64 {
+	return math.Min(float64(limit.Burst), tokens+now.Sub(updated).Seconds()*limit.rate())
+}
+
+// take removes a token from a bucket if it has one, returning the tokens
+// left and the outcome
+func take(tokens float64, limit Limit) (float64, Result) {
+	result := Result{Allowed: tokens >= 1}
+	if result.Allowed {
+		tokens--
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / limit.rate())
+	}
+	result.Remaining = int(tokens)
+	result.Reset = seconds((float64(limit.Burst) - tokens) / limit.rate())
+	return tokens, result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Limit
+	}{
+		{"60/m", Limit{Requests: 60, Per: time.Minute, Burst: 60}},
+		{"10/30s", Limit{Requests: 10, Per: 30 * time.Second, Burst: 10}},
+		{"300/1m:50", Limit{Requests: 300, Per: time.Minute, Burst: 50}},
+		{"5/h:1", Limit{Requests: 5, Per: time.Hour, Burst: 1}},
+		{" 2/500ms ", Limit{Requests: 2, Per: 500 * time.Millisecond, Burst: 2}},
+		{"off", Limit{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseLimit(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseLimit(%q): %v", tt.spec, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+			// String writes the limit back in a form ParseLimit reads
+			if again, err := ParseLimit(got.String()); err != nil || again != got {
+				t.Errorf("ParseLimit(%q) = %+v, %v, want %+v", got.String(), again, err, got)
+			}
+		})
+	}
+}
+
+func TestParseLimitRejectsInvalidLimits(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"60",
+		"OFF",
+		"x/m",
+		"0/m",
+		"-1/m",
+		"60/",
+		"60/fortnight",
+		"60/0s",
+		"60/-1m",
+		"60/m:",
+		"60/m:0",
+		"60/m:-5",
+		"60/m:x",
+	} {
+		if _, err := ParseLimit(spec); err == nil {
+			t.Errorf("ParseLimit(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestFill(t *testing.T) {
+	// One token a second, up to 5
+	limit := Limit{Requests: 60, Per: time.Minute, Burst: 5}
+	at := time.Date(2025, time.March, 3, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"no time passed", 1.5, 0, 1.5},
+		{"half a second", 0, 500 * time.Millisecond, 0.5},
+		{"two seconds", 1, 2 * time.Second, 3},
+		{"capped at the burst", 4, time.Hour, 5},
+		{"already full", 5, time.Second, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fill(tt.tokens, at, at.Add(tt.elapsed), limit); got != tt.want {
+				t.Errorf("fill(%v, %v) = %v, want %v", tt.tokens, tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTake(t *testing.T) {
+	// One token a second, up to 5
+	limit := Limit{Requests: 60, Per: time.Minute, Burst: 5}
+	tests := []struct {
+		name   string
+		tokens float64
+		left   float64
+		want   Result
+	}{
+		{"full", 5, 4, Result{Allowed: true, Remaining: 4, Reset: time.Second}},
+		{"part full", 2.5, 1.5, Result{Allowed: true, Remaining: 1, Reset: 3500 * time.Millisecond}},
+		{"last token", 1, 0, Result{Allowed: true, Remaining: 0, Reset: 5 * time.Second}},
+		{"empty", 0, 0, Result{Remaining: 0, Reset: 5 * time.Second, RetryAfter: time.Second}},
+		{"under a token", 0.25, 0.25, Result{Remaining: 0, Reset: 4750 * time.Millisecond, RetryAfter: 750 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left, got := take(tt.tokens, limit)
+			if left != tt.left || got != tt.want {
+				t.Errorf("take(%v) = %v, %+v, want %v, %+v", tt.tokens, left, got, tt.left, tt.want)
+			}
+		})
+	}
+}
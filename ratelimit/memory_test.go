@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2025, time.March, 3, 10, 0, 0, 0, time.UTC)
+	now := start
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	// One token a second, up to 3
+	limit := Limit{Requests: 60, Per: time.Minute, Burst: 3}
+
+	steps := []struct {
+		at   time.Duration
+		key  string
+		want Result
+	}{
+		{0, "a", Result{Allowed: true, Remaining: 2, Reset: time.Second}},
+		{0, "a", Result{Allowed: true, Remaining: 1, Reset: 2 * time.Second}},
+		{0, "a", Result{Allowed: true, Remaining: 0, Reset: 3 * time.Second}},
+		// Drained
+		{0, "a", Result{Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}},
+		// Other clients have their own buckets
+		{0, "b", Result{Allowed: true, Remaining: 2, Reset: time.Second}},
+		{500 * time.Millisecond, "a", Result{Remaining: 0, Reset: 2500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+		// A refused request does not cost a token
+		{time.Second, "a", Result{Allowed: true, Remaining: 0, Reset: 3 * time.Second}},
+		{time.Second, "a", Result{Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}},
+		// The bucket refills to the burst and no further
+		{time.Minute, "a", Result{Allowed: true, Remaining: 2, Reset: time.Second}},
+	}
+	for i, step := range steps {
+		now = start.Add(step.at)
+		got, err := store.Take(ctx, step.key, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != step.want {
+			t.Errorf("step %d: Take(%s) at %v = %+v, want %+v", i, step.key, step.at, got, step.want)
+		}
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2025, time.March, 3, 10, 0, 0, 0, time.UTC)
+	now := start
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	fast := Limit{Requests: 60, Per: time.Minute, Burst: 3}
+	slow := Limit{Requests: 1, Per: time.Hour, Burst: 3}
+
+	store.Take(ctx, "fast", fast)
+	store.Take(ctx, "slow", slow)
+	now = start.Add(time.Minute)
+	store.sweep(now)
+
+	// The fast bucket has refilled and is forgotten; the slow one has not
+	if _, ok := store.buckets["fast"]; ok {
+		t.Error("full bucket was kept")
+	}
+	if _, ok := store.buckets["slow"]; !ok {
+		t.Error("bucket still refilling was forgotten")
+	}
+}
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRejectsInvalidSchedules(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		"@every",
+		"@every soon",
+		"@every 500ms",
+		"@fortnightly",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2025, time.January, 15, 10, 7, 30, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2025, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", at(time.January, 15, 10, 8)},
+		{"*/15 * * * *", at(time.January, 15, 10, 15)},
+		{"5/20 * * * *", at(time.January, 15, 10, 25)},
+		{"10-30/10 * * * *", at(time.January, 15, 10, 10)},
+		{"0,45 * * * *", at(time.January, 15, 10, 45)},
+		{"0 9-17 * * *", at(time.January, 15, 11, 0)},
+		{"30 6 * * *", at(time.January, 16, 6, 30)},
+		{"0 0 1 * *", at(time.February, 1, 0, 0)},
+		{"0 0 * 3 *", at(time.March, 1, 0, 0)},
+		{"0 12 * * 1-5", at(time.January, 15, 12, 0)},
+		{"0 12 * * 6", at(time.January, 18, 12, 0)},
+		// Sunday is both 0 and 7
+		{"0 12 * * 0", at(time.January, 19, 12, 0)},
+		{"0 12 * * 7", at(time.January, 19, 12, 0)},
+		// With both day fields restricted either one will do: the 20th
+		// or a Friday, whichever comes first
+		{"0 0 20 * 5", at(time.January, 17, 0, 0)},
+		{"0 0 16 * 5", at(time.January, 16, 0, 0)},
+		// With one day field unrestricted only the other counts
+		{"0 0 20 * *", at(time.January, 20, 0, 0)},
+		{"0 0 * * 5", at(time.January, 17, 0, 0)},
+		{"@hourly", at(time.January, 15, 11, 0)},
+		{"@daily", at(time.January, 16, 0, 0)},
+		{"@weekly", at(time.January, 19, 0, 0)},
+		{"@monthly", at(time.February, 1, 0, 0)},
+		{"@yearly", time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", from.Add(90 * time.Second)},
+		{" @every 10m ", from.Add(10 * time.Minute)},
+		// 31 February never comes
+		{"0 0 31 2 *", time.Time{}},
+		{"0 0 30,31 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.spec, err)
+			}
+			if got := schedule.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextIsAfterAMatchingTime(t *testing.T) {
+	schedule, err := Parse("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2025, time.January, 15, 10, 0, 0, 0, time.UTC)
+	want := time.Date(2025, time.January, 15, 11, 0, 0, 0, time.UTC)
+	if got := schedule.Next(from); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", from, got, want)
+	}
+}
@@ -0,0 +1,424 @@
+// Package scheduler runs recurring jobs inside the service. Each job has a
+// cron-like schedule, is retried with backoff when it fails, and keeps a
+// history of its runs. Job state can be kept in a file so that schedules,
+// pauses and history survive a restart, and so that no scheduled run is
+// started twice: a run is recorded, and the job's next run time moved on,
+// before the run begins. A run cut short by a restart is recorded as
+// interrupted rather than started again.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrJobNotFound = errors.New("Job not found")
+	ErrJobRunning  = errors.New("Job is already running")
+)
+
+// Run statuses
+const (
+	StatusRunning     = "running"
+	StatusSucceeded   = "succeeded"
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+)
+
+// Run triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// historyLimit is how many past runs are kept across all jobs
+const historyLimit = 500
+
+// Job is a task run on a schedule. Run reports what it did in a short
+// result. A failed run is tried up to MaxAttempts times, waiting Backoff
+// after the first failure and twice as long after each further one.
+type Job struct {
+	Name        string
+	Schedule    string
+	Run         func(ctx context.Context, now time.Time) (string, error)
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// Run is one execution of a job
+type Run struct {
+	ID        int        `json:"id"`
+	Job       string     `json:"job"`
+	Trigger   string     `json:"trigger"`
+	Scheduled time.Time  `json:"scheduled"`
+	Started   time.Time  `json:"started"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	Attempts  int        `json:"attempts"`
+	Status    string     `json:"status"`
+	Result    string     `json:"result,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// JobState is a job's schedule and where it stands
+type JobState struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Paused   bool      `json:"paused"`
+	NextRun  time.Time `json:"next_run"`
+	Running  *Run      `json:"running,omitempty"`
+	LastRun  *Run      `json:"last_run,omitempty"`
+}
+
+// state is what is kept in the state file
+type state struct {
+	NextRunID int                  `json:"next_run_id"`
+	Jobs      map[string]*JobState `json:"jobs"`
+	History   []Run                `json:"history"`
+}
+
+type job struct {
+	Job
+	schedule Schedule
+}
+
+// Scheduler runs jobs. Create one with New, add jobs with Add, then call
+// Start.
+type Scheduler struct {
+	mu    sync.Mutex
+	path  string
+	jobs  map[string]*job
+	state state
+	// ctx is passed to runs and cancelled when the scheduler stops
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+// New returns a scheduler keeping its state in the file at path, or only
+// in memory when path is empty. Runs the file shows as still running were
+// cut short by a restart and are recorded as interrupted.
+func New(path string) (*Scheduler, error) {
+	s := &Scheduler{
+		path:  path,
+		jobs:  make(map[string]*job),
+		state: state{Jobs: make(map[string]*JobState)},
+		ctx:   context.Background(),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.state); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.state.Jobs == nil {
+		s.state.Jobs = make(map[string]*JobState)
+	}
+
+	now := time.Now()
+	for _, js := range s.state.Jobs {
+		if js.Running != nil {
+			run := *js.Running
+			run.Status = StatusInterrupted
+			run.Error = "Service stopped during the run"
+			run.Finished = &now
+			s.finish(js, run)
+		}
+	}
+	return s, s.save()
+}
+
+// Add registers a job. A job already known from the state file keeps its
+// pause and next run time, unless its schedule has changed.
+func (s *Scheduler) Add(j Job) error {
+	schedule, err := Parse(j.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", j.Name, err)
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return fmt.Errorf("job %s: schedule %q never runs", j.Name, j.Schedule)
+	}
+	if j.MaxAttempts < 1 {
+		j.MaxAttempts = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[j.Name] = &job{Job: j, schedule: schedule}
+	js, ok := s.state.Jobs[j.Name]
+	if !ok {
+		js = &JobState{Name: j.Name}
+		s.state.Jobs[j.Name] = js
+	}
+	if !ok || js.Schedule != j.Schedule || js.NextRun.IsZero() {
+		js.Schedule = j.Schedule
+		js.NextRun = schedule.Next(time.Now())
+	}
+	return s.save()
+}
+
+// Start runs jobs as they fall due until ctx is cancelled. A job whose
+// run time passed while the service was down runs once straight away.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.runDue(now)
+			}
+		}
+	}()
+}
+
+// Wait blocks until every run in progress has finished
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) runDue(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, js := range s.state.Jobs {
+		j, ok := s.jobs[name]
+		if !ok || js.Paused || js.Running != nil || js.NextRun.After(now) {
+			continue
+		}
+		s.start(j, js, TriggerSchedule, now)
+	}
+}
+
+// start records a run, moves the job's next run time on and saves both
+// before running the job in the background.
+// The caller must hold s.mu.
+func (s *Scheduler) start(j *job, js *JobState, trigger string, now time.Time) Run {
+	run := Run{
+		ID:        s.state.NextRunID,
+		Job:       j.Name,
+		Trigger:   trigger,
+		Scheduled: js.NextRun,
+		Started:   now,
+		Status:    StatusRunning,
+	}
+	if trigger == TriggerManual {
+		run.Scheduled = now
+	} else {
+		js.NextRun = j.schedule.Next(now)
+	}
+	s.state.NextRunID++
+	js.Running = &run
+	if err := s.save(); err != nil {
+		log.Println(err)
+	}
+
+	ctx := s.ctx
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.execute(ctx, j, run)
+	}()
+	return run
+}
+
+// execute runs a job, retrying with backoff, and records the outcome
+func (s *Scheduler) execute(ctx context.Context, j *job, run Run) {
+	backoff := j.Backoff
+	for {
+		run.Attempts++
+		result, err := call(ctx, j, run.Started)
+		if err == nil {
+			run.Status, run.Result, run.Error = StatusSucceeded, result, ""
+			break
+		}
+		run.Error = err.Error()
+		if run.Attempts >= j.MaxAttempts {
+			run.Status = StatusFailed
+			break
+		}
+
+		s.mu.Lock()
+		if js := s.state.Jobs[j.Name]; js.Running != nil && js.Running.ID == run.ID {
+			progress := run
+			js.Running = &progress
+			if err := s.save(); err != nil {
+				log.Println(err)
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			run.Status = StatusInterrupted
+		case <-time.After(backoff):
+		}
+		if run.Status == StatusInterrupted {
+			break
+		}
+		backoff *= 2
+	}
+
+	finished := time.Now()
+	run.Finished = &finished
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finish(s.state.Jobs[j.Name], run)
+	if err := s.save(); err != nil {
+		log.Println(err)
+	}
+}
+
+// call runs the job once, turning a panic into an error
+func call(ctx context.Context, j *job, now time.Time) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.Run(ctx, now)
+}
+
+// finish moves a run into the history.
+// The caller must hold s.mu.
+func (s *Scheduler) finish(js *JobState, run Run) {
+	js.Running = nil
+	js.LastRun = &run
+	s.state.History = append(s.state.History, run)
+	if len(s.state.History) > historyLimit {
+		s.state.History = s.state.History[len(s.state.History)-historyLimit:]
+	}
+}
+
+// save writes the state file, replacing it in one step so a crash never
+// leaves it half written.
+// The caller must hold s.mu.
+func (s *Scheduler) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Trigger runs a job now, outside its schedule. Its next scheduled run is
+// unchanged.
+func (s *Scheduler) Trigger(name string) (Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, js, err := s.lookup(name)
+	if err != nil {
+		return Run{}, err
+	}
+	if js.Running != nil {
+		return Run{}, ErrJobRunning
+	}
+	return s.start(j, js, TriggerManual, time.Now()), nil
+}
+
+// Pause stops a job's scheduled runs. A run in progress finishes.
+func (s *Scheduler) Pause(name string) (JobState, error) {
+	return s.setPaused(name, true)
+}
+
+// Resume restarts a paused job's schedule from now
+func (s *Scheduler) Resume(name string) (JobState, error) {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) (JobState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, js, err := s.lookup(name)
+	if err != nil {
+		return JobState{}, err
+	}
+	if js.Paused && !paused {
+		js.NextRun = j.schedule.Next(time.Now())
+	}
+	js.Paused = paused
+	return *js, s.save()
+}
+
+// lookup finds a registered job.
+// The caller must hold s.mu.
+func (s *Scheduler) lookup(name string) (*job, *JobState, error) {
+	j, ok := s.jobs[name]
+	if !ok {
+		return nil, nil, ErrJobNotFound
+	}
+	return j, s.state.Jobs[name], nil
+}
+
+// Jobs returns the state of every registered job, by name
+func (s *Scheduler) Jobs() []JobState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]JobState, 0, len(s.jobs))
+	for name := range s.jobs {
+		jobs = append(jobs, *s.state.Jobs[name])
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// History returns up to limit finished runs, newest first, of one job or
+// of all jobs when name is empty
+func (s *Scheduler) History(name string, limit int) []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := []Run{}
+	for i := len(s.state.History) - 1; i >= 0 && len(runs) < limit; i-- {
+		if run := s.state.History[i]; name == "" || run.Job == name {
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
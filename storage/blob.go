@@ -0,0 +1,27 @@
+// Package storage provides blob storage for binary assets such as cover images
+package storage
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys that are empty or escape the store
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore stores binary objects under slash-separated keys
+type BlobStore interface {
+	Put(key string, r io.Reader) error
+	Get(key string) (io.ReadCloser, BlobInfo, error)
+	Delete(key string) error
+}
@@ -0,0 +1,112 @@
+// Package stream fans library events out to live subscribers, such as
+// clients of the Server-Sent Events endpoint. The most recent events are
+// kept in a bounded buffer so that a subscriber that reconnects can pick
+// up where it left off.
+package stream
+
+import (
+	"sync"
+
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// subscriberBuffer is how many events may wait for a subscriber before it
+// is considered too slow and dropped
+const subscriberBuffer = 256
+
+// Broker numbers events and passes them to subscribers
+type Broker struct {
+	mu sync.Mutex
+	// buffer is a ring of the last len(buffer) events; count of them are
+	// filled, the oldest at start
+	buffer      []data.Event
+	start       int
+	count       int
+	nextID      int
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives the events its filter matches on Events. Events is
+// closed when the subscriber falls too far behind.
+type Subscription struct {
+	Events <-chan data.Event
+	events chan data.Event
+	match  func(data.Event) bool
+}
+
+// NewBroker returns a broker keeping the last size events
+func NewBroker(size int) *Broker {
+	return &Broker{buffer: make([]data.Event, size), subscribers: make(map[*Subscription]struct{})}
+}
+
+// Publish numbers an event, keeps it in the buffer and sends it to every
+// subscriber it matches, and returns it numbered. It never blocks on a
+// subscriber: one whose queue is full is dropped, and can resume from the
+// buffer when it subscribes again.
+func (b *Broker) Publish(event data.Event) data.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event.ID = b.nextID
+	b.nextID++
+	if len(b.buffer) > 0 {
+		if b.count < len(b.buffer) {
+			b.buffer[(b.start+b.count)%len(b.buffer)] = event
+			b.count++
+		} else {
+			b.buffer[b.start] = event
+			b.start = (b.start + 1) % len(b.buffer)
+		}
+	}
+
+	for sub := range b.subscribers {
+		if !sub.match(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+	return event
+}
+
+// Subscribe starts passing matching events to a new subscription. A
+// subscriber resuming after the event with ID after also gets the
+// matching events it missed; complete is false when some of them are no
+// longer in the buffer, or after is not an event the broker knows. A
+// negative after starts with the next event.
+func (b *Broker) Subscribe(match func(data.Event) bool, after int) (sub *Subscription, missed []data.Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events := make(chan data.Event, subscriberBuffer)
+	sub = &Subscription{Events: events, events: events, match: match}
+	b.subscribers[sub] = struct{}{}
+	if after < 0 {
+		return sub, nil, true
+	}
+
+	oldest := b.nextID - b.count
+	complete = after >= oldest-1 && after < b.nextID
+	for i := 0; i < b.count; i++ {
+		event := b.buffer[(b.start+i)%len(b.buffer)]
+		if event.ID > after && match(event) {
+			missed = append(missed, event)
+		}
+	}
+	return sub, missed, complete
+}
+
+// Unsubscribe stops a subscription
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
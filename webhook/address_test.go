@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"::ffff:93.184.216.34", true},
+		{"127.0.0.1", false},
+		{"127.255.255.254", false},
+		{"::1", false},
+		// IPv4-mapped addresses are checked as the IPv4 address
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"::", false},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.255", false},
+		{"192.0.0.8", false},
+		{"198.18.0.1", false},
+		{"198.19.255.255", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		// Just outside the internal ranges
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+		{"172.32.0.1", true},
+		{"198.20.0.1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := publicAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("publicAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://93.184.216.34/hooks", nil},
+		{"http://93.184.216.34:8080/hooks?x=1", nil},
+		{"https://[2606:4700:4700::1111]/hooks", nil},
+		{"ftp://93.184.216.34/hooks", ErrInvalidURL},
+		{"/hooks", ErrInvalidURL},
+		{"https:///hooks", ErrInvalidURL},
+		{"https://%zz/", ErrInvalidURL},
+		{"http://localhost/hooks", ErrPrivateAddress},
+		{"http://localhost./hooks", ErrPrivateAddress},
+		{"http://LOCALHOST:8080/hooks", ErrPrivateAddress},
+		{"http://api.localhost/hooks", ErrPrivateAddress},
+		{"http://127.0.0.1/hooks", ErrPrivateAddress},
+		{"http://127.0.0.1:8080/hooks", ErrPrivateAddress},
+		{"http://[::1]/hooks", ErrPrivateAddress},
+		{"http://[::ffff:127.0.0.1]/hooks", ErrPrivateAddress},
+		{"http://[::ffff:169.254.169.254]/latest/meta-data", ErrPrivateAddress},
+		{"http://0.0.0.0/hooks", ErrPrivateAddress},
+		{"http://10.1.2.3/hooks", ErrPrivateAddress},
+		{"http://100.64.0.1/hooks", ErrPrivateAddress},
+		{"http://169.254.169.254/latest/meta-data", ErrPrivateAddress},
+		{"http://[fc00::1]/hooks", ErrPrivateAddress},
+		{"http://[fe80::1]/hooks", ErrPrivateAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if err := CheckURL(context.Background(), tt.url); err != tt.want {
+				t.Errorf("CheckURL(%q) = %v, want %v", tt.url, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback server")
+	}))
+	defer srv.Close()
+
+	resp, err := newClient(time.Second).Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, errDialPrivate) {
+		t.Errorf("Get(%s) = %v, want %v", srv.URL, err, errDialPrivate)
+	}
+}
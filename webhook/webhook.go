@@ -0,0 +1,306 @@
+// Package webhook delivers library events to subscribers. Events are
+// published to an outbox as changes happen and fanned out to every active
+// webhook subscribed to them. Each delivery is a signed POST, retried with
+// exponential backoff until it succeeds or runs out of attempts and
+// becomes a dead letter.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jerrylovee2/gogo/data"
+)
+
+// Dispatcher fans events out to webhooks and delivers them
+type Dispatcher struct {
+	Client *http.Client
+	// MaxAttempts is how many times a delivery is tried before it becomes
+	// a dead letter
+	MaxAttempts int
+	// RetryDelay is the wait after the first failed attempt. It doubles
+	// with each further attempt.
+	RetryDelay time.Duration
+	// Interval is how often Run looks for retries that have fallen due
+	Interval time.Duration
+	// Retention is how long delivered deliveries and dead letters are
+	// kept before Purge removes them
+	Retention time.Duration
+	// Allowed reports whether a webhook's owner may still receive an
+	// event type. It is called with the database lock held. A nil Allowed
+	// lets every owner receive every event.
+	Allowed func(owner, eventType string) bool
+
+	mu     sync.Mutex
+	outbox []data.Event
+	wake   chan struct{}
+
+	// delivering stops deliveries overlapping, which could send an event
+	// twice
+	delivering sync.Mutex
+}
+
+// New returns a dispatcher trying each delivery 8 times over about an
+// hour, connecting only to public addresses
+func New() *Dispatcher {
+	return &Dispatcher{
+		Client:      newClient(10 * time.Second),
+		MaxAttempts: 8,
+		RetryDelay:  30 * time.Second,
+		Interval:    5 * time.Second,
+		Retention:   30 * 24 * time.Hour,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Publish adds an event to the outbox. It does not touch the database, so
+// it may be called with or without the database lock held.
+func (d *Dispatcher) Publish(event data.Event) {
+	d.mu.Lock()
+	d.outbox = append(d.outbox, event)
+	d.mu.Unlock()
+
+	d.Wake()
+}
+
+// Wake makes Run deliver straight away, for example after a delivery has
+// been queued again
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run fans out and delivers published events as they arrive, and retries
+// failed deliveries as they fall due, until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+		now := time.Now()
+		d.Flush(now)
+		d.Deliver(now)
+	}
+}
+
+// Flush empties the outbox, queueing a delivery of each event to every
+// active webhook subscribed to it whose owner may still receive it. It
+// returns how many deliveries it queued.
+func (d *Dispatcher) Flush(now time.Time) int {
+	d.mu.Lock()
+	events := d.outbox
+	d.outbox = nil
+	d.mu.Unlock()
+	if len(events) == 0 {
+		return 0
+	}
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	hooks := make([]data.Webhook, 0, len(data.InMemoryDB.Webhooks))
+	for _, hook := range data.InMemoryDB.Webhooks {
+		hooks = append(hooks, hook)
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+
+	queued := 0
+	for _, event := range events {
+		for _, hook := range hooks {
+			if !hook.Active || !subscribed(hook, event.Type) || !d.allowed(hook, event.Type) {
+				continue
+			}
+			delivery := data.WebhookDelivery{
+				ID:          data.InMemoryDB.NextDeliveryID,
+				WebhookID:   hook.ID,
+				Event:       event,
+				Status:      data.DeliveryPending,
+				NextAttempt: now,
+				Created:     now,
+				Attempts:    []data.DeliveryAttempt{},
+			}
+			data.InMemoryDB.WebhookDeliveries[delivery.ID] = delivery
+			data.InMemoryDB.NextDeliveryID++
+			queued++
+		}
+	}
+	return queued
+}
+
+func (d *Dispatcher) allowed(hook data.Webhook, eventType string) bool {
+	return d.Allowed == nil || d.Allowed(hook.Owner, eventType)
+}
+
+func subscribed(hook data.Webhook, eventType string) bool {
+	for _, t := range hook.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Deliver sends every pending delivery whose next attempt is due, oldest
+// first, and returns how many were delivered and how many became dead
+// letters. Deliveries to paused webhooks wait until they are resumed.
+// Deliveries whose webhook owner may no longer receive the event become
+// dead letters without being sent.
+func (d *Dispatcher) Deliver(now time.Time) (delivered, dead int) {
+	d.delivering.Lock()
+	defer d.delivering.Unlock()
+
+	type due struct {
+		delivery data.WebhookDelivery
+		hook     data.Webhook
+	}
+	data.InMemoryDB.Lock()
+	var queue []due
+	for id, delivery := range data.InMemoryDB.WebhookDeliveries {
+		hook, ok := data.InMemoryDB.Webhooks[delivery.WebhookID]
+		if !ok || !hook.Active || delivery.Status != data.DeliveryPending || delivery.NextAttempt.After(now) {
+			continue
+		}
+		if !d.allowed(hook, delivery.Event.Type) {
+			delivery.Attempts = append(delivery.Attempts, data.DeliveryAttempt{
+				Time:  now,
+				Error: "Webhook owner may no longer receive " + delivery.Event.Type,
+			})
+			delivery.Status = data.DeliveryDead
+			data.InMemoryDB.WebhookDeliveries[id] = delivery
+			dead++
+			continue
+		}
+		queue = append(queue, due{delivery, hook})
+	}
+	data.InMemoryDB.Unlock()
+	sort.Slice(queue, func(i, j int) bool { return queue[i].delivery.ID < queue[j].delivery.ID })
+
+	for _, next := range queue {
+		attempt := d.send(next.hook, next.delivery)
+
+		data.InMemoryDB.Lock()
+		// The delivery may have been redelivered or its webhook deleted
+		// while it was being sent
+		current, ok := data.InMemoryDB.WebhookDeliveries[next.delivery.ID]
+		if ok && current.Status == data.DeliveryPending {
+			current.Attempts = append(current.Attempts, attempt)
+			if attempt.Error == "" {
+				current.Status = data.DeliveryDelivered
+				current.Delivered = &attempt.Time
+				delivered++
+			} else {
+				current.Failures++
+				if current.Failures >= d.MaxAttempts {
+					current.Status = data.DeliveryDead
+					dead++
+				} else {
+					current.NextAttempt = now.Add(d.RetryDelay << (current.Failures - 1))
+				}
+			}
+			data.InMemoryDB.WebhookDeliveries[current.ID] = current
+		}
+		data.InMemoryDB.Unlock()
+	}
+	return delivered, dead
+}
+
+// Purge removes delivered deliveries and dead letters whose last attempt
+// is older than the retention period, and returns how many it removed.
+// Pending deliveries are kept however old they are.
+func (d *Dispatcher) Purge(now time.Time) int {
+	cutoff := now.Add(-d.Retention)
+
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	purged := 0
+	for id, delivery := range data.InMemoryDB.WebhookDeliveries {
+		if delivery.Status == data.DeliveryPending {
+			continue
+		}
+		last := delivery.Created
+		if n := len(delivery.Attempts); n > 0 {
+			last = delivery.Attempts[n-1].Time
+		}
+		if last.Before(cutoff) {
+			delete(data.InMemoryDB.WebhookDeliveries, id)
+			purged++
+		}
+	}
+	return purged
+}
+
+// send POSTs a delivery's event to its webhook. Any 2xx answer counts as
+// delivered.
+func (d *Dispatcher) send(hook data.Webhook, delivery data.WebhookDelivery) data.DeliveryAttempt {
+	start := time.Now()
+	attempt := data.DeliveryAttempt{Time: start}
+	fail := func(err error) data.DeliveryAttempt {
+		attempt.Error = err.Error()
+		attempt.DurationMS = time.Since(start).Milliseconds()
+		return attempt
+	}
+
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return fail(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fail(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gogo-webhooks")
+	req.Header.Set("X-Webhook-Event", delivery.Event.Type)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-Signature", Sign(hook.Secret, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return fail(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fail(fmt.Errorf("%s answered %s", req.URL.Host, resp.Status))
+	}
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	return attempt
+}
+
+// Sign returns the X-Signature header for a body: sha256= followed by the
+// hex HMAC-SHA256 of the body keyed with the webhook's secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret generates a signing secret for a webhook
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,169 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jerrylovee2/gogo/data"
+)
+
+var epoch = time.Date(2025, time.March, 3, 10, 0, 0, 0, time.UTC)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		secret string
+		body   string
+		want   string
+	}{
+		{"whsec_test", `{"id":1,"type":"book.created"}`, "sha256=cd83e8ca0676293a7c97576f8b592c1c9f7598b948fc2468da523fe4f1ac57c1"},
+		{"whsec_other", `{"id":1,"type":"book.created"}`, "sha256=e6478b2a25256fd97c41ee5561c7f327bacec9a3990085e2e730ca6c1bdcac16"},
+		{"whsec_test", "", "sha256=43c0f4d23c8e8841358fad4624b1a592799222b29f25bb59baea43cdcb522ed1"},
+	}
+	for _, tt := range tests {
+		if got := Sign(tt.secret, []byte(tt.body)); got != tt.want {
+			t.Errorf("Sign(%q, %q) = %s, want %s", tt.secret, tt.body, got, tt.want)
+		}
+	}
+}
+
+// resetDB empties the webhook tables
+func resetDB() {
+	data.InMemoryDB.Lock()
+	defer data.InMemoryDB.Unlock()
+
+	data.InMemoryDB.Webhooks = make(map[int]data.Webhook)
+	data.InMemoryDB.WebhookDeliveries = make(map[int]data.WebhookDelivery)
+	data.InMemoryDB.NextDeliveryID = 0
+}
+
+// testDispatcher returns a dispatcher posting to a webhook served by
+// handler, with one event already queued for it
+func testDispatcher(t *testing.T, handler http.HandlerFunc) *Dispatcher {
+	t.Helper()
+	resetDB()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	data.InMemoryDB.Webhooks[0] = data.Webhook{ID: 0, URL: srv.URL, Events: []string{"book.created"}, Active: true, Owner: "staff:admin", Secret: "whsec_test"}
+	d := New()
+	// The test server listens on loopback, which the default client refuses
+	d.Client = srv.Client()
+	d.MaxAttempts = 3
+	d.RetryDelay = time.Minute
+	d.Publish(data.Event{ID: 1, Type: "book.created", Time: epoch})
+	if n := d.Flush(epoch); n != 1 {
+		t.Fatalf("Flush() = %d, want 1", n)
+	}
+	return d
+}
+
+func TestDeliverSignsTheBody(t *testing.T) {
+	d := testDispatcher(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get("X-Signature"), Sign("whsec_test", body); got != want {
+			t.Errorf("X-Signature = %s, want %s", got, want)
+		}
+		if got := r.Header.Get("X-Webhook-Event"); got != "book.created" {
+			t.Errorf("X-Webhook-Event = %s, want book.created", got)
+		}
+	})
+
+	if delivered, dead := d.Deliver(epoch); delivered != 1 || dead != 0 {
+		t.Fatalf("Deliver() = %d, %d, want 1, 0", delivered, dead)
+	}
+	delivery := data.InMemoryDB.WebhookDeliveries[0]
+	if delivery.Status != data.DeliveryDelivered || delivery.Delivered == nil || len(delivery.Attempts) != 1 {
+		t.Errorf("delivery = %+v, want delivered after one attempt", delivery)
+	}
+	// A delivered delivery is not sent again
+	if delivered, dead := d.Deliver(epoch.Add(time.Hour)); delivered != 0 || dead != 0 {
+		t.Errorf("Deliver() again = %d, %d, want 0, 0", delivered, dead)
+	}
+}
+
+func TestDeliverBacksOffThenGivesUp(t *testing.T) {
+	var calls atomic.Int32
+	d := testDispatcher(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	steps := []struct {
+		at          time.Time
+		calls       int32
+		status      string
+		failures    int
+		nextAttempt time.Time
+	}{
+		{epoch, 1, data.DeliveryPending, 1, epoch.Add(time.Minute)},
+		// Not due yet
+		{epoch.Add(59 * time.Second), 1, data.DeliveryPending, 1, epoch.Add(time.Minute)},
+		{epoch.Add(time.Minute), 2, data.DeliveryPending, 2, epoch.Add(3 * time.Minute)},
+		{epoch.Add(3 * time.Minute), 3, data.DeliveryDead, 3, epoch.Add(3 * time.Minute)},
+		// A dead letter is not tried again
+		{epoch.Add(time.Hour), 3, data.DeliveryDead, 3, epoch.Add(3 * time.Minute)},
+	}
+	for i, step := range steps {
+		d.Deliver(step.at)
+		delivery := data.InMemoryDB.WebhookDeliveries[0]
+		if calls.Load() != step.calls || delivery.Status != step.status || delivery.Failures != step.failures || !delivery.NextAttempt.Equal(step.nextAttempt) {
+			t.Fatalf("step %d: %d calls, delivery %s after %d failures next at %v; want %d calls, %s after %d next at %v",
+				i, calls.Load(), delivery.Status, delivery.Failures, delivery.NextAttempt,
+				step.calls, step.status, step.failures, step.nextAttempt)
+		}
+	}
+	attempts := data.InMemoryDB.WebhookDeliveries[0].Attempts
+	if len(attempts) != 3 || attempts[2].StatusCode != http.StatusServiceUnavailable || attempts[2].Error == "" {
+		t.Errorf("attempts = %+v, want 3 failed with 503", attempts)
+	}
+}
+
+func TestDeliverSkipsOwnersNoLongerAllowed(t *testing.T) {
+	d := testDispatcher(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("delivery sent to an owner no longer allowed to receive it")
+	})
+	d.Allowed = func(owner, eventType string) bool { return false }
+
+	if delivered, dead := d.Deliver(epoch); delivered != 0 || dead != 1 {
+		t.Errorf("Deliver() = %d, %d, want 0, 1", delivered, dead)
+	}
+	if delivery := data.InMemoryDB.WebhookDeliveries[0]; delivery.Status != data.DeliveryDead {
+		t.Errorf("delivery status = %s, want %s", delivery.Status, data.DeliveryDead)
+	}
+
+	// Nor are new events queued for them
+	d.Publish(data.Event{ID: 2, Type: "book.created", Time: epoch})
+	if n := d.Flush(epoch); n != 0 {
+		t.Errorf("Flush() = %d, want 0", n)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	resetDB()
+	d := New()
+	d.Retention = 24 * time.Hour
+	old, recent := epoch.Add(-25*time.Hour), epoch.Add(-time.Hour)
+	for id, delivery := range map[int]data.WebhookDelivery{
+		0: {Status: data.DeliveryDelivered, Created: old, Attempts: []data.DeliveryAttempt{{Time: old}}},
+		1: {Status: data.DeliveryDead, Created: old, Attempts: []data.DeliveryAttempt{{Time: old}}},
+		2: {Status: data.DeliveryPending, Created: old},
+		3: {Status: data.DeliveryDead, Created: old, Attempts: []data.DeliveryAttempt{{Time: old}, {Time: recent}}},
+		4: {Status: data.DeliveryDelivered, Created: recent, Attempts: []data.DeliveryAttempt{{Time: recent}}},
+	} {
+		delivery.ID = id
+		data.InMemoryDB.WebhookDeliveries[id] = delivery
+	}
+
+	if n := d.Purge(epoch); n != 2 {
+		t.Errorf("Purge() = %d, want 2", n)
+	}
+	for _, id := range []int{2, 3, 4} {
+		if _, ok := data.InMemoryDB.WebhookDeliveries[id]; !ok {
+			t.Errorf("delivery %d was purged", id)
+		}
+	}
+}